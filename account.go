@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+func (a *app) meHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.getMeHandler(w, r)
+	case http.MethodDelete:
+		a.deleteMeHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// getMeHandler returns the logged-in user. The password hash never leaves
+// the server since User omits it from JSON.
+func (a *app) getMeHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+
+	u, err := a.users.Get(r.Context(), userID)
+	if errors.Is(err, errNotFound) {
+		// The session outlived its account.
+		writeJSONError(w, http.StatusUnauthorized, msgUnauthorized)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("me query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// deleteMeHandler removes the account and everything it owns. The current
+// password must be re-entered in the body.
+func (a *app) deleteMeHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	var body struct {
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+
+	u, err := a.users.Get(r.Context(), userID)
+	if errors.Is(err, errNotFound) {
+		writeJSONError(w, http.StatusUnauthorized, msgUnauthorized)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("deleteMe query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	// Checked like a login, lockout included, so a stolen session can't
+	// be used to guess the password here instead.
+	if loginLocked(w, r, u.Username) {
+		return
+	}
+	if err := comparePassword([]byte(u.Password), []byte(body.Password)); err != nil {
+		loginFailed(r, u.Username)
+		writeJSONError(w, http.StatusForbidden, msgPasswordIncorrect)
+		return
+	}
+	if loginGuard != nil {
+		if err := loginGuard.Succeed(r.Context(), u.Username); err != nil {
+			requestLog(r).Error("deleteMe reset failures", "err", err)
+		}
+	}
+
+	files, err := userAttachmentFiles(r.Context(), userID)
+	if err != nil {
+		requestLog(r).Error("deleteMe attachments", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	if err := a.users.Delete(r.Context(), userID); err != nil {
+		requestLog(r).Error("deleteMe delete", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	a.removeAttachmentFiles(files)
+
+	sessions.DeleteUser(userID)
+	clearSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMe(t *testing.T) {
+	a, _, users := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	wantStatus(t, c.do("GET", "/me", nil), http.StatusUnauthorized)
+
+	userID := c.login("alice")
+	resp := c.do("GET", "/me", nil)
+	wantStatus(t, resp, http.StatusOK)
+	body := readBody(t, resp)
+	if strings.Contains(body, "password") || strings.Contains(body, "$2a$") {
+		t.Fatalf("/me leaks the password hash: %s", body)
+	}
+	if !strings.Contains(body, `"username":"alice"`) {
+		t.Fatalf("/me = %s", body)
+	}
+
+	// A session that outlived its account is no longer logged in.
+	users.Delete(t.Context(), userID)
+	wantStatus(t, c.do("GET", "/me", nil), http.StatusUnauthorized)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+	note := c.createNote(map[string]string{"title": "mine"})
+	wantStatus(t, c.upload(fmt.Sprintf("/notes/%d/attachments", note.ID), "a.png", pngBytes), http.StatusCreated)
+	second := c.newClient()
+	wantStatus(t, second.do("POST", "/login", map[string]string{"username": "alice", "password": "correct horse battery"}), http.StatusOK)
+	bob := c.newClient()
+	bob.login("bob")
+	bobNote := bob.createNote(map[string]string{"title": "bob's"})
+
+	wantStatus(t, c.do("DELETE", "/me", map[string]string{"password": "wrong password"}), http.StatusForbidden)
+	wantStatus(t, c.do("DELETE", "/me", map[string]string{"password": "correct horse battery"}), http.StatusNoContent)
+
+	// Every session of the account ends, and everything it owned is gone.
+	wantStatus(t, c.do("GET", "/me", nil), http.StatusUnauthorized)
+	wantStatus(t, second.do("GET", "/me", nil), http.StatusUnauthorized)
+	if n, _ := a.notes.Count(t.Context(), userID, NoteFilter{}); n != 0 {
+		t.Fatalf("%d notes survive the account", n)
+	}
+	if n := uploadedFiles(t, a); n != 0 {
+		t.Fatalf("%d attachment files survive the account", n)
+	}
+	wantStatus(t, bob.do("GET", fmt.Sprintf("/notes/%d", bobNote.ID), nil), http.StatusOK)
+
+	// The name is free again.
+	c.newClient().login("alice")
+}
+
+func TestDeleteAccountWrongPassword(t *testing.T) {
+	a, _, users := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+	wantStatus(t, c.do("DELETE", "/me", map[string]string{"password": "wrong password"}), http.StatusForbidden)
+	wantStatus(t, c.do("DELETE", "/me", nil), http.StatusBadRequest)
+	if _, err := users.Get(t.Context(), userID); err != nil {
+		t.Fatalf("account gone after refused deletes: %v", err)
+	}
+}
+
+func TestDeleteAccountComparesPassword(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	var compared int
+	old := comparePassword
+	t.Cleanup(func() { comparePassword = old })
+	comparePassword = func(hash, password []byte) error {
+		compared++
+		return old(hash, password)
+	}
+
+	wantJSONError(t, c.do("DELETE", "/me", map[string]string{"password": "wrong password"}), http.StatusForbidden)
+	if compared != 1 {
+		t.Fatalf("%d comparisons through comparePassword, want 1", compared)
+	}
+}
+
+// TestDeleteAccountLockout checks wrong passwords on DELETE /me count
+// toward the login lockout, and a locked account can't be deleted.
+func TestDeleteAccountLockout(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+	old := loginGuard
+	t.Cleanup(func() { loginGuard = old })
+	loginGuard = newLoginGuard(db, 2, time.Hour)
+	t.Cleanup(loginGuard.Stop)
+
+	wrong := map[string]string{"password": "wrong password"}
+	wantStatus(t, c.do("DELETE", "/me", wrong), http.StatusForbidden)
+	wantStatus(t, c.do("DELETE", "/me", wrong), http.StatusForbidden)
+	resp := c.do("DELETE", "/me", map[string]string{"password": "correct horse battery"})
+	wantJSONError(t, resp, http.StatusTooManyRequests)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("no Retry-After")
+	}
+	if _, err := a.users.Get(t.Context(), userID); err != nil {
+		t.Fatalf("locked account was deleted: %v", err)
+	}
+	// Logging in is locked too: it's the same counter.
+	wantStatus(t, c.newClient().do("POST", "/login", map[string]string{"username": "alice", "password": "correct horse battery"}), http.StatusTooManyRequests)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// AdminUser is a user as listed to admins. It never carries the password.
+type AdminUser struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	IsAdmin   bool   `json:"is_admin"`
+	NoteCount int    `json:"note_count"`
+	// LastLoginAt is nil for accounts that haven't logged in since it
+	// started being recorded.
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// MarshalJSON emits LastLoginAt in UTC, like Note.
+func (au AdminUser) MarshalJSON() ([]byte, error) {
+	type plain AdminUser
+	p := plain(au)
+	if p.LastLoginAt != nil {
+		t := p.LastLoginAt.UTC()
+		p.LastLoginAt = &t
+	}
+	return json.Marshal(p)
+}
+
+// NoteAudit is where a note was created from.
+type NoteAudit struct {
+	NoteID    int       `json:"note_id"`
+	UserID    int       `json:"user_id"`
+	IP        *string   `json:"created_ip"`
+	UserAgent *string   `json:"created_user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MarshalJSON emits CreatedAt in UTC, like Note.
+func (na NoteAudit) MarshalJSON() ([]byte, error) {
+	type plain NoteAudit
+	p := plain(na)
+	p.CreatedAt = p.CreatedAt.UTC()
+	return json.Marshal(p)
+}
+
+// promoteAdmin grants admin rights to username's existing account, if one
+// is configured (ADMIN_USERNAME).
+func promoteAdmin(username string) error {
+	if username == "" {
+		return nil
+	}
+	_, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE LOWER(username) = ?`, username)
+	return err
+}
+
+// adminMiddleware lets only admins through. It runs after authMiddleware.
+func (a *app) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(userIDKey).(int)
+		u, err := a.users.Get(r.Context(), userID)
+		if errors.Is(err, errNotFound) {
+			writeJSONError(w, http.StatusUnauthorized, msgUnauthorized)
+			return
+		}
+		if err != nil {
+			requestLog(r).Error("admin check", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		if !u.IsAdmin {
+			writeJSONError(w, http.StatusForbidden, msgAdminOnly)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func adminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeAdminUsers(w, r, "")
+}
+
+// adminInactiveUsersHandler lists the accounts that haven't logged in since
+// ?since=, a date or RFC3339 timestamp. Accounts with no recorded login
+// count as inactive.
+func adminInactiveUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		http.Error(w, "since is required", http.StatusBadRequest)
+		return
+	}
+	since, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if since, err = time.Parse(time.DateOnly, v); err != nil {
+			http.Error(w, "since must be a date (YYYY-MM-DD) or an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	writeAdminUsers(w, r, "WHERE u.last_login_at IS NULL OR u.last_login_at < ?", since)
+}
+
+// writeAdminUsers answers with the users matching where, by id.
+func writeAdminUsers(w http.ResponseWriter, r *http.Request, where string, args ...interface{}) {
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT u.id, u.username, u.is_admin, u.last_login_at, COUNT(n.id)
+		FROM users u LEFT JOIN notes n ON n.user_id = u.id
+		`+where+`
+		GROUP BY u.id, u.username, u.is_admin, u.last_login_at
+		ORDER BY u.id`, args...)
+	if err != nil {
+		requestLog(r).Error("adminUsers query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	users := []AdminUser{}
+	for rows.Next() {
+		var u AdminUser
+		var lastLogin sql.NullTime
+		if err := rows.Scan(&u.ID, &u.Username, &u.IsAdmin, &lastLogin, &u.NoteCount); err != nil {
+			requestLog(r).Error("adminUsers scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		if lastLogin.Valid {
+			u.LastLoginAt = &lastLogin.Time
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(r).Error("adminUsers rows", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// adminDBStatsHandler reports the connection pool's state for tuning.
+func adminDBStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	s := db.Stats()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"max_open_connections": s.MaxOpenConnections,
+		"open_connections":     s.OpenConnections,
+		"in_use":               s.InUse,
+		"idle":                 s.Idle,
+		"wait_count":           s.WaitCount,
+		"wait_duration_ms":     s.WaitDuration.Milliseconds(),
+		"max_idle_closed":      s.MaxIdleClosed,
+		"max_idle_time_closed": s.MaxIdleTimeClosed,
+		"max_lifetime_closed":  s.MaxLifetimeClosed,
+	})
+}
+
+// adminNoteAuditHandler returns the creation audit fields of any user's note.
+func adminNoteAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	var na NoteAudit
+	var ip, ua sql.NullString
+	err := db.QueryRowContext(r.Context(),
+		`SELECT id, user_id, created_ip, created_user_agent, created_at FROM notes WHERE id = ?`, id,
+	).Scan(&na.NoteID, &na.UserID, &ip, &ua, &na.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgNoteNotFound)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("adminNoteAudit query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	if ip.Valid {
+		na.IP = &ip.String
+	}
+	if ua.Valid {
+		na.UserAgent = &ua.String
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(na)
+}
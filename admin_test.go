@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdminRoutesNeedAdmin(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	other := c.newClient()
+	other.login("bob")
+
+	resp := c.do("GET", "/admin/users", nil)
+	wantStatus(t, resp, http.StatusOK)
+	var users []AdminUser
+	decodeBody(t, resp, &users)
+	if len(users) != 2 || !users[0].IsAdmin || users[1].IsAdmin {
+		t.Fatalf("users = %+v, want only the first admin", users)
+	}
+	wantStatus(t, other.do("GET", "/admin/users", nil), http.StatusForbidden)
+}
+
+func TestAdminMiddlewareMemStore(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	other := c.newClient()
+	other.login("bob")
+
+	for _, path := range []string{"/admin/users", "/admin/db-stats", "/admin/notes/1/audit"} {
+		wantStatus(t, other.do("GET", path, nil), http.StatusForbidden)
+	}
+}
+
+// TestFirstUserAdminRace registers a crowd of users at once on an empty
+// table; exactly one of them may come out an admin.
+func TestFirstUserAdminRace(t *testing.T) {
+	a := newDBApp(t)
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.users.Create(t.Context(), fmt.Sprintf("user%d", i), "hash")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var admins int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin").Scan(&admins); err != nil {
+		t.Fatal(err)
+	}
+	if admins != 1 {
+		t.Fatalf("%d admins, want 1", admins)
+	}
+}
+
+func TestAdminDBStats(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	if db == nil {
+		// sql.Open doesn't connect, and the pool's stats need no server.
+		d, err := sql.Open("mysql", "test@tcp(127.0.0.1:1)/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db = d
+		t.Cleanup(func() { d.Close(); db = nil })
+	}
+	c := newTestClient(t, a.routes())
+	wantStatus(t, c.do("GET", "/admin/db-stats", nil), http.StatusUnauthorized)
+	c.login("alice") // the first account is the admin
+	other := c.newClient()
+	other.login("bob")
+
+	resp := c.do("GET", "/admin/db-stats", nil)
+	wantStatus(t, resp, http.StatusOK)
+	var stats map[string]json.Number
+	decodeBody(t, resp, &stats)
+	for _, field := range []string{"max_open_connections", "open_connections", "in_use", "idle", "wait_count", "wait_duration_ms"} {
+		if _, ok := stats[field]; !ok {
+			t.Errorf("db-stats lacks %s: %v", field, stats)
+		}
+	}
+	wantStatus(t, other.do("GET", "/admin/db-stats", nil), http.StatusForbidden)
+	wantStatus(t, c.do("POST", "/admin/db-stats", nil), http.StatusMethodNotAllowed)
+}
+
+func TestAdminInactiveUsers(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	bob := c.newClient()
+	bobID := bob.login("bob")
+	// carol signed up before logins were recorded, or never logged in.
+	carol, err := a.users.Create(t.Context(), "carol", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE users SET last_login_at = ? WHERE id = ?", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), bobID); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := c.do("GET", "/admin/users", nil)
+	wantStatus(t, resp, http.StatusOK)
+	var users []AdminUser
+	decodeBody(t, resp, &users)
+	if len(users) != 3 || users[0].LastLoginAt == nil || !users[0].LastLoginAt.After(*users[1].LastLoginAt) || users[2].LastLoginAt != nil {
+		t.Fatalf("users = %+v, want alice just logged in and carol never", users)
+	}
+
+	inactive := func(since string) []int {
+		t.Helper()
+		resp := c.do("GET", "/admin/users/inactive?since="+url.QueryEscape(since), nil)
+		wantStatus(t, resp, http.StatusOK)
+		var users []AdminUser
+		decodeBody(t, resp, &users)
+		var ids []int
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+		return ids
+	}
+	for since, want := range map[string][]int{
+		"2024-01-01":                {carol.ID},
+		"2024-03-01T12:00:00Z":      {carol.ID}, // not before since itself
+		"2024-03-01T12:00:01Z":      {bobID, carol.ID},
+		"2024-06-01":                {bobID, carol.ID},
+		"2024-06-01T00:00:00+02:00": {bobID, carol.ID},
+	} {
+		if got := inactive(since); !slices.Equal(got, want) {
+			t.Errorf("since=%s: %v, want %v", since, got, want)
+		}
+	}
+	if got := inactive(time.Now().Add(time.Hour).Format(time.RFC3339)); len(got) != 3 {
+		t.Errorf("since an hour from now: %v, want everyone", got)
+	}
+	wantStatus(t, bob.do("GET", "/admin/users/inactive?since=2024-01-01", nil), http.StatusForbidden)
+}
+
+func TestAdminInactiveUsersValidation(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	for _, q := range []string{"", "?since=", "?since=yesterday", "?since=2024-13-01", "?since=2024-01-01T00:00"} {
+		wantStatus(t, c.do("GET", "/admin/users/inactive"+q, nil), http.StatusBadRequest)
+	}
+	wantStatus(t, c.do("POST", "/admin/users/inactive?since=2024-01-01", nil), http.StatusMethodNotAllowed)
+}
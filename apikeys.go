@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIKey is a credential for scripts, sent in the X-API-Key header. Only its
+// SHA-256 is stored; the key itself is returned once, on creation.
+type APIKey struct {
+	ID        int       `json:"id"`
+	Prefix    string    `json:"prefix"`
+	CreatedAt time.Time `json:"created_at"`
+	Key       string    `json:"key,omitempty"`
+}
+
+// MarshalJSON emits CreatedAt in UTC, like Note.
+func (k APIKey) MarshalJSON() ([]byte, error) {
+	type plain APIKey
+	p := plain(k)
+	p.CreatedAt = p.CreatedAt.UTC()
+	return json.Marshal(p)
+}
+
+// apiKeyPrefixLen is how much of a key is kept in clear so users can tell
+// their keys apart.
+const apiKeyPrefixLen = 8
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyUser returns the owner of key, or sql.ErrNoRows if it isn't a live
+// key. Keys are 256 random bits, so a plain SHA-256 lookup is enough.
+func apiKeyUser(ctx context.Context, key string) (int, error) {
+	var userID int
+	err := db.QueryRowContext(ctx, `SELECT user_id FROM api_keys WHERE key_hash = ?`, hashAPIKey(key)).Scan(&userID)
+	return userID, err
+}
+
+func apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listAPIKeysHandler(w, r)
+	case http.MethodPost:
+		createAPIKeyHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func apiKeyItemHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		deleteAPIKeyHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodDelete)
+	}
+}
+
+func listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	rows, err := db.QueryContext(r.Context(), `SELECT id, prefix, created_at FROM api_keys WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		requestLog(r).Error("listAPIKeys query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.Prefix, &k.CreatedAt); err != nil {
+			requestLog(r).Error("listAPIKeys scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		keys = append(keys, k)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		requestLog(r).Error("createAPIKey generate", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	key := hex.EncodeToString(b)
+	k := APIKey{Prefix: key[:apiKeyPrefixLen], CreatedAt: time.Now(), Key: key}
+
+	id64, err := insertID(r.Context(), db,
+		`INSERT INTO api_keys (user_id, key_hash, prefix) VALUES (?, ?, ?)`,
+		userID, hashAPIKey(key), k.Prefix,
+	)
+	if err != nil {
+		requestLog(r).Error("createAPIKey insert", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	k.ID = int(id64)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api-keys/"+strconv.Itoa(k.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(k)
+}
+
+func deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), `DELETE FROM api_keys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		requestLog(r).Error("deleteAPIKey delete", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	aff, _ := res.RowsAffected()
+	if aff == 0 {
+		writeJSONError(w, http.StatusNotFound, msgAPIKeyNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticateAPIKey resolves an X-API-Key header for authMiddleware,
+// writing the 401 itself when the key is unknown.
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, key string) (int, bool) {
+	userID, err := apiKeyUser(r.Context(), key)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusUnauthorized, msgInvalidAPIKey)
+		return 0, false
+	}
+	if err != nil {
+		requestLog(r).Error("auth API key", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return 0, false
+	}
+	return userID, true
+}
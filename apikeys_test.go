@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "scripted"})
+
+	resp := c.do("POST", "/api-keys", nil)
+	wantStatus(t, resp, http.StatusCreated)
+	var key APIKey
+	decodeBody(t, resp, &key)
+	if len(key.Key) != 64 || !strings.HasPrefix(key.Key, key.Prefix) || len(key.Prefix) != apiKeyPrefixLen {
+		t.Fatalf("key = %+v", key)
+	}
+
+	// The key works without a session; the stored hash never leaks back.
+	script := c.newClient()
+	resp = script.do("GET", fmt.Sprintf("/notes/%d", note.ID), nil, "X-API-Key", key.Key)
+	wantStatus(t, resp, http.StatusOK)
+	resp = c.do("GET", "/api-keys", nil)
+	wantStatus(t, resp, http.StatusOK)
+	body := readBody(t, resp)
+	if strings.Contains(body, key.Key) || strings.Contains(body, hashAPIKey(key.Key)) {
+		t.Fatalf("key list leaks the key: %s", body)
+	}
+
+	wantStatus(t, script.do("GET", "/notes", nil, "X-API-Key", "not-a-key"), http.StatusUnauthorized)
+
+	bob := c.newClient()
+	bob.login("bob")
+	wantStatus(t, bob.do("DELETE", fmt.Sprintf("/api-keys/%d", key.ID), nil), http.StatusNotFound)
+
+	// Revoking takes effect at once.
+	wantStatus(t, c.do("DELETE", fmt.Sprintf("/api-keys/%d", key.ID), nil), http.StatusNoContent)
+	wantStatus(t, script.do("GET", fmt.Sprintf("/notes/%d", note.ID), nil, "X-API-Key", key.Key), http.StatusUnauthorized)
+}
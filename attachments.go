@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type Attachment struct {
+	ID          int       `json:"id"`
+	NoteID      int       `json:"note_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// MarshalJSON emits CreatedAt in UTC, like Note.
+func (a Attachment) MarshalJSON() ([]byte, error) {
+	type plain Attachment
+	p := plain(a)
+	p.CreatedAt = p.CreatedAt.UTC()
+	return json.Marshal(p)
+}
+
+// maxFilenameLen is the length of attachments.filename, in characters.
+const maxFilenameLen = 255
+
+// attachmentTypes is the allowlist of sniffed content types accepted for upload.
+var attachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+func (a *app) attachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listAttachmentsHandler(w, r)
+	case http.MethodPost:
+		a.uploadAttachmentHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (a *app) attachmentItemHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		a.deleteAttachmentHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodDelete)
+	}
+}
+
+// ownedNoteParam parses {id} and confirms the note belongs to the current
+// user, writing the error response when it doesn't.
+func ownedNoteParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return 0, false
+	}
+	if _, err := fetchNote(r.Context(), userID, id); errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+		return 0, false
+	} else if err != nil {
+		requestLog(r).Error("fetch note", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return 0, false
+	}
+	return id, true
+}
+
+func listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, ok := ownedNoteParam(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT id, note_id, filename, content_type, size, created_at FROM attachments WHERE note_id = ? ORDER BY id`,
+		noteID,
+	)
+	if err != nil {
+		requestLog(r).Error("listAttachments query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.NoteID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+			requestLog(r).Error("listAttachments scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		attachments = append(attachments, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// uploadAttachmentHandler accepts a multipart form with a single "file" part.
+// The content type is sniffed from the bytes rather than trusted from the
+// client. Files go in cfg.UploadDir and are capped at cfg.MaxUploadBytes.
+func (a *app) uploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, ok := ownedNoteParam(w, r)
+	if !ok {
+		return
+	}
+
+	// Leave headroom for the multipart envelope around the file itself.
+	r.Body = http.MaxBytesReader(w, r.Body, a.cfg.MaxUploadBytes+64<<10)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, msgBodyTooLarge)
+			return
+		}
+		http.Error(w, "multipart form with a file field is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	if header.Size > a.cfg.MaxUploadBytes {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, msgBodyTooLarge)
+		return
+	}
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		http.Error(w, "could not read file", http.StatusBadRequest)
+		return
+	}
+	contentType := http.DetectContentType(sniff[:n])
+	if !attachmentTypes[contentType] {
+		http.Error(w, "unsupported attachment type "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		requestLog(r).Error("uploadAttachment seek", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		requestLog(r).Error("uploadAttachment name", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	storedName := hex.EncodeToString(b)
+	path := filepath.Join(a.cfg.UploadDir, storedName)
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		requestLog(r).Error("uploadAttachment create", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	size, err := io.Copy(out, file)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		requestLog(r).Error("uploadAttachment write", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	filename := truncateRunes(filepath.Base(header.Filename), maxFilenameLen)
+	id64, err := insertID(r.Context(), db,
+		`INSERT INTO attachments (note_id, filename, stored_name, content_type, size) VALUES (?, ?, ?, ?, ?)`,
+		noteID, filename, storedName, contentType, size,
+	)
+	if err != nil {
+		os.Remove(path)
+		requestLog(r).Error("uploadAttachment insert", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/notes/"+strconv.Itoa(noteID)+"/attachments/"+strconv.FormatInt(id64, 10))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Attachment{
+		ID:          int(id64),
+		NoteID:      noteID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		CreatedAt:   time.Now(),
+	})
+}
+
+func (a *app) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, ok := ownedNoteParam(w, r)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.Atoi(r.PathValue("attachmentID"))
+	if err != nil || attachmentID <= 0 {
+		writeJSONError(w, http.StatusBadRequest, msgInvalidID)
+		return
+	}
+
+	var storedName string
+	err = db.QueryRowContext(r.Context(), `SELECT stored_name FROM attachments WHERE id = ? AND note_id = ?`, attachmentID, noteID).Scan(&storedName)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgAttachmentNotFound)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("deleteAttachment query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	if _, err := db.ExecContext(r.Context(), `DELETE FROM attachments WHERE id = ? AND note_id = ?`, attachmentID, noteID); err != nil {
+		requestLog(r).Error("deleteAttachment delete", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	a.removeAttachmentFiles([]string{storedName})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// attachmentFiles returns the stored file names of a note's attachments.
+func attachmentFiles(ctx context.Context, noteID int) ([]string, error) {
+	return storedNames(ctx, `SELECT stored_name FROM attachments WHERE note_id = ?`, noteID)
+}
+
+// userAttachmentFiles returns the stored file names of all of a user's
+// attachments.
+func userAttachmentFiles(ctx context.Context, userID int) ([]string, error) {
+	return storedNames(ctx,
+		`SELECT a.stored_name FROM attachments a JOIN notes n ON n.id = a.note_id WHERE n.user_id = ?`,
+		userID,
+	)
+}
+
+func storedNames(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// removeAttachmentFiles deletes stored files from cfg.UploadDir, logging
+// rather than failing since their rows are already gone.
+func (a *app) removeAttachmentFiles(names []string) {
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(a.cfg.UploadDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("remove attachment file", "err", err)
+		}
+	}
+}
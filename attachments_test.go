@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// pngBytes sniffs as image/png.
+var pngBytes = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+
+// upload posts content as the "file" part of a multipart form.
+func (c *testClient) upload(path, filename string, content []byte) *http.Response {
+	c.t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	part.Write(content)
+	mw.Close()
+	resp, err := c.client.Post(c.srv.URL+path, mw.FormDataContentType(), &buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// uploadedFiles counts the files in a's upload directory.
+func uploadedFiles(t *testing.T, a *app) int {
+	t.Helper()
+	entries, err := os.ReadDir(a.cfg.UploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestAttachments(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "with files"})
+	path := fmt.Sprintf("/notes/%d/attachments", note.ID)
+
+	resp := c.upload(path, "../../etc/chart.png", pngBytes)
+	wantStatus(t, resp, http.StatusCreated)
+	var att Attachment
+	decodeBody(t, resp, &att)
+	if att.Filename != "chart.png" || att.ContentType != "image/png" || att.Size != int64(len(pngBytes)) {
+		t.Fatalf("attachment = %+v", att)
+	}
+	if n := uploadedFiles(t, a); n != 1 {
+		t.Fatalf("%d files stored, want 1", n)
+	}
+
+	// The content decides the type, not the name.
+	wantStatus(t, c.upload(path, "evil.png", []byte("<script>alert(1)</script>")), http.StatusUnsupportedMediaType)
+
+	old := a.cfg.MaxUploadBytes
+	a.cfg.MaxUploadBytes = 50
+	if msg := wantJSONError(t, c.upload(path, "big.png", pngBytes), http.StatusRequestEntityTooLarge); msg != "request body too large" {
+		t.Errorf("too large: error %q", msg)
+	}
+	a.cfg.MaxUploadBytes = old
+
+	resp = c.do("GET", path, nil)
+	wantStatus(t, resp, http.StatusOK)
+	var list []Attachment
+	decodeBody(t, resp, &list)
+	if len(list) != 1 || list[0].ID != att.ID {
+		t.Fatalf("attachments = %+v", list)
+	}
+
+	bob := c.newClient()
+	bob.login("bob")
+	wantStatus(t, bob.do("GET", path, nil), http.StatusNotFound)
+	wantStatus(t, bob.upload(path, "x.png", pngBytes), http.StatusNotFound)
+
+	if msg := wantJSONError(t, c.do("DELETE", path+"/abc", nil), http.StatusBadRequest); msg != "invalid id" {
+		t.Errorf("bad attachment id: error %q", msg)
+	}
+	wantStatus(t, c.do("DELETE", fmt.Sprintf("%s/%d", path, att.ID), nil), http.StatusNoContent)
+	if n := uploadedFiles(t, a); n != 0 {
+		t.Fatalf("%d files left after deleting the attachment", n)
+	}
+
+	// Deleting the note takes its files along.
+	wantStatus(t, c.upload(path, "again.png", pngBytes), http.StatusCreated)
+	wantStatus(t, c.do("DELETE", fmt.Sprintf("/notes/%d", note.ID), nil), http.StatusNoContent)
+	if n := uploadedFiles(t, a); n != 0 {
+		t.Fatalf("%d files left after deleting the note", n)
+	}
+}
+
+// TestAttachmentLongFilename uploads a name longer than the column in
+// multi-byte characters; it's cut to maxFilenameLen characters, whole.
+func TestAttachmentLongFilename(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "with files"})
+
+	name := strings.Repeat("写真", 200) + ".png" // 404 characters, 1204 bytes
+	resp := c.upload(fmt.Sprintf("/notes/%d/attachments", note.ID), name, pngBytes)
+	wantStatus(t, resp, http.StatusCreated)
+	var att Attachment
+	decodeBody(t, resp, &att)
+	if n := utf8.RuneCountInString(att.Filename); n != maxFilenameLen || !utf8.ValidString(att.Filename) || !strings.HasPrefix(name, att.Filename) {
+		t.Fatalf("filename %q: %d characters, want the first %d", att.Filename, n, maxFilenameLen)
+	}
+}
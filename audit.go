@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// maxUserAgentLen matches the created_user_agent column.
+const maxUserAgentLen = 255
+
+var (
+	// trustedProxies are the networks whose forwarding headers clientIP
+	// believes (TRUSTED_PROXIES).
+	trustedProxies []netip.Prefix
+
+	// trustProxy trusts the direct peer whatever its address (TRUST_PROXY),
+	// for a single proxy whose address isn't known in advance. Only enable
+	// it when every request arrives through such a proxy.
+	trustProxy bool
+)
+
+// parseTrustedProxies reads a comma-separated list of CIDRs; a bare
+// address stands for just itself.
+func parseTrustedProxies(v string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", s)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", s)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// isTrustedProxy reports whether addr is in trustedProxies.
+func isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address a request came from. Forwarding headers are
+// only believed when the direct peer is a trusted proxy. X-Forwarded-For is
+// then read from the right, where each proxy appended the address it saw,
+// skipping trusted proxies until the first address that isn't one: anything
+// further left came from the client and could be made up. Without
+// X-Forwarded-For, a trusted peer's X-Real-IP is used.
+func clientIP(r *http.Request) string {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+	ip := peer.Addr().Unmap()
+	if !trustProxy && !isTrustedProxy(ip) {
+		return ip.String()
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	if len(hops) == 0 {
+		if real, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return real.Unmap().String()
+		}
+		return ip.String()
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A garbled entry ends what can be relied on; the last
+			// proxy that was trusted is the best answer left.
+			break
+		}
+		ip = hop.Unmap()
+		if !isTrustedProxy(ip) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// truncateRunes shortens s to at most n characters, for columns such as
+// VARCHAR(255) whose length counts characters rather than bytes.
+func truncateRunes(s string, n int) string {
+	i := 0
+	for at := range s {
+		if i == n {
+			return s[:at]
+		}
+		i++
+	}
+	return s
+}
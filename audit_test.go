@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useTrustProxy sets trustProxy for the rest of the test.
+func useTrustProxy(t *testing.T, on bool) {
+	old := trustProxy
+	t.Cleanup(func() { trustProxy = old })
+	trustProxy = on
+}
+
+func TestClientIPTrustProxy(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		trust       bool
+		xff, realIP string
+		want        string
+	}{
+		{"no proxy", false, "", "", "192.0.2.1"},
+		{"untrusted XFF is ignored", false, "203.0.113.9", "", "192.0.2.1"},
+		{"untrusted X-Real-IP is ignored", false, "", "203.0.113.9", "192.0.2.1"},
+		{"trusted XFF", true, "203.0.113.9", "", "203.0.113.9"},
+		{"trusted XFF takes the proxy's hop", true, "10.9.9.9, 203.0.113.9", "", "203.0.113.9"},
+		{"trusted X-Real-IP", true, "", "203.0.113.9", "203.0.113.9"},
+		{"garbled XFF", true, "not-an-ip", "", "192.0.2.1"},
+	} {
+		useTrustProxy(t, tc.trust)
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "192.0.2.1:4711"
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.realIP != "" {
+			r.Header.Set("X-Real-IP", tc.realIP)
+		}
+		if got := clientIP(r); got != tc.want {
+			t.Errorf("%s: clientIP = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// useTrustedProxies sets trustedProxies from a TRUSTED_PROXIES value for
+// the rest of the test.
+func useTrustedProxies(t *testing.T, v string) {
+	t.Helper()
+	prefixes, err := parseTrustedProxies(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := trustedProxies
+	t.Cleanup(func() { trustedProxies = old })
+	trustedProxies = prefixes
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := parseTrustedProxies(" 10.0.0.0/8, 192.0.2.1,,2001:db8::/32 , 172.16.5.4/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::/32", "172.16.0.0/12"}
+	if fmt.Sprint(prefixes) != fmt.Sprint(want) {
+		t.Fatalf("prefixes = %v, want %v", prefixes, want)
+	}
+	if p, err := parseTrustedProxies(""); err != nil || len(p) != 0 {
+		t.Errorf("empty: %v, %v", p, err)
+	}
+	for _, v := range []string{"10.0.0.0/99", "proxy.local", "10.0.0.1, 300.1.1.1"} {
+		if _, err := parseTrustedProxies(v); err == nil {
+			t.Errorf("%q accepted", v)
+		}
+	}
+}
+
+func TestClientIPTrustedProxies(t *testing.T) {
+	useTrustProxy(t, false)
+	useTrustedProxies(t, "10.0.0.0/8, 192.0.2.1, 2001:db8::/32")
+	for _, tc := range []struct {
+		name, peer, xff, realIP, want string
+	}{
+		{"untrusted peer", "198.51.100.7:1", "203.0.113.9", "203.0.113.8", "198.51.100.7"},
+		{"trusted peer, one hop", "10.1.2.3:1", "203.0.113.9", "", "203.0.113.9"},
+		{"multi-hop skips trusted proxies", "10.1.2.3:1", "203.0.113.9, 10.7.7.7, 192.0.2.1", "", "203.0.113.9"},
+		{"spoofed left-most entry is ignored", "10.1.2.3:1", "1.1.1.1, 203.0.113.9, 10.7.7.7", "", "203.0.113.9"},
+		{"trusted peer, no headers", "10.1.2.3:1", "", "", "10.1.2.3"},
+		{"all hops trusted", "10.1.2.3:1", "10.0.0.5, 192.0.2.1", "", "10.0.0.5"},
+		{"garbled hop stops the walk", "10.1.2.3:1", "203.0.113.9, junk, 10.7.7.7", "", "10.7.7.7"},
+		{"X-Real-IP without XFF", "192.0.2.1:1", "", "203.0.113.9", "203.0.113.9"},
+		{"XFF wins over X-Real-IP", "192.0.2.1:1", "203.0.113.9", "198.51.100.1", "203.0.113.9"},
+		{"IPv6 proxy", "[2001:db8::1]:1", "203.0.113.9", "", "203.0.113.9"},
+		{"IPv4-mapped peer", "[::ffff:10.1.2.3]:1", "203.0.113.9", "", "203.0.113.9"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.peer
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.realIP != "" {
+			r.Header.Set("X-Real-IP", tc.realIP)
+		}
+		if got := clientIP(r); got != tc.want {
+			t.Errorf("%s: clientIP = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	// Each proxy may add its own X-Forwarded-For line.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.1.2.3:1"
+	r.Header.Add("X-Forwarded-For", "203.0.113.9")
+	r.Header.Add("X-Forwarded-For", "10.7.7.7")
+	if got := clientIP(r); got != "203.0.113.9" {
+		t.Errorf("two header lines: clientIP = %q", got)
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"curl/8.0", 255, "curl/8.0"},
+		{"abcdef", 3, "abc"},
+		{"aé", 2, "a"}, // é is two bytes; half of it is dropped
+		{"日本", 4, "日"},
+	} {
+		if got := truncateUTF8(tc.s, tc.n); got != tc.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"chart.png", 255, "chart.png"},
+		{"abcdef", 3, "abc"},
+		{"日本語", 2, "日本"}, // counted in characters, not bytes
+		{"日本語", 3, "日本語"},
+		{"😀😀", 1, "😀"},
+		{"", 5, ""},
+	} {
+		if got := truncateRunes(tc.s, tc.n); got != tc.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestNoteCreationAudit(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	id := c.login("alice")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+	useTrustProxy(t, true)
+	longUA := strings.Repeat("u", maxUserAgentLen+10)
+	resp := c.do("POST", "/notes", map[string]string{"title": "audited"},
+		"X-Forwarded-For", "203.0.113.9", "User-Agent", longUA)
+	wantStatus(t, resp, http.StatusCreated)
+	var n Note
+	decodeBody(t, resp, &n)
+
+	// The audit fields stay out of the normal API...
+	resp = c.do("GET", fmt.Sprintf("/notes/%d", n.ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); strings.Contains(body, "203.0.113.9") || strings.Contains(body, "created_ip") {
+		t.Errorf("note exposes its audit fields: %s", body)
+	}
+
+	// ...and are only visible to admins.
+	resp = c.do("GET", fmt.Sprintf("/admin/notes/%d/audit", n.ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	var na NoteAudit
+	decodeBody(t, resp, &na)
+	if na.IP == nil || *na.IP != "203.0.113.9" {
+		t.Errorf("created_ip = %v, want 203.0.113.9", na.IP)
+	}
+	if na.UserAgent == nil || len(*na.UserAgent) != maxUserAgentLen {
+		t.Errorf("created_user_agent not truncated to %d bytes", maxUserAgentLen)
+	}
+	wantStatus(t, c.do("GET", "/admin/notes/999999/audit", nil), http.StatusNotFound)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	maxUsernameLen = 255
+	minPasswordLen = 8
+	// maxPasswordLen is bcrypt's input limit; it rejects anything longer.
+	maxPasswordLen = 72
+)
+
+// comparePassword checks a login's password against a stored hash; tests
+// swap it to see which hashes a login was checked against.
+var comparePassword = bcrypt.CompareHashAndPassword
+
+func (a *app) registerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var body struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	username := normalizeUsername(body.Username)
+	var verr ValidationError
+	if username == "" {
+		verr.Add("username", "required")
+	} else if len(username) > maxUsernameLen {
+		verr.Add("username", "too long")
+	}
+	if len(body.Password) < minPasswordLen {
+		verr.Add("password", "too short")
+	} else if len(body.Password) > maxPasswordLen {
+		verr.Add("password", "too long")
+	}
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), a.cfg.BcryptCost)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	_, err = a.users.Create(r.Context(), username, string(hashedPassword))
+	if errors.Is(err, errUsernameTaken) {
+		writeJSONError(w, http.StatusConflict, msgUsernameTaken)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("register create", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *app) loginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var body struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	username := normalizeUsername(body.Username)
+	if loginLocked(w, r, username) {
+		return
+	}
+
+	u, err := a.users.GetByUsername(r.Context(), username)
+	if err != nil {
+		// Spend the same bcrypt time as a wrong password so response
+		// timing doesn't reveal which usernames exist.
+		comparePassword(a.dummyHash, []byte(body.Password))
+		loginFailed(r, username)
+		writeJSONError(w, http.StatusUnauthorized, msgInvalidCredentials)
+		return
+	}
+
+	if err := comparePassword([]byte(u.Password), []byte(body.Password)); err != nil {
+		loginFailed(r, username)
+		writeJSONError(w, http.StatusUnauthorized, msgInvalidCredentials)
+		return
+	}
+	if loginGuard != nil {
+		if err := loginGuard.Succeed(r.Context(), username); err != nil {
+			requestLog(r).Error("login reset failures", "err", err)
+		}
+	}
+
+	token, err := sessions.Create(u.ID, a.cfg.SessionTTL)
+	if errors.Is(err, errTooManySessions) {
+		writeJSONError(w, http.StatusConflict, msgTooManySessions)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("login session", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    token,
+		Expires:  time.Now().Add(a.cfg.SessionTTL),
+		HttpOnly: true,
+	})
+	if err := a.users.RecordLogin(r.Context(), u.ID); err != nil {
+		requestLog(r).Error("login record", "err", err)
+	}
+
+	// Same body as GET /me, so the client needn't ask who just logged in.
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie("session_token"); err == nil {
+		sessions.Delete(cookie.Value)
+	}
+	clearSessionCookie(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+// logoutAllHandler ends every session the user has, on every device, and
+// clears this one's cookie. API keys are left alone and must be revoked
+// separately.
+//
+// There is no per-user token version on the users row for authMiddleware
+// to check. Session tokens are opaque keys into the in-memory
+// SessionStore, not self-contained JWTs, so deleting them is enough to
+// make them useless. Like the store itself, this covers only the instance
+// that answers the request: a deployment running several instances behind
+// sticky sessions doesn't sign the user out of the others.
+func logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+	sessions.DeleteUser(userID)
+	clearSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clearSessionCookie expires the session cookie in the browser.
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    "",
+		Expires:  time.Now().Add(-1 * time.Hour),
+		HttpOnly: true,
+	})
+}
+
+func checkAuthHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("session_token")
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if _, ok := sessions.Get(cookie.Value); !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// failingUserStore fails every Create with err.
+type failingUserStore struct {
+	*memUserStore
+	err error
+}
+
+func (s failingUserStore) Create(ctx context.Context, username, passwordHash string) (User, error) {
+	return User{}, s.err
+}
+
+func TestRegisterStoreErrors(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{errUsernameTaken, http.StatusConflict},
+		// Anything else, say a lost connection, is the server's fault
+		// rather than a name clash.
+		{errors.New("driver: bad connection"), http.StatusInternalServerError},
+	} {
+		a, _, users := newMemApp(t)
+		a.users = failingUserStore{users, tc.err}
+		c := newTestClient(t, a.routes())
+		resp := c.do("POST", "/register", map[string]string{"username": "alice", "password": "correct horse battery"})
+		wantStatus(t, resp, tc.status)
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	for in, want := range map[string]string{"alice": "alice", "  Alice ": "alice", "ÄNNE": "änne"} {
+		if got := normalizeUsername(in); got != want {
+			t.Errorf("normalizeUsername(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestUsernamesCaseInsensitive(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	pw := "correct horse battery"
+
+	resp := c.do("POST", "/register", map[string]string{"username": "Alice", "password": pw})
+	wantStatus(t, resp, http.StatusCreated)
+	for _, name := range []string{"alice", " ALICE "} {
+		wantStatus(t, c.do("POST", "/register", map[string]string{"username": name, "password": pw}), http.StatusConflict)
+	}
+	resp = c.do("POST", "/login", map[string]string{"username": "aLiCe", "password": pw})
+	wantStatus(t, resp, http.StatusOK)
+	var u User
+	decodeBody(t, resp, &u)
+	if u.Username != "alice" {
+		t.Fatalf("username = %q, want it stored lower-case", u.Username)
+	}
+}
+
+// TestLegacyMixedCaseUsername covers accounts stored before usernames were
+// normalized.
+func TestLegacyMixedCaseUsername(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), a.cfg.BcryptCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO users (username, password) VALUES (?, ?)`, "Bob", string(hash)); err != nil {
+		t.Fatal(err)
+	}
+	creds := map[string]string{"username": "bob", "password": "correct horse battery"}
+	wantStatus(t, c.do("POST", "/register", creds), http.StatusConflict)
+	wantStatus(t, c.do("POST", "/login", creds), http.StatusOK)
+}
+
+func TestSessionTTL(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+
+	a.cfg.SessionTTL = 2 * time.Hour
+	c.login("alice")
+	cookie := loginCookie(t, c)
+	if d := time.Until(cookie.Expires); d < 2*time.Hour-time.Minute || d > 2*time.Hour+time.Minute {
+		t.Fatalf("cookie expires in %v, want about 2h", d)
+	}
+
+	// The server stops honouring the session once it expires, whatever
+	// the browser does with the cookie.
+	a.cfg.SessionTTL = 50 * time.Millisecond
+	cookie = loginCookie(t, c)
+	time.Sleep(100 * time.Millisecond)
+	// Sent by hand: the cookie jar would drop the expired cookie itself.
+	req, _ := http.NewRequest("GET", c.srv.URL+"/me", nil)
+	req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expired session: status %d, want 401", resp.StatusCode)
+	}
+}
+
+// loginCookie logs in as alice again and returns the new session cookie.
+func loginCookie(t *testing.T, c *testClient) *http.Cookie {
+	t.Helper()
+	resp := c.do("POST", "/login", map[string]string{"username": "alice", "password": "correct horse battery"})
+	wantStatus(t, resp, http.StatusOK)
+	for _, ck := range resp.Cookies() {
+		if ck.Name == "session_token" {
+			return ck
+		}
+	}
+	t.Fatal("no session cookie")
+	return nil
+}
+
+// TestLoginAlwaysComparesPassword checks an unknown username costs a bcrypt
+// comparison just like a wrong password, so timing can't tell them apart.
+func TestLoginAlwaysComparesPassword(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	var compared [][]byte
+	old := comparePassword
+	t.Cleanup(func() { comparePassword = old })
+	comparePassword = func(hash, password []byte) error {
+		compared = append(compared, hash)
+		return old(hash, password)
+	}
+
+	for _, name := range []string{"alice", "nobody"} {
+		compared = nil
+		resp := c.do("POST", "/login", map[string]string{"username": name, "password": "wrong password"})
+		wantStatus(t, resp, http.StatusUnauthorized)
+		if body := readBody(t, resp); !strings.Contains(body, "invalid credentials") {
+			t.Errorf("%s: body %q", name, body)
+		}
+		if len(compared) != 1 {
+			t.Fatalf("%s: %d password comparisons, want 1", name, len(compared))
+		}
+		if name == "nobody" && !bytes.Equal(compared[0], a.dummyHash) {
+			t.Errorf("unknown user compared against %q, want the dummy hash", compared[0])
+		}
+	}
+}
+
+func TestLoginReturnsUser(t *testing.T) {
+	a, _, users := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	pw := "correct horse battery"
+	wantStatus(t, c.do("POST", "/register", map[string]string{"username": "alice", "password": pw}), http.StatusCreated)
+	registered, err := users.GetByUsername(t.Context(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := c.do("POST", "/login", map[string]string{"username": "alice", "password": pw})
+	wantStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+	if !slices.ContainsFunc(resp.Cookies(), func(ck *http.Cookie) bool { return ck.Name == "session_token" && ck.HttpOnly }) {
+		t.Error("no HttpOnly session cookie")
+	}
+	body := readBody(t, resp)
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("body %q: %v", body, err)
+	}
+	if got["id"] != float64(registered.ID) || got["username"] != "alice" {
+		t.Fatalf("login body = %s, want alice's id %d", body, registered.ID)
+	}
+	if strings.Contains(body, "$2a$") || strings.Contains(body, "password") {
+		t.Fatalf("login body leaks the password hash: %s", body)
+	}
+
+	// It's the same as asking /me.
+	resp = c.do("GET", "/me", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if me := readBody(t, resp); strings.TrimSpace(me) != strings.TrimSpace(body) {
+		t.Errorf("/me = %s, login gave %s", me, body)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	laptop := loginCookie(t, c)
+	phone := loginCookie(t, c)
+	bob := c.newClient()
+	bob.login("bob")
+
+	// meWith asks /me with just the given session cookie.
+	meWith := func(ck *http.Cookie) int {
+		t.Helper()
+		req, _ := http.NewRequest("GET", c.srv.URL+"/me", nil)
+		req.AddCookie(&http.Cookie{Name: ck.Name, Value: ck.Value})
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if meWith(laptop) != http.StatusOK || meWith(phone) != http.StatusOK {
+		t.Fatal("sessions not valid before logout-all")
+	}
+
+	wantStatus(t, c.do("GET", "/logout-all", nil), http.StatusMethodNotAllowed)
+	resp := c.do("POST", "/logout-all", nil)
+	wantStatus(t, resp, http.StatusNoContent)
+	if !slices.ContainsFunc(resp.Cookies(), func(ck *http.Cookie) bool { return ck.Name == "session_token" && ck.Value == "" }) {
+		t.Error("session cookie not cleared")
+	}
+	for name, ck := range map[string]*http.Cookie{"laptop": laptop, "phone": phone} {
+		if code := meWith(ck); code != http.StatusUnauthorized {
+			t.Errorf("%s session after logout-all: status %d, want 401", name, code)
+		}
+	}
+	wantStatus(t, bob.do("GET", "/me", nil), http.StatusOK)
+
+	// A fresh login works as usual.
+	if code := meWith(loginCookie(t, c)); code != http.StatusOK {
+		t.Fatalf("new session: status %d", code)
+	}
+	wantStatus(t, c.do("POST", "/logout-all", nil), http.StatusNoContent)
+	wantStatus(t, c.do("POST", "/logout-all", nil), http.StatusUnauthorized)
+}
+
+// sessionValid reports whether the server still accepts cookie.
+func sessionValid(t *testing.T, c *testClient, cookie *http.Cookie) bool {
+	t.Helper()
+	req, _ := http.NewRequest("GET", c.srv.URL+"/me", nil)
+	req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func TestLoginSessionCap(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	sessions.Stop()
+	sessions = newSessionStore(time.Minute, 2, false)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	second := loginCookie(t, c)
+	third := loginCookie(t, c)
+	if !sessionValid(t, c, second) || !sessionValid(t, c, third) {
+		t.Fatal("the two newest sessions should both be live")
+	}
+	fourth := loginCookie(t, c)
+	if sessionValid(t, c, second) {
+		t.Fatal("oldest session survived a login over the cap")
+	}
+	if !sessionValid(t, c, third) || !sessionValid(t, c, fourth) {
+		t.Fatal("newer sessions were evicted")
+	}
+}
+
+func TestLoginSessionCapReject(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	sessions.Stop()
+	sessions = newSessionStore(time.Minute, 2, true)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	second := loginCookie(t, c)
+
+	resp := c.do("POST", "/login", map[string]string{"username": "alice", "password": "correct horse battery"})
+	wantJSONError(t, resp, http.StatusConflict)
+	if !sessionValid(t, c, second) {
+		t.Fatal("a refused login ended an existing session")
+	}
+
+	wantStatus(t, c.do("POST", "/logout", nil), http.StatusOK)
+	loginCookie(t, c)
+}
+
+func TestLoginRecordsLastLogin(t *testing.T) {
+	a, _, users := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	before := time.Now()
+	id := c.login("alice")
+	users.mu.Lock()
+	first, ok := users.logins[id]
+	users.mu.Unlock()
+	if !ok || first.Before(before) || time.Since(first) > time.Minute {
+		t.Fatalf("last login = %v (%v), want stamped by the login", first, ok)
+	}
+
+	// A failed login leaves it alone; the next good one moves it on.
+	wantStatus(t, c.do("POST", "/login", map[string]string{"username": "alice", "password": "wrong password"}), http.StatusUnauthorized)
+	users.mu.Lock()
+	unchanged := users.logins[id]
+	users.mu.Unlock()
+	if !unchanged.Equal(first) {
+		t.Fatalf("failed login moved last login to %v", unchanged)
+	}
+	time.Sleep(time.Millisecond)
+	loginCookie(t, c)
+	users.mu.Lock()
+	second := users.logins[id]
+	users.mu.Unlock()
+	if !second.After(first) {
+		t.Fatalf("last login %v not after %v", second, first)
+	}
+}
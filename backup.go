@@ -0,0 +1,227 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A backup is a zip with these entries:
+//
+//	notes.json        every note the user owns, as GET /notes/export returns them
+//	notebooks.json    the user's notebooks
+//	attachments.json  attachment metadata, each with the path of its file
+//	attachments/...   the attachment files themselves
+const (
+	backupNotesFile       = "notes.json"
+	backupNotebooksFile   = "notebooks.json"
+	backupAttachmentsFile = "attachments.json"
+	backupAttachmentsDir  = "attachments/"
+)
+
+// backupAttachment is an attachment's entry in attachments.json. Path is
+// where its file sits in the archive.
+type backupAttachment struct {
+	ID          int       `json:"id"`
+	NoteID      int       `json:"note_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	Path        string    `json:"path"`
+
+	storedName string
+}
+
+// backupHandler streams the user's whole account as a zip. The rows are
+// read in one repeatable-read transaction so the notes, notebooks and
+// attachments agree with each other even while the user keeps editing; the
+// transaction is closed before the attachment files are copied in.
+func (a *app) backupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+
+	tx, err := db.BeginTx(r.Context(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		requestLog(r).Error("backup begin", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer tx.Rollback()
+
+	// Read everything but the notes before writing anything, so a failure
+	// can still be answered with a 500.
+	notebooks := []Notebook{}
+	rows, err := tx.QueryContext(r.Context(), `SELECT id, user_id, name FROM notebooks WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		requestLog(r).Error("backup notebooks", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	for rows.Next() {
+		var nb Notebook
+		if err := rows.Scan(&nb.ID, &nb.UserID, &nb.Name); err != nil {
+			rows.Close()
+			requestLog(r).Error("backup notebooks scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		notebooks = append(notebooks, nb)
+	}
+	rows.Close()
+
+	attachments := []backupAttachment{}
+	rows, err = tx.QueryContext(r.Context(),
+		`SELECT a.id, a.note_id, a.filename, a.content_type, a.size, a.created_at, a.stored_name
+		 FROM attachments a JOIN notes n ON n.id = a.note_id WHERE n.user_id = ? ORDER BY a.id`,
+		userID,
+	)
+	if err != nil {
+		requestLog(r).Error("backup attachments", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	for rows.Next() {
+		var att backupAttachment
+		if err := rows.Scan(&att.ID, &att.NoteID, &att.Filename, &att.ContentType, &att.Size, &att.CreatedAt, &att.storedName); err != nil {
+			rows.Close()
+			requestLog(r).Error("backup attachments scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		att.CreatedAt = att.CreatedAt.UTC()
+		att.Path = backupAttachmentsDir + strconv.Itoa(att.ID) + "/" + zipSafeName(att.Filename)
+		attachments = append(attachments, att)
+	}
+	rows.Close()
+
+	notes, err := tx.QueryContext(r.Context(), `SELECT `+noteColumns+` FROM notes WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		requestLog(r).Error("backup notes", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer notes.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="notes-backup-`+time.Now().UTC().Format("20060102")+`.zip"`)
+
+	// As with exports, once the zip has started a failure can only be
+	// logged; the client is left with an archive missing its central
+	// directory, which no unzip tool will accept.
+	rc := http.NewResponseController(w)
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create(backupNotesFile)
+	if err != nil {
+		requestLog(r).Error("backup write", "err", err)
+		return
+	}
+	f.Write([]byte("["))
+	n := 0
+	for notes.Next() {
+		note, err := scanNote(notes)
+		if err != nil {
+			requestLog(r).Error("backup notes scan", "err", err)
+			return
+		}
+		if err := writeExportJSON(f, note, n == 0); err != nil {
+			requestLog(r).Error("backup write", "err", err)
+			return
+		}
+		n++
+	}
+	if err := notes.Err(); err != nil {
+		requestLog(r).Error("backup notes rows", "err", err)
+		return
+	}
+	f.Write([]byte("]\n"))
+	notes.Close()
+	tx.Rollback()
+
+	if err := writeZipJSON(zw, backupNotebooksFile, notebooks); err != nil {
+		requestLog(r).Error("backup write", "err", err)
+		return
+	}
+
+	written := []backupAttachment{}
+	for _, att := range attachments {
+		// Keep a large backup that is still making progress from hitting
+		// the server's write timeout.
+		if serverTimeouts.Write > 0 {
+			rc.SetWriteDeadline(time.Now().Add(serverTimeouts.Write))
+		}
+		err := copyAttachmentToZip(zw, a.cfg.UploadDir, att)
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted since the rows were read; leave it out of the
+			// manifest too.
+			requestLog(r).Warn("backup attachment file gone", "attachment_id", att.ID)
+			continue
+		}
+		if err != nil {
+			requestLog(r).Error("backup attachment file", "err", err, "attachment_id", att.ID)
+			return
+		}
+		written = append(written, att)
+	}
+
+	if err := writeZipJSON(zw, backupAttachmentsFile, written); err != nil {
+		requestLog(r).Error("backup write", "err", err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		requestLog(r).Error("backup write", "err", err)
+	}
+}
+
+// writeZipJSON adds v to the archive as a JSON file called name.
+func writeZipJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(f).Encode(v)
+}
+
+// zipSafeName keeps an uploaded filename from escaping its directory when
+// the archive is extracted.
+func zipSafeName(name string) string {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "file"
+	}
+	return name
+}
+
+// copyAttachmentToZip adds a's stored file, which lives in dir, to the
+// archive at a.Path.
+// Attachments are images and PDFs, which are already compressed, so the
+// file is stored as is.
+func copyAttachmentToZip(zw *zip.Writer, dir string, a backupAttachment) error {
+	src, err := os.Open(filepath.Join(dir, a.storedName))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     a.Path,
+		Method:   zip.Store,
+		Modified: a.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestZipSafeName(t *testing.T) {
+	for in, want := range map[string]string{
+		"chart.png": "chart.png", "": "file", ".": "file", "..": "file",
+		"../x.png": "file", `a\b.png`: "file",
+	} {
+		if got := zipSafeName(in); got != want {
+			t.Errorf("zipSafeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBackup(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	kept := c.createNote(map[string]string{"title": "keep", "content": "body"})
+	c.createNote(map[string]string{"title": "second"})
+	wantStatus(t, c.upload(fmt.Sprintf("/notes/%d/attachments", kept.ID), "chart.png", pngBytes), http.StatusCreated)
+
+	bob := c.newClient()
+	bob.login("bob")
+	bob.createNote(map[string]string{"title": "bob's"})
+
+	resp := c.do("GET", "/me/backup", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="notes-backup-`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	var notes []Note
+	if err := json.Unmarshal(files[backupNotesFile], &notes); err != nil {
+		t.Fatalf("%s isn't valid JSON: %v\n%s", backupNotesFile, err, files[backupNotesFile])
+	}
+	if len(notes) != 2 || notes[0].ID != kept.ID || notes[0].Content != "body" || notes[1].Title != "second" {
+		t.Fatalf("notes = %+v, want alice's two", notes)
+	}
+	if !json.Valid(files[backupNotebooksFile]) {
+		t.Errorf("%s = %s", backupNotebooksFile, files[backupNotebooksFile])
+	}
+
+	var atts []backupAttachment
+	if err := json.Unmarshal(files[backupAttachmentsFile], &atts); err != nil {
+		t.Fatal(err)
+	}
+	if len(atts) != 1 || atts[0].NoteID != kept.ID || atts[0].Filename != "chart.png" {
+		t.Fatalf("attachments = %+v", atts)
+	}
+	if !bytes.Equal(files[atts[0].Path], pngBytes) {
+		t.Errorf("%s holds %d bytes, want the uploaded file", atts[0].Path, len(files[atts[0].Path]))
+	}
+
+	wantStatus(t, c.do("POST", "/me/backup", nil), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// collaboratorPermissions are the access levels a note can be shared with.
+// Collaborators can only read; every write path still checks ownership.
+var collaboratorPermissions = map[string]bool{
+	"view": true,
+}
+
+// Collaborator is a user a note has been shared with.
+type Collaborator struct {
+	UserID     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Permission string `json:"permission"`
+}
+
+func collaboratorsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listCollaboratorsHandler(w, r)
+	case http.MethodPost:
+		addCollaboratorHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func collaboratorItemHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		removeCollaboratorHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodDelete)
+	}
+}
+
+func listCollaboratorsHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, ok := ownedNoteParam(w, r)
+	if !ok {
+		return
+	}
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT u.id, u.username, s.permission
+		FROM note_shares s JOIN users u ON u.id = s.shared_with_user_id
+		WHERE s.note_id = ? ORDER BY u.username`, noteID)
+	if err != nil {
+		requestLog(r).Error("listCollaborators query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	collaborators := []Collaborator{}
+	for rows.Next() {
+		var c Collaborator
+		if err := rows.Scan(&c.UserID, &c.Username, &c.Permission); err != nil {
+			requestLog(r).Error("listCollaborators scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		collaborators = append(collaborators, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collaborators)
+}
+
+// addCollaboratorHandler shares the note with another user by username, or
+// changes the permission of an existing collaborator.
+func addCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	noteID, ok := ownedNoteParam(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Username   string `json:"username"`
+		Permission string `json:"permission"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	c := Collaborator{Username: normalizeUsername(body.Username), Permission: body.Permission}
+	if c.Permission == "" {
+		c.Permission = "view"
+	}
+
+	var verr ValidationError
+	if !collaboratorPermissions[c.Permission] {
+		verr.Add("permission", "invalid")
+	}
+	if c.Username == "" {
+		verr.Add("username", "required")
+	} else {
+		err := db.QueryRowContext(r.Context(), `SELECT id, username FROM users WHERE LOWER(username) = ?`, c.Username).Scan(&c.UserID, &c.Username)
+		if errors.Is(err, sql.ErrNoRows) {
+			verr.Add("username", "no such user")
+		} else if err != nil {
+			requestLog(r).Error("addCollaborator lookup", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		} else if c.UserID == userID {
+			verr.Add("username", "you already own this note")
+		}
+	}
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return
+	}
+
+	status := http.StatusOK
+	var exists int
+	err := db.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM note_shares WHERE note_id = ? AND shared_with_user_id = ?`, noteID, c.UserID).Scan(&exists)
+	if err == nil && exists > 0 {
+		_, err = db.ExecContext(r.Context(),
+			`UPDATE note_shares SET permission = ? WHERE note_id = ? AND shared_with_user_id = ?`,
+			c.Permission, noteID, c.UserID,
+		)
+	} else if err == nil {
+		_, err = db.ExecContext(r.Context(),
+			`INSERT INTO note_shares (note_id, shared_with_user_id, permission) VALUES (?, ?, ?)`,
+			noteID, c.UserID, c.Permission,
+		)
+		status = http.StatusCreated
+	}
+	if err != nil {
+		requestLog(r).Error("addCollaborator save", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusCreated {
+		w.Header().Set("Location", "/notes/"+strconv.Itoa(noteID)+"/collaborators/"+strconv.Itoa(c.UserID))
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(c)
+}
+
+func removeCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, ok := ownedNoteParam(w, r)
+	if !ok {
+		return
+	}
+	collaboratorID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil || collaboratorID <= 0 {
+		writeJSONError(w, http.StatusBadRequest, msgInvalidID)
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), `DELETE FROM note_shares WHERE note_id = ? AND shared_with_user_id = ?`, noteID, collaboratorID)
+	if err != nil {
+		requestLog(r).Error("removeCollaborator delete", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	aff, _ := res.RowsAffected()
+	if aff == 0 {
+		writeJSONError(w, http.StatusNotFound, msgCollaboratorNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
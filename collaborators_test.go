@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCollaborators(t *testing.T) {
+	a := newDBApp(t)
+	alice := newTestClient(t, a.routes())
+	alice.login("alice")
+	bob := alice.newClient()
+	bobID := bob.login("bob")
+	note := alice.createNote(map[string]string{"title": "plans"})
+	path := fmt.Sprintf("/notes/%d", note.ID)
+
+	wantFieldErrors(t, alice.do("POST", path+"/collaborators", map[string]string{"username": "carol"}), "username")
+	wantFieldErrors(t, alice.do("POST", path+"/collaborators", map[string]string{"username": "alice"}), "username")
+	wantFieldErrors(t, alice.do("POST", path+"/collaborators", map[string]string{"username": "bob", "permission": "edit"}), "permission")
+	// Only the owner may share.
+	wantStatus(t, bob.do("POST", path+"/collaborators", map[string]string{"username": "bob"}), http.StatusNotFound)
+
+	resp := alice.do("POST", path+"/collaborators", map[string]string{"username": "Bob"})
+	wantStatus(t, resp, http.StatusCreated)
+	if want := fmt.Sprintf("%s/collaborators/%d", path, bobID); resp.Header.Get("Location") != want {
+		t.Errorf("Location = %q, want %q", resp.Header.Get("Location"), want)
+	}
+	// Granting again just updates the permission.
+	wantStatus(t, alice.do("POST", path+"/collaborators", map[string]string{"username": "bob"}), http.StatusOK)
+
+	resp = alice.do("GET", path+"/collaborators", nil)
+	wantStatus(t, resp, http.StatusOK)
+	var collaborators []Collaborator
+	decodeBody(t, resp, &collaborators)
+	if len(collaborators) != 1 || collaborators[0].UserID != bobID || collaborators[0].Permission != "view" {
+		t.Fatalf("collaborators = %+v", collaborators)
+	}
+
+	// Shared notes only show up when asked for, and read-only.
+	if got := bob.listNotes(""); len(got) != 0 {
+		t.Errorf("bob's own list = %v, want empty", noteIDs(got))
+	}
+	shared := bob.listNotes("include_shared=true")
+	if len(shared) != 1 || shared[0].ID != note.ID || !shared[0].ReadOnly {
+		t.Fatalf("bob's list with shared notes = %+v", shared)
+	}
+	if own := alice.listNotes("include_shared=true"); len(own) != 1 || own[0].ReadOnly {
+		t.Fatalf("alice's list = %+v, want her note writable", own)
+	}
+
+	// Viewing doesn't let bob change anything.
+	wantStatus(t, bob.do("PUT", path, map[string]string{"title": "mine now"}), http.StatusNotFound)
+	wantStatus(t, bob.do("DELETE", path, nil), http.StatusNotFound)
+	wantStatus(t, bob.do("DELETE", fmt.Sprintf("%s/collaborators/%d", path, bobID), nil), http.StatusNotFound)
+
+	wantStatus(t, alice.do("DELETE", fmt.Sprintf("%s/collaborators/%d", path, bobID), nil), http.StatusNoContent)
+	wantStatus(t, alice.do("DELETE", fmt.Sprintf("%s/collaborators/%d", path, bobID), nil), http.StatusNotFound)
+	if got := bob.listNotes("include_shared=true"); len(got) != 0 {
+		t.Errorf("after revoking, bob sees %v", noteIDs(got))
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "net/http"
+
+// maxInFlight caps how many requests are handled at once (MAX_IN_FLIGHT);
+// 0 means no cap.
+var maxInFlight int
+
+// inFlightExempt are paths served even when the server is at its cap.
+var inFlightExempt = map[string]bool{
+	"/health": true,
+	"/livez":  true,
+	"/readyz": true,
+}
+
+// concurrencyLimitMiddleware sheds load past maxInFlight concurrent
+// requests: the excess get an immediate 503 with Retry-After rather than
+// waiting in an unbounded queue, so a spike can't pile up goroutines and
+// memory until the process falls over.
+func concurrencyLimitMiddleware(next http.Handler) http.Handler {
+	if maxInFlight <= 0 {
+		return next
+	}
+	sem := make(chan struct{}, maxInFlight)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inFlightExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeJSONError(w, http.StatusServiceUnavailable, msgServerBusy)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	old := maxInFlight
+	t.Cleanup(func() { maxInFlight = old })
+	maxInFlight = 2
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := concurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Fill every slot with a request that won't finish until released.
+	var wg sync.WaitGroup
+	slow := make([]*httptest.ResponseRecorder, maxInFlight)
+	for i := range slow {
+		slow[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(slow[i], httptest.NewRequest("GET", "/slow", nil))
+		}()
+		<-started
+	}
+
+	for range 3 {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/notes", nil))
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+			t.Fatalf("over the cap: status %d, Retry-After %q; want 503 and 1", w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+	// Health checks still get through.
+	for _, path := range []string{"/health", "/livez", "/readyz"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s at the cap: status %d, want 200", path, w.Code)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+	for i, w := range slow {
+		if w.Code != http.StatusOK {
+			t.Errorf("slow request %d: status %d", i, w.Code)
+		}
+	}
+	// The slots are free again.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/notes", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("after release: status %d, want 200", w.Code)
+	}
+}
+
+func TestConcurrencyLimitOff(t *testing.T) {
+	old := maxInFlight
+	t.Cleanup(func() { maxInFlight = old })
+	maxInFlight = 0
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := concurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/notes", nil))
+			codes[i] = w.Code
+		}()
+	}
+	// Every request gets in at once.
+	for range codes {
+		<-started
+	}
+	close(release)
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d: status %d", i, code)
+		}
+	}
+}
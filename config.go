@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultDSN is the MySQL database used when TODO_DB_DSN is unset.
+const defaultDSN = "cloud:cloud.kenzastore.my.id@tcp(127.0.0.1:3306)/cloud?parseTime=true&charset=utf8mb4&loc=Local"
+
+// Config is everything the server takes from its environment. LoadConfig
+// reads and checks it all up front, so a typo stops the server at startup
+// rather than surfacing on some later request.
+type Config struct {
+	// DBDriver is a key of dialects (DB_DRIVER, default mysql).
+	DBDriver string
+	// DSN is the database connection string (TODO_DB_DSN). It has a
+	// default only for mysql.
+	DSN string
+	// DBReset wipes the notes tables on start (DB_RESET); never set it in
+	// production.
+	DBReset bool
+
+	// Addr is the listen address, from LISTEN_ADDR or HOST and PORT.
+	Addr string
+	// BasePath is the URL prefix (BASE_PATH), normalized to a leading
+	// slash and no trailing one.
+	BasePath string
+	// Timeouts are the HTTP server timeouts (HTTP_*_TIMEOUT).
+	Timeouts httpTimeouts
+
+	MaxBodyBytes   int64         // MAX_BODY_BYTES
+	IdempotencyTTL time.Duration // IDEMPOTENCY_TTL
+	// MaxJSONDepth caps how deeply the import and batch bodies may nest
+	// arrays and objects (MAX_JSON_DEPTH, default 32, 0 for no cap).
+	MaxJSONDepth int
+	// NoteCreateRate is how many notes a user may create per minute, by
+	// any means: POST /notes, batch, import, duplicate or template
+	// (NOTE_CREATE_RATE, default 60); 0 turns the limit off.
+	NoteCreateRate int
+	// MaxPinnedNotes caps how many notes a user may pin (MAX_PINNED_NOTES,
+	// default 5, 0 for no cap).
+	MaxPinnedNotes int
+	// MaxInFlight caps concurrent requests, answering the excess with 503
+	// (MAX_IN_FLIGHT, default 0 for no cap).
+	MaxInFlight int
+
+	SessionTTL           time.Duration // SESSION_TTL
+	SessionSweepInterval time.Duration // SESSION_SWEEP_INTERVAL
+	// MaxSessionsPerUser caps each user's concurrent sessions
+	// (MAX_SESSIONS_PER_USER, default 0 for no cap). At the cap a new
+	// login evicts the oldest session, or is refused when
+	// SessionLimitReject is set (SESSION_LIMIT_MODE=reject; the default
+	// is evict).
+	MaxSessionsPerUser int
+	SessionLimitReject bool
+	// BcryptCost is the work factor for new password hashes
+	// (BCRYPT_COST). Existing hashes keep the cost they were made with.
+	BcryptCost int
+	// AdminUsername names the instance admin (ADMIN_USERNAME).
+	AdminUsername string
+	// LoginMaxFailures failed logins lock a username for LoginLockout
+	// (LOGIN_MAX_FAILURES, default 5, 0 turns lockout off; LOGIN_LOCKOUT,
+	// default 15m).
+	LoginMaxFailures int
+	LoginLockout     time.Duration
+
+	// CORSOrigins is the browser origin allowlist (CORS_ALLOWED_ORIGINS,
+	// comma-separated).
+	CORSOrigins []string
+	// ContentSecurityPolicy is the CSP header value; set
+	// CONTENT_SECURITY_POLICY empty to turn the header off.
+	ContentSecurityPolicy string
+	// TrustedProxies are the proxy networks whose X-Forwarded-For and
+	// X-Real-IP headers are believed (TRUSTED_PROXIES, comma-separated
+	// CIDRs or addresses).
+	TrustedProxies []netip.Prefix
+	// TrustProxy trusts the direct peer as a proxy whatever its address
+	// (TRUST_PROXY). Leave it off unless behind a reverse proxy, or
+	// clients can spoof their IPs; TRUSTED_PROXIES is the safer choice.
+	TrustProxy bool
+
+	UploadDir      string // UPLOAD_DIR
+	MaxUploadBytes int64  // MAX_UPLOAD_BYTES
+
+	// WebhookTimeout bounds each webhook delivery attempt
+	// (WEBHOOK_TIMEOUT, default 5s).
+	WebhookTimeout time.Duration
+	// WebhookAllowPrivate lets webhooks point at loopback and private
+	// addresses (WEBHOOK_ALLOW_PRIVATE). Only for trusted deployments.
+	WebhookAllowPrivate bool
+
+	// StaticMaxAge is the Cache-Control max-age for /static/ and the
+	// favicon (STATIC_MAX_AGE, default 1h; 0 sends none). The files aren't
+	// fingerprinted, so keep it short enough that a deploy shows up.
+	StaticMaxAge time.Duration
+	// FaviconPath is a file to serve as /favicon.ico (FAVICON_PATH).
+	FaviconPath string
+
+	// TemplateHotReload re-parses the frontend template from disk on every
+	// request (TEMPLATE_HOT_RELOAD) so frontend edits show up without a
+	// rebuild.
+	TemplateHotReload bool
+
+	// LogLevel drops log records below it (LOG_LEVEL: debug, info, warn or
+	// error; default info).
+	LogLevel slog.Level
+	// LogFormat is "text" (key=value, the default) or "json" (LOG_FORMAT).
+	LogFormat string
+
+	// JSONFieldCase is "snake" (the default) or "camel", for the keys of
+	// notes and users in responses (JSON_FIELD_CASE).
+	JSONFieldCase string
+}
+
+// defaultConfig is the configuration with nothing set in the environment.
+func defaultConfig() Config {
+	return Config{
+		DBDriver:              "mysql",
+		Timeouts:              serverTimeouts,
+		MaxBodyBytes:          maxBodyBytes,
+		MaxJSONDepth:          maxJSONDepth,
+		IdempotencyTTL:        24 * time.Hour,
+		NoteCreateRate:        60,
+		MaxPinnedNotes:        5,
+		SessionTTL:            24 * time.Hour,
+		SessionSweepInterval:  time.Minute,
+		BcryptCost:            bcrypt.DefaultCost,
+		LoginMaxFailures:      5,
+		LoginLockout:          15 * time.Minute,
+		ContentSecurityPolicy: contentSecurityPolicy,
+		UploadDir:             "uploads",
+		MaxUploadBytes:        5 << 20,
+		StaticMaxAge:          time.Hour,
+		WebhookTimeout:        5 * time.Second,
+		LogFormat:             "text",
+		JSONFieldCase:         "snake",
+	}
+}
+
+// LoadConfig reads the environment over defaultConfig. The error names the
+// offending variable and value.
+func LoadConfig() (Config, error) {
+	c := defaultConfig()
+	env := &envReader{}
+
+	if v := os.Getenv("DB_DRIVER"); v != "" {
+		if _, ok := dialects[v]; !ok {
+			return Config{}, fmt.Errorf("invalid DB_DRIVER %q: want mysql or postgres", v)
+		}
+		c.DBDriver = v
+	}
+	c.DSN = os.Getenv("TODO_DB_DSN")
+	if c.DSN == "" {
+		if c.DBDriver != "mysql" {
+			return Config{}, fmt.Errorf("TODO_DB_DSN is required with DB_DRIVER=%s", c.DBDriver)
+		}
+		c.DSN = defaultDSN
+	}
+	env.bool("DB_RESET", &c.DBReset)
+
+	c.Addr = listenAddr(os.Getenv("LISTEN_ADDR"), os.Getenv("HOST"), os.Getenv("PORT"))
+	if p := os.Getenv("PORT"); p != "" {
+		if n, perr := strconv.Atoi(p); perr != nil || n < 0 || n > 65535 {
+			return Config{}, fmt.Errorf("invalid PORT %q: want 0-65535", p)
+		}
+	}
+	c.BasePath = strings.TrimRight(os.Getenv("BASE_PATH"), "/")
+	if c.BasePath != "" && !strings.HasPrefix(c.BasePath, "/") {
+		c.BasePath = "/" + c.BasePath
+	}
+	// Zero turns an HTTP timeout off, as in net/http.
+	env.duration("HTTP_READ_HEADER_TIMEOUT", &c.Timeouts.ReadHeader, true)
+	env.duration("HTTP_READ_TIMEOUT", &c.Timeouts.Read, true)
+	env.duration("HTTP_WRITE_TIMEOUT", &c.Timeouts.Write, true)
+	env.duration("HTTP_IDLE_TIMEOUT", &c.Timeouts.Idle, true)
+
+	env.positiveInt64("MAX_BODY_BYTES", &c.MaxBodyBytes)
+	env.nonNegativeInt("MAX_JSON_DEPTH", &c.MaxJSONDepth)
+	env.duration("IDEMPOTENCY_TTL", &c.IdempotencyTTL, false)
+	env.nonNegativeInt("NOTE_CREATE_RATE", &c.NoteCreateRate)
+	env.nonNegativeInt("MAX_PINNED_NOTES", &c.MaxPinnedNotes)
+	env.nonNegativeInt("MAX_IN_FLIGHT", &c.MaxInFlight)
+
+	env.duration("SESSION_TTL", &c.SessionTTL, false)
+	env.duration("SESSION_SWEEP_INTERVAL", &c.SessionSweepInterval, false)
+	env.nonNegativeInt("MAX_SESSIONS_PER_USER", &c.MaxSessionsPerUser)
+	if v := strings.ToLower(os.Getenv("SESSION_LIMIT_MODE")); v != "" {
+		if v != "evict" && v != "reject" {
+			return Config{}, fmt.Errorf("invalid SESSION_LIMIT_MODE %q: want evict or reject", v)
+		}
+		c.SessionLimitReject = v == "reject"
+	}
+	if v := os.Getenv("BCRYPT_COST"); v != "" {
+		n, perr := strconv.Atoi(v)
+		if perr != nil || n < bcrypt.MinCost || n > bcrypt.MaxCost {
+			return Config{}, fmt.Errorf("invalid BCRYPT_COST %q: want %d-%d", v, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		c.BcryptCost = n
+	}
+	c.AdminUsername = normalizeUsername(os.Getenv("ADMIN_USERNAME"))
+	env.nonNegativeInt("LOGIN_MAX_FAILURES", &c.LoginMaxFailures)
+	env.duration("LOGIN_LOCKOUT", &c.LoginLockout, false)
+
+	for _, o := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			c.CORSOrigins = append(c.CORSOrigins, o)
+		}
+	}
+	if v, ok := os.LookupEnv("CONTENT_SECURITY_POLICY"); ok {
+		c.ContentSecurityPolicy = v
+	}
+	env.bool("TRUST_PROXY", &c.TrustProxy)
+	proxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return Config{}, err
+	}
+	c.TrustedProxies = proxies
+
+	if v := os.Getenv("UPLOAD_DIR"); v != "" {
+		c.UploadDir = v
+	}
+	env.positiveInt64("MAX_UPLOAD_BYTES", &c.MaxUploadBytes)
+
+	env.duration("WEBHOOK_TIMEOUT", &c.WebhookTimeout, false)
+	env.bool("WEBHOOK_ALLOW_PRIVATE", &c.WebhookAllowPrivate)
+
+	env.duration("STATIC_MAX_AGE", &c.StaticMaxAge, true)
+	c.FaviconPath = os.Getenv("FAVICON_PATH")
+	env.bool("TEMPLATE_HOT_RELOAD", &c.TemplateHotReload)
+
+	level, err := parseLogLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		return Config{}, err
+	}
+	c.LogLevel = level
+	if v := strings.ToLower(os.Getenv("LOG_FORMAT")); v != "" {
+		if v != "text" && v != "json" {
+			return Config{}, fmt.Errorf("invalid LOG_FORMAT %q: want text or json", v)
+		}
+		c.LogFormat = v
+	}
+	if v := strings.ToLower(os.Getenv("JSON_FIELD_CASE")); v != "" {
+		if v != "snake" && v != "camel" {
+			return Config{}, fmt.Errorf("invalid JSON_FIELD_CASE %q: want snake or camel", v)
+		}
+		c.JSONFieldCase = v
+	}
+
+	if env.err != nil {
+		return Config{}, env.err
+	}
+	return c, nil
+}
+
+// envReader parses optional variables, leaving the destination at its
+// default when a variable is unset. Only the first failure is kept.
+type envReader struct {
+	err error
+}
+
+func (e *envReader) fail(name, v, want string) {
+	if e.err == nil {
+		e.err = fmt.Errorf("invalid %s %q: want %s", name, v, want)
+	}
+}
+
+func (e *envReader) bool(name string, dst *bool) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail(name, v, "true or false")
+		return
+	}
+	*dst = b
+}
+
+func (e *envReader) positiveInt64(name string, dst *int64) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		e.fail(name, v, "a positive integer")
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) nonNegativeInt(name string, dst *int) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		e.fail(name, v, "a whole number, or 0 to disable")
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) duration(name string, dst *time.Duration, allowZero bool) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 || (d == 0 && !allowZero) {
+		if allowZero {
+			e.fail(name, v, `a duration such as "30s", or 0 to disable`)
+		} else {
+			e.fail(name, v, `a positive duration such as "30s"`)
+		}
+		return
+	}
+	*dst = d
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// configVars are the variables LoadConfig reads by value; clearConfigEnv
+// empties them so the developer's own environment can't leak in.
+var configVars = []string{
+	"ADMIN_USERNAME", "BASE_PATH", "BCRYPT_COST", "CORS_ALLOWED_ORIGINS", "DB_DRIVER", "DB_RESET",
+	"FAVICON_PATH", "HOST", "HTTP_IDLE_TIMEOUT", "HTTP_READ_HEADER_TIMEOUT", "HTTP_READ_TIMEOUT",
+	"HTTP_WRITE_TIMEOUT", "IDEMPOTENCY_TTL", "JSON_FIELD_CASE", "LISTEN_ADDR", "LOGIN_LOCKOUT",
+	"LOGIN_MAX_FAILURES", "LOG_FORMAT", "LOG_LEVEL", "MAX_BODY_BYTES", "MAX_IN_FLIGHT",
+	"MAX_JSON_DEPTH", "MAX_PINNED_NOTES", "MAX_SESSIONS_PER_USER", "MAX_UPLOAD_BYTES",
+	"NOTE_CREATE_RATE", "PORT", "SESSION_LIMIT_MODE", "SESSION_SWEEP_INTERVAL", "SESSION_TTL",
+	"STATIC_MAX_AGE", "TEMPLATE_HOT_RELOAD", "TODO_DB_DSN", "TRUSTED_PROXIES", "TRUST_PROXY",
+	"UPLOAD_DIR", "WEBHOOK_ALLOW_PRIVATE", "WEBHOOK_TIMEOUT",
+}
+
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range configVars {
+		t.Setenv(name, "")
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	clearConfigEnv(t)
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DBDriver != "mysql" || cfg.DSN != defaultDSN || cfg.Addr != ":8080" || cfg.BasePath != "" {
+		t.Errorf("database and address defaults: %+v", cfg)
+	}
+	if cfg.SessionTTL != 24*time.Hour || cfg.NoteCreateRate != 60 || cfg.MaxPinnedNotes != 5 || cfg.LogFormat != "text" || cfg.JSONFieldCase != "snake" {
+		t.Errorf("limits and formats: %+v", cfg)
+	}
+}
+
+func TestLoadConfigValues(t *testing.T) {
+	clearConfigEnv(t)
+	for name, v := range map[string]string{
+		"SESSION_TTL":           "2h",
+		"BCRYPT_COST":           "12",
+		"BASE_PATH":             "todo/",
+		"ADMIN_USERNAME":        " Root ",
+		"CORS_ALLOWED_ORIGINS":  "https://a.example, ,https://b.example",
+		"MAX_SESSIONS_PER_USER": "3",
+		"SESSION_LIMIT_MODE":    "REJECT",
+		"LOG_FORMAT":            "json",
+		"TRUSTED_PROXIES":       "10.0.0.0/8, 192.0.2.1",
+	} {
+		t.Setenv(name, v)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SessionTTL != 2*time.Hour || cfg.BcryptCost != 12 || cfg.BasePath != "/todo" || cfg.AdminUsername != "root" {
+		t.Errorf("parsed: TTL %v, cost %d, base %q, admin %q", cfg.SessionTTL, cfg.BcryptCost, cfg.BasePath, cfg.AdminUsername)
+	}
+	if len(cfg.CORSOrigins) != 2 || cfg.MaxSessionsPerUser != 3 || !cfg.SessionLimitReject || cfg.LogFormat != "json" || len(cfg.TrustedProxies) != 2 {
+		t.Errorf("parsed: %+v", cfg)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	for _, tc := range []struct{ name, value string }{
+		{"DB_DRIVER", "oracle"},
+		{"PORT", "80a"},
+		{"PORT", "70000"},
+		{"DB_RESET", "sometimes"},
+		{"SESSION_TTL", "forever"},
+		{"SESSION_TTL", "0"},
+		{"IDEMPOTENCY_TTL", "-1h"},
+		{"MAX_BODY_BYTES", "0"},
+		{"MAX_BODY_BYTES", "1MB"},
+		{"NOTE_CREATE_RATE", "-5"},
+		{"BCRYPT_COST", "99"},
+		{"SESSION_LIMIT_MODE", "queue"},
+		{"TRUSTED_PROXIES", "10.0.0.0/99"},
+		{"LOG_LEVEL", "loud"},
+		{"LOG_FORMAT", "xml"},
+		{"JSON_FIELD_CASE", "kebab"},
+	} {
+		clearConfigEnv(t)
+		t.Setenv(tc.name, tc.value)
+		_, err := LoadConfig()
+		if err == nil {
+			t.Errorf("%s=%s was accepted", tc.name, tc.value)
+			continue
+		}
+		// The message names what to fix.
+		if !strings.Contains(err.Error(), tc.name) && !strings.Contains(err.Error(), tc.value) {
+			t.Errorf("%s=%s: error %q names neither", tc.name, tc.value, err)
+		}
+	}
+}
+
+func TestLoadConfigRequired(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("DB_DRIVER", "postgres")
+	_, err := LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), "TODO_DB_DSN is required") {
+		t.Fatalf("postgres without a DSN: %v", err)
+	}
+}
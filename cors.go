@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	corsAllowMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowHeaders = "Content-Type, Idempotency-Key, If-Match, If-Modified-Since, If-None-Match, X-API-Key, X-Request-ID"
+	// corsExposeHeaders lists response headers browser clients may read.
+	corsExposeHeaders = "ETag, Idempotent-Replayed, Location, Retry-After, X-Next-Cursor, X-Request-ID, X-Total-Count"
+
+	// The public route group is read-only and carries no credentials, so it
+	// needs far less.
+	corsPublicAllowMethods  = "GET, OPTIONS"
+	corsPublicAllowHeaders  = "If-None-Match, X-Request-ID"
+	corsPublicExposeHeaders = "ETag, X-Request-ID"
+)
+
+// corsPublicPrefixes are the route groups any origin may read, e.g. to embed
+// a shared note on another site. They answer with a wildcard origin and no
+// credentials, so a browser never sends the session cookie along; every
+// other route keeps the strict allowlist.
+var corsPublicPrefixes = []string{"/shared/"}
+
+func corsPublicRoute(path string) bool {
+	for _, prefix := range corsPublicPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsOrigins is the allowlist read from CORS_ALLOWED_ORIGINS
+// (comma-separated, e.g. "http://localhost:5173,https://app.example.com").
+var corsOrigins = map[string]bool{}
+
+// corsMiddleware echoes back allowlisted origins with credentials enabled and
+// answers preflight requests. Requests from other origins get no CORS
+// headers, so the browser blocks them. Public routes are handed to
+// publicCORS instead.
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if corsPublicRoute(r.URL.Path) {
+			publicCORS(w, r, next)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+
+		allowed := corsOrigins[origin]
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		}
+
+		// Preflight
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				w.Header().Set("Access-Control-Max-Age", "600")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// publicCORS lets any origin read a public route. The response is the same
+// whatever the origin, so there's no Vary: Origin.
+func publicCORS(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", corsPublicExposeHeaders)
+
+	// Preflight
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		w.Header().Set("Access-Control-Allow-Methods", corsPublicAllowMethods)
+		w.Header().Set("Access-Control-Allow-Headers", corsPublicAllowHeaders)
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
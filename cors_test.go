@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// corsRequest sends a request from origin through corsMiddleware to a
+// handler that answers 200.
+func corsRequest(t *testing.T, method, path, origin string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(w, r)
+	return w
+}
+
+func setCORSOrigins(t *testing.T, origins ...string) {
+	t.Helper()
+	old := corsOrigins
+	t.Cleanup(func() { corsOrigins = old })
+	corsOrigins = map[string]bool{}
+	for _, o := range origins {
+		corsOrigins[o] = true
+	}
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	setCORSOrigins(t, "http://localhost:5173")
+
+	w := corsRequest(t, "GET", "/notes", "http://localhost:5173")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:5173" {
+		t.Errorf("Allow-Origin = %q, want the origin echoed", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Allow-Credentials = %q, want true", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+
+	w = corsRequest(t, "OPTIONS", "/notes", "http://localhost:5173", "Access-Control-Request-Method", "POST")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status %d, want 204", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") != corsAllowMethods || w.Header().Get("Access-Control-Allow-Headers") != corsAllowHeaders {
+		t.Errorf("preflight headers = %v", w.Header())
+	}
+}
+
+func TestCORSOtherOrigin(t *testing.T) {
+	setCORSOrigins(t, "http://localhost:5173")
+
+	// Requests go through, but without headers letting the browser read
+	// the response.
+	w := corsRequest(t, "GET", "/notes", "https://evil.example")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Allow-Origin = %q for a foreign origin", got)
+	}
+
+	w = corsRequest(t, "OPTIONS", "/notes", "https://evil.example", "Access-Control-Request-Method", "DELETE")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("foreign preflight: status %d, headers %v", w.Code, w.Header())
+	}
+
+	// Same-origin and non-browser requests carry no Origin at all.
+	w = corsRequest(t, "GET", "/notes", "")
+	if len(w.Header()) != 0 {
+		t.Errorf("no Origin: headers %v, want none", w.Header())
+	}
+}
+
+func TestCORSPublicRoute(t *testing.T) {
+	setCORSOrigins(t, "http://localhost:5173")
+
+	for _, origin := range []string{"https://blog.example", "http://localhost:5173"} {
+		w := corsRequest(t, "GET", "/shared/abc123", origin)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("%s: Allow-Origin = %q, want *", origin, got)
+		}
+		// A wildcard origin must never come with credentials.
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("%s: Allow-Credentials = %q on a public route", origin, got)
+		}
+		if got := w.Header().Get("Vary"); got != "" {
+			t.Errorf("%s: Vary = %q, want none", origin, got)
+		}
+	}
+
+	w := corsRequest(t, "OPTIONS", "/shared/abc123", "https://blog.example", "Access-Control-Request-Method", "GET")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status %d, want 204", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") != corsPublicAllowMethods || w.Header().Get("Access-Control-Allow-Headers") != corsPublicAllowHeaders {
+		t.Errorf("preflight headers = %v", w.Header())
+	}
+
+	// The same origin gets nothing from the private API.
+	for _, path := range []string{"/notes", "/notes/1/share", "/sharedx"} {
+		w = corsRequest(t, "GET", path, "https://blog.example")
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("%s: Allow-Origin = %q for a foreign origin", path, got)
+		}
+	}
+}
+
+func TestCORSPublicRouteEndToEnd(t *testing.T) {
+	setCORSOrigins(t)
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "public"})
+	slug := shareNote(t, c, note.ID)
+
+	anon := c.newClient()
+	resp := anon.do("GET", "/shared/"+slug, nil, "Origin", "https://blog.example")
+	wantStatus(t, resp, http.StatusOK)
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("shared note: Allow-Origin = %q, want *", got)
+	}
+	resp = c.do("GET", fmt.Sprintf("/notes/%d", note.ID), nil, "Origin", "https://blog.example")
+	wantStatus(t, resp, http.StatusOK)
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("private note: Allow-Origin = %q", got)
+	}
+}
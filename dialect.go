@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// dialect captures what differs between the databases the server can run
+// on. Queries are written once, MySQL-style with ? placeholders; the
+// postgres driver below rewrites them on the way through.
+type dialect struct {
+	// driver is the database/sql driver name handed to sql.Open.
+	driver string
+	// returningID is set when new row ids come back through RETURNING
+	// rather than LastInsertId.
+	returningID bool
+	// ddl adapts a CREATE or ALTER statement from schema.go.
+	ddl func(string) string
+}
+
+// dialects are the accepted DB_DRIVER values.
+var dialects = map[string]dialect{
+	"mysql": {
+		driver: "mysql",
+		ddl:    func(s string) string { return s },
+	},
+	"postgres": {
+		driver:      "postgres-rebind",
+		returningID: true,
+		ddl:         postgresDDL.Replace,
+	},
+}
+
+// sqlDialect is the dialect selected by DB_DRIVER (default mysql).
+var sqlDialect = dialects["mysql"]
+
+// postgresDDL maps the MySQL column types schema.go is written in.
+var postgresDDL = strings.NewReplacer(
+	"INT AUTO_INCREMENT PRIMARY KEY", "SERIAL PRIMARY KEY",
+	"DATETIME", "TIMESTAMP",
+)
+
+func init() {
+	sql.Register("postgres-rebind", rebindDriver{&pq.Driver{}})
+}
+
+// returning is appended to INSERTs whose new id is wanted.
+func (d dialect) returning() string {
+	if d.returningID {
+		return " RETURNING id"
+	}
+	return ""
+}
+
+// insertID runs an INSERT and returns the id of the new row.
+func insertID(ctx context.Context, tx queryExecer, query string, args ...interface{}) (int64, error) {
+	if sqlDialect.returningID {
+		var id int64
+		err := tx.QueryRowContext(ctx, query+sqlDialect.returning(), args...).Scan(&id)
+		return id, err
+	}
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// stmtInsertID is insertID for a statement prepared with returning()
+// already appended.
+func stmtInsertID(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (int64, error) {
+	if sqlDialect.returningID {
+		var id int64
+		err := stmt.QueryRowContext(ctx, args...).Scan(&id)
+		return id, err
+	}
+	res, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// isDuplicateKey reports whether err is a unique-constraint violation from
+// either database.
+func isDuplicateKey(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1062 // ER_DUP_ENTRY
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505" // unique_violation
+	}
+	return false
+}
+
+// queryExecer is satisfied by *sql.DB and *sql.Tx.
+type queryExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// rebind turns ? placeholders into Postgres's numbered $1, $2, ... form,
+// leaving quoted strings and identifiers alone.
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// rebindDriver wraps a driver so every query it sees is passed through
+// rebind first.
+type rebindDriver struct {
+	driver.Driver
+}
+
+func (d rebindDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return rebindConn{c}, nil
+}
+
+type rebindConn struct {
+	driver.Conn
+}
+
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return pc.PrepareContext(ctx, rebind(query))
+	}
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return bc.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if qc, ok := c.Conn.(driver.QueryerContext); ok {
+		return qc.QueryContext(ctx, rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if ec, ok := c.Conn.(driver.ExecerContext); ok {
+		return ec.ExecContext(ctx, rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c rebindConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
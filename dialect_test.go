@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestIsDuplicateKey(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"mysql duplicate", &mysql.MySQLError{Number: 1062}, true},
+		{"wrapped mysql duplicate", fmt.Errorf("insert: %w", &mysql.MySQLError{Number: 1062}), true},
+		{"mysql other", &mysql.MySQLError{Number: 1146}, false},
+		{"postgres duplicate", &pq.Error{Code: "23505"}, true},
+		{"postgres other", &pq.Error{Code: "42P01"}, false},
+		{"connection lost", errors.New("driver: bad connection"), false},
+		{"nil", nil, false},
+	} {
+		if got := isDuplicateKey(tc.err); got != tc.want {
+			t.Errorf("%s: isDuplicateKey = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM notes WHERE id = ?", "SELECT * FROM notes WHERE id = $1"},
+		{"UPDATE notes SET title = ?, content = ? WHERE id = ? AND user_id = ?",
+			"UPDATE notes SET title = $1, content = $2 WHERE id = $3 AND user_id = $4"},
+		{"SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{`SELECT "odd?col" FROM t WHERE a = ? AND b = 'it''s?'`, `SELECT "odd?col" FROM t WHERE a = $1 AND b = 'it''s?'`},
+	} {
+		if got := rebind(tc.in); got != tc.want {
+			t.Errorf("rebind(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestDialects(t *testing.T) {
+	const ddl = "CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY, at DATETIME(6))"
+	my, pg := dialects["mysql"], dialects["postgres"]
+	if my.driver != "mysql" || my.returning() != "" || my.ddl(ddl) != ddl {
+		t.Errorf("mysql dialect: driver %q, returning %q, ddl %q", my.driver, my.returning(), my.ddl(ddl))
+	}
+	if want := "CREATE TABLE t (id SERIAL PRIMARY KEY, at TIMESTAMP(6))"; pg.ddl(ddl) != want {
+		t.Errorf("postgres ddl = %q, want %q", pg.ddl(ddl), want)
+	}
+	if pg.returning() != " RETURNING id" {
+		t.Errorf("postgres returning = %q", pg.returning())
+	}
+}
+
+// recordingConn is a driver.Conn that notes the queries it's handed.
+type recordingConn struct {
+	driver.Conn
+	queries []string
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	c.queries = append(c.queries, query)
+	return nil, errors.New("not implemented")
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.queries = append(c.queries, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.queries = append(c.queries, query)
+	return nil, errors.New("not implemented")
+}
+
+func TestRebindConn(t *testing.T) {
+	rec := &recordingConn{}
+	c := rebindConn{rec}
+	c.Prepare("SELECT ? + ?")
+	c.PrepareContext(t.Context(), "SELECT ?")
+	c.ExecContext(t.Context(), "DELETE FROM t WHERE id = ?", nil)
+	c.QueryContext(t.Context(), "SELECT a FROM t WHERE b = ? AND c = ?", nil)
+	want := []string{"SELECT $1 + $2", "SELECT $1", "DELETE FROM t WHERE id = $1", "SELECT a FROM t WHERE b = $1 AND c = $2"}
+	if !slices.Equal(rec.queries, want) {
+		t.Errorf("queries = %q, want %q", rec.queries, want)
+	}
+}
+
+func TestDBDriverConfig(t *testing.T) {
+	t.Setenv("TODO_DB_DSN", "")
+	t.Setenv("DB_DRIVER", "")
+	if cfg, err := LoadConfig(); err != nil || cfg.DBDriver != "mysql" || cfg.DSN != defaultDSN {
+		t.Errorf("default: driver %q, DSN %q, err %v", cfg.DBDriver, cfg.DSN, err)
+	}
+	t.Setenv("DB_DRIVER", "postgres")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("postgres without TODO_DB_DSN was accepted")
+	}
+	t.Setenv("TODO_DB_DSN", "postgres://localhost/todo")
+	if cfg, err := LoadConfig(); err != nil || cfg.DBDriver != "postgres" {
+		t.Errorf("postgres: driver %q, err %v", cfg.DBDriver, err)
+	}
+	t.Setenv("DB_DRIVER", "sqlite")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("DB_DRIVER=sqlite was accepted")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import "strings"
+
+// maxDiffCells bounds the LCS table diffLines will build. Past it, the
+// differing middle of the two texts is reported as removed then added in
+// full rather than aligned line by line.
+const maxDiffCells = 4_000_000
+
+// DiffLine is one line of a diff. Op is "equal", "added" or "removed".
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// splitLines breaks text into lines without their terminators. Empty text
+// has no lines, and a trailing newline doesn't start an extra empty one.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines compares a and b line by line using a longest common
+// subsequence, so unchanged lines come back as "equal" and everything else
+// as "removed" (only in a) or "added" (only in b). Removals are listed
+// before the additions that replace them.
+func diffLines(a, b string) []DiffLine {
+	x, y := splitLines(a), splitLines(b)
+
+	// Common prefix and suffix never need the table.
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+
+	out := make([]DiffLine, 0, len(x)+len(y))
+	for _, line := range x[:pre] {
+		out = append(out, DiffLine{"equal", line})
+	}
+	out = append(out, diffMiddle(x[pre:len(x)-suf], y[pre:len(y)-suf])...)
+	for _, line := range x[len(x)-suf:] {
+		out = append(out, DiffLine{"equal", line})
+	}
+	return out
+}
+
+// diffMiddle is the LCS step of diffLines, run on what's left once the
+// shared prefix and suffix are trimmed.
+func diffMiddle(x, y []string) []DiffLine {
+	var out []DiffLine
+	if len(x)*len(y) > maxDiffCells {
+		for _, line := range x {
+			out = append(out, DiffLine{"removed", line})
+		}
+		for _, line := range y {
+			out = append(out, DiffLine{"added", line})
+		}
+		return out
+	}
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			out = append(out, DiffLine{"equal", x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{"removed", x[i]})
+			i++
+		default:
+			out = append(out, DiffLine{"added", y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		out = append(out, DiffLine{"removed", x[i]})
+	}
+	for ; j < len(y); j++ {
+		out = append(out, DiffLine{"added", y[j]})
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	eq := func(s string) DiffLine { return DiffLine{"equal", s} }
+	add := func(s string) DiffLine { return DiffLine{"added", s} }
+	del := func(s string) DiffLine { return DiffLine{"removed", s} }
+
+	for _, tc := range []struct {
+		name string
+		a, b string
+		want []DiffLine
+	}{
+		{"unchanged", "one\ntwo\n", "one\ntwo\n", []DiffLine{eq("one"), eq("two")}},
+		{"both empty", "", "", []DiffLine{}},
+		{"added line", "one\nthree", "one\ntwo\nthree", []DiffLine{eq("one"), add("two"), eq("three")}},
+		{"removed line", "one\ntwo\nthree", "one\nthree", []DiffLine{eq("one"), del("two"), eq("three")}},
+		{"from empty", "", "new", []DiffLine{add("new")}},
+		{"to empty", "old\n", "", []DiffLine{del("old")}},
+		{"changed line", "a\nb\nc", "a\nB\nc", []DiffLine{eq("a"), del("b"), add("B"), eq("c")}},
+		{"interleaved", "a\nb\nc\nd", "b\nx\nd\ny", []DiffLine{del("a"), eq("b"), del("c"), add("x"), eq("d"), add("y")}},
+		// Line endings aren't content.
+		{"crlf", "one\r\ntwo\r\n", "one\ntwo", []DiffLine{eq("one"), eq("two")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := diffLines(tc.a, tc.b); !slices.Equal(got, tc.want) {
+				t.Fatalf("diffLines(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestDiffLinesTooBig checks a middle past maxDiffCells comes back as a
+// block removal then addition, with the shared ends still equal.
+func TestDiffLinesTooBig(t *testing.T) {
+	n := 2100 // n*n > maxDiffCells
+	var x, y []string
+	for i := 0; i < n; i++ {
+		x = append(x, "x"+strings.Repeat("-", i%7))
+		y = append(y, "y"+strings.Repeat("-", i%7))
+	}
+	a := "head\n" + strings.Join(x, "\n") + "\ntail"
+	b := "head\n" + strings.Join(y, "\n") + "\ntail"
+
+	got := diffLines(a, b)
+	if len(got) != 2*n+2 {
+		t.Fatalf("%d lines, want %d", len(got), 2*n+2)
+	}
+	if got[0] != (DiffLine{"equal", "head"}) || got[len(got)-1] != (DiffLine{"equal", "tail"}) {
+		t.Fatalf("ends = %v, %v", got[0], got[len(got)-1])
+	}
+	for i, line := range got[1 : len(got)-1] {
+		want := "removed"
+		if i >= n {
+			want = "added"
+		}
+		if line.Op != want {
+			t.Fatalf("line %d op = %q, want %q", i+1, line.Op, want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// dueNotesHandler lists the user's unarchived notes due before ?before=,
+// soonest first. Notes without a due date are never included.
+func dueNotesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+
+	v := r.URL.Query().Get("before")
+	if v == "" {
+		http.Error(w, "before is required", http.StatusBadRequest)
+		return
+	}
+	before, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		http.Error(w, "before must be an RFC3339 timestamp", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT `+noteColumns+` FROM notes
+		WHERE user_id = ? AND archived = FALSE AND due_at IS NOT NULL AND due_at < ?
+		ORDER BY due_at ASC, id ASC`,
+		userID, before,
+	)
+	if err != nil {
+		requestLog(r).Error("dueNotes query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	notes := []Note{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			requestLog(r).Error("dueNotes scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		notes = append(notes, n)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
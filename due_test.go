@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNoteDueAt(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	note := c.createNote(map[string]string{"title": "call", "due_at": "2030-01-02T15:04:05+02:00"})
+	if want := time.Date(2030, 1, 2, 13, 4, 5, 0, time.UTC); note.DueAt == nil || !note.DueAt.Equal(want) {
+		t.Fatalf("due_at = %v, want %v", note.DueAt, want)
+	}
+	wantFieldErrors(t, c.do("POST", "/notes", map[string]string{"title": "x", "due_at": "tomorrow"}), "due_at")
+
+	path := fmt.Sprintf("/notes/%d", note.ID)
+	var got Note
+	resp := c.do("PUT", path, map[string]string{"title": "call"})
+	wantStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &got)
+	if got.DueAt == nil {
+		t.Fatal("omitting due_at cleared it")
+	}
+	resp = c.do("PUT", path, map[string]string{"title": "call", "due_at": ""})
+	wantStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &got)
+	if got.DueAt != nil {
+		t.Fatalf("due_at = %v after clearing", got.DueAt)
+	}
+}
+
+func TestDueNotes(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	later := c.createNote(map[string]string{"title": "later", "due_at": "2030-03-01T00:00:00Z"})
+	sooner := c.createNote(map[string]string{"title": "sooner", "due_at": "2030-02-01T00:00:00Z"})
+	c.createNote(map[string]string{"title": "after the cutoff", "due_at": "2031-01-01T00:00:00Z"})
+	c.createNote(map[string]string{"title": "undated"})
+	archived := c.createNote(map[string]string{"title": "archived", "due_at": "2030-01-01T00:00:00Z"})
+	wantStatus(t, c.do("PATCH", fmt.Sprintf("/notes/%d/archive", archived.ID), nil), http.StatusOK)
+
+	resp := c.do("GET", "/notes/due?before=2030-12-31T00:00:00Z", nil)
+	wantStatus(t, resp, http.StatusOK)
+	var notes []Note
+	decodeBody(t, resp, &notes)
+	if ids := noteIDs(notes); !slices.Equal(ids, []int{sooner.ID, later.ID}) {
+		t.Fatalf("due notes = %v, want %v", ids, []int{sooner.ID, later.ID})
+	}
+
+	wantStatus(t, c.do("GET", "/notes/due", nil), http.StatusBadRequest)
+	wantStatus(t, c.do("GET", "/notes/due?before=soon", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// notesETag returns a weak ETag for userID's notes list, counting notes
+// shared with them when includeShared is set. It changes whenever a note is
+// created, edited or deleted; the query string is mixed in so differently
+// filtered views don't share a tag.
+func notesETag(ctx context.Context, userID int, includeShared bool, rawQuery string) (string, error) {
+	var count int
+	var lastUpdate sql.NullTime
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*), MAX(updated_at) FROM notes
+		WHERE user_id = ? OR (? AND id IN (SELECT note_id FROM note_shares WHERE shared_with_user_id = ?))`,
+		userID, includeShared, userID,
+	).Scan(&count, &lastUpdate)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%d|%s", count, lastUpdate.Time.UnixNano(), rawQuery)))
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`, nil
+}
+
+// etagMatches reports whether an If-None-Match header matches etag using
+// weak comparison, as RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIfMatch reads an If-Match header of note ETags, the quoted versions
+// getNoteHandler sends. It returns nil for "*", which any version matches.
+func parseIfMatch(header string) ([]int, error) {
+	if strings.TrimSpace(header) == "*" {
+		return nil, nil
+	}
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(tag, `"`), `"`))
+		if err != nil || len(tag) < 3 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			return nil, errors.New(`invalid If-Match: want "*" or quoted note versions such as "3"`)
+		}
+		versions = append(versions, n)
+	}
+	return versions, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestETagMatches(t *testing.T) {
+	const etag = `W/"abc"`
+	for _, tt := range []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`"xyz", W/"abc"`, true},
+		{`"xyz"`, false},
+		{"*", true},
+	} {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestNotesListConditionalGet(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "a"})
+
+	resp := c.do("GET", "/notes", nil)
+	wantStatus(t, resp, http.StatusOK)
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on the list")
+	}
+	wantStatus(t, c.do("GET", "/notes", nil, "If-None-Match", etag), http.StatusNotModified)
+
+	// Other filters are other representations.
+	resp = c.do("GET", "/notes?archived=true", nil, "If-None-Match", etag)
+	wantStatus(t, resp, http.StatusOK)
+
+	// Any write changes the tag.
+	wantStatus(t, c.do("PUT", fmt.Sprintf("/notes/%d", note.ID), map[string]string{"title": "b"}), http.StatusOK)
+	resp = c.do("GET", "/notes", nil, "If-None-Match", etag)
+	wantStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("ETag") == etag {
+		t.Fatal("ETag unchanged after an edit")
+	}
+	etag = resp.Header.Get("ETag")
+	c.createNote(map[string]string{"title": "c"})
+	wantStatus(t, c.do("GET", "/notes", nil, "If-None-Match", etag), http.StatusOK)
+}
+
+func TestParseIfMatch(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   []int
+		ok     bool
+	}{
+		{"*", nil, true},
+		{` * `, nil, true},
+		{`"3"`, []int{3}, true},
+		{`W/"3"`, []int{3}, true},
+		{`"3", "5"`, []int{3, 5}, true},
+		{`3`, nil, false},
+		{`"three"`, nil, false},
+		{`"3", *`, nil, false},
+		{`""`, nil, false},
+	} {
+		got, err := parseIfMatch(tc.header)
+		if (err == nil) != tc.ok || !slices.Equal(got, tc.want) {
+			t.Errorf("parseIfMatch(%q) = %v, %v; want %v, ok %v", tc.header, got, err, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportFlushEvery is how many notes are written between flushes, so a long
+// export reaches the client steadily instead of in one burst at the end.
+const exportFlushEvery = 500
+
+// exportCSVHeader is the first row of a CSV export.
+var exportCSVHeader = []string{"id", "title", "content", "content_type", "archived", "done", "pinned", "starred", "color", "notebook_id", "due_at", "position", "created_at", "updated_at"}
+
+// exportNotesHandler streams every note the user owns, archived ones
+// included, as a JSON array (the default) or, with ?format=csv, as CSV.
+// Rows are encoded straight off the cursor, so memory use doesn't grow with
+// the size of the account.
+func exportNotesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "csv":
+	default:
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), `SELECT `+noteColumns+` FROM notes WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		requestLog(r).Error("exportNotes query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="notes.`+format+`"`)
+
+	// From here on the status line has gone out, so a failure can only be
+	// logged; the truncated body (an unterminated JSON array, a short CSV)
+	// tells the client the export is incomplete.
+	rc := http.NewResponseController(w)
+	var cw *csv.Writer
+	if format == "csv" {
+		cw = csv.NewWriter(w)
+		cw.Write(exportCSVHeader)
+	} else {
+		w.Write([]byte("["))
+	}
+
+	n := 0
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			requestLog(r).Error("exportNotes scan", "err", err)
+			return
+		}
+		if cw != nil {
+			err = cw.Write(noteCSVRecord(note))
+		} else {
+			err = writeExportJSON(w, note, n == 0)
+		}
+		if err != nil {
+			requestLog(r).Error("exportNotes write", "err", err)
+			return
+		}
+		n++
+		if n%exportFlushEvery == 0 {
+			if cw != nil {
+				cw.Flush()
+			}
+			rc.Flush()
+			// Keep a large export that is still making progress from
+			// hitting the server's write timeout.
+			if serverTimeouts.Write > 0 {
+				rc.SetWriteDeadline(time.Now().Add(serverTimeouts.Write))
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(r).Error("exportNotes rows", "err", err)
+		return
+	}
+
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			requestLog(r).Error("exportNotes write", "err", err)
+		}
+		return
+	}
+	w.Write([]byte("]\n"))
+}
+
+// writeExportJSON writes one element of the exported JSON array. Exports
+// keep snake_case keys even with JSON_FIELD_CASE=camel, so they can be
+// imported and restored anywhere.
+func writeExportJSON(w io.Writer, note Note, first bool) error {
+	b, err := note.snakeJSON()
+	if err != nil {
+		return err
+	}
+	if !first {
+		if _, err := w.Write([]byte(",")); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// noteCSVRecord lays a note out in exportCSVHeader order. Times are RFC 3339
+// in UTC; a missing notebook or due date is an empty cell.
+func noteCSVRecord(n Note) []string {
+	var notebookID, dueAt string
+	if n.NotebookID != nil {
+		notebookID = strconv.Itoa(*n.NotebookID)
+	}
+	if n.DueAt != nil {
+		dueAt = n.DueAt.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		strconv.Itoa(n.ID),
+		n.Title,
+		n.Content,
+		n.ContentType,
+		strconv.FormatBool(n.Archived),
+		strconv.FormatBool(n.Done),
+		strconv.FormatBool(n.Pinned),
+		strconv.FormatBool(n.Starred),
+		n.Color,
+		notebookID,
+		dueAt,
+		strconv.Itoa(n.Position),
+		n.CreatedAt.UTC().Format(time.RFC3339Nano),
+		n.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNoteCSVRecord(t *testing.T) {
+	local := time.FixedZone("UTC+2", 2*3600)
+	notebook := 7
+	n := Note{
+		ID: 3, Title: "a, b", Content: "line\n\"quoted\"", ContentType: "plain", Done: true, Color: "red",
+		NotebookID: &notebook, Position: 2,
+		CreatedAt: time.Date(2030, 1, 2, 5, 0, 0, 0, local),
+		UpdatedAt: time.Date(2030, 1, 2, 6, 0, 0, 0, local),
+	}
+	rec := noteCSVRecord(n)
+	if len(rec) != len(exportCSVHeader) {
+		t.Fatalf("%d cells, header has %d", len(rec), len(exportCSVHeader))
+	}
+	want := []string{"3", "a, b", "line\n\"quoted\"", "plain", "false", "true", "false", "false", "red", "7", "", "2", "2030-01-02T03:00:00Z", "2030-01-02T04:00:00Z"}
+	for i := range want {
+		if rec[i] != want[i] {
+			t.Errorf("%s = %q, want %q", exportCSVHeader[i], rec[i], want[i])
+		}
+	}
+}
+
+// flushCounter is a ResponseWriter that throws the body away, recording
+// how much had been written at each flush.
+type flushCounter struct {
+	header  http.Header
+	written int
+	flushes []int
+}
+
+func (f *flushCounter) Header() http.Header         { return f.header }
+func (f *flushCounter) WriteHeader(int)             {}
+func (f *flushCounter) Write(b []byte) (int, error) { f.written += len(b); return len(b), nil }
+func (f *flushCounter) Flush()                      { f.flushes = append(f.flushes, f.written) }
+
+// insertNotes adds n notes for userID in a few multi-row INSERTs, much
+// faster than going through the API.
+func insertNotes(t *testing.T, userID, n int) {
+	t.Helper()
+	const chunk = 500
+	for done := 0; done < n; done += chunk {
+		var values []string
+		var args []interface{}
+		for i := done; i < n && i < done+chunk; i++ {
+			values = append(values, "(?, ?, ?)")
+			args = append(args, userID, fmt.Sprintf("note %d", i), strings.Repeat("x", 200))
+		}
+		if _, err := db.Exec(`INSERT INTO notes (user_id, title, content) VALUES `+strings.Join(values, ", "), args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExportLarge(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+	const total = 5*exportFlushEvery + 17
+	insertNotes(t, userID, total)
+
+	resp := c.do("GET", "/notes/export", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, "notes.json") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	// Decode element by element, as a client would.
+	dec := json.NewDecoder(resp.Body)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		t.Fatalf("first token %v, %v", tok, err)
+	}
+	count, lastID := 0, 0
+	for dec.More() {
+		var n Note
+		if err := dec.Decode(&n); err != nil {
+			t.Fatalf("note %d: %v", count, err)
+		}
+		if n.ID <= lastID {
+			t.Fatalf("note %d out of order after %d", n.ID, lastID)
+		}
+		lastID = n.ID
+		count++
+	}
+	resp.Body.Close()
+	if count != total {
+		t.Fatalf("exported %d notes, want %d", count, total)
+	}
+
+	resp = c.do("GET", "/notes/export?format=csv", nil)
+	wantStatus(t, resp, http.StatusOK)
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != total+1 || strings.Join(records[0], ",") != strings.Join(exportCSVHeader, ",") {
+		t.Fatalf("CSV has %d rows, header %v", len(records), records[0])
+	}
+	wantStatus(t, c.do("GET", "/notes/export?format=xml", nil), http.StatusBadRequest)
+
+	// Row by row: the response is flushed every exportFlushEvery notes,
+	// each time with about that many notes' worth more written, rather
+	// than all at once at the end.
+	w := &flushCounter{header: http.Header{}}
+	r := httptest.NewRequest("GET", "/notes/export", nil)
+	r = r.WithContext(context.WithValue(r.Context(), userIDKey, userID))
+	exportNotesHandler(w, r)
+	if len(w.flushes) != total/exportFlushEvery {
+		t.Fatalf("%d flushes, want %d", len(w.flushes), total/exportFlushEvery)
+	}
+	if first := w.flushes[0]; first*4 > w.written {
+		t.Errorf("%d of %d bytes were written before the first flush", first, w.written)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// noteFields are the names GET /notes?fields= may ask for: every key of a
+// note's JSON, including the computed counts.
+var noteFields = map[string]bool{
+	"id": true, "user_id": true, "title": true, "content": true, "content_type": true,
+	"archived": true, "done": true, "pinned": true, "starred": true, "color": true,
+	"notebook_id": true, "due_at": true, "position": true, "version": true,
+	"view_count": true, "read_only": true, "created_at": true, "updated_at": true,
+	"char_count": true, "word_count": true,
+}
+
+// parseNoteFields splits a comma-separated ?fields= value, rejecting names
+// that aren't in noteFields. With jsonCamelCase the camelCase spellings are
+// accepted too. Blank entries and repeats are ignored.
+func parseNoteFields(v string) ([]string, error) {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if jsonCamelCase && !noteFields[name] && noteFields[camelToSnake(name)] {
+			name = camelToSnake(name)
+		}
+		if seen[name] {
+			continue
+		}
+		if !noteFields[name] {
+			return nil, errors.New("unknown field " + name)
+		}
+		seen[name] = true
+		fields = append(fields, name)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("fields lists no fields")
+	}
+	return fields, nil
+}
+
+// selectNoteFields returns notes as JSON objects holding only fields. Each
+// note is encoded in full first, so the values match what the unrestricted
+// list would have sent.
+func selectNoteFields(notes []Note, fields []string) ([]map[string]json.RawMessage, error) {
+	out := make([]map[string]json.RawMessage, 0, len(notes))
+	for _, n := range notes {
+		b, err := json.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(b, &all); err != nil {
+			return nil, err
+		}
+		picked := make(map[string]json.RawMessage, len(fields))
+		for _, name := range fields {
+			key := jsonFieldName(name)
+			picked[key] = all[key]
+		}
+		out = append(out, picked)
+	}
+	return out, nil
+}
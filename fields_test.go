@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestNoteFieldsCoverNote keeps the allowlist in step with the keys a note
+// is actually sent with.
+func TestNoteFieldsCoverNote(t *testing.T) {
+	b, err := json.Marshal(Note{ID: 1, Title: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		t.Fatal(err)
+	}
+	for k := range keys {
+		if !noteFields[k] {
+			t.Errorf("note key %s can't be asked for", k)
+		}
+	}
+	for k := range noteFields {
+		if _, ok := keys[k]; !ok {
+			t.Errorf("noteFields allows %s, which notes don't have", k)
+		}
+	}
+}
+
+func TestParseNoteFields(t *testing.T) {
+	for in, want := range map[string][]string{
+		"id,title":      {"id", "title"},
+		" title , id ,": {"title", "id"},
+		"id,id,title":   {"id", "title"},
+		"word_count":    {"word_count"},
+	} {
+		got, err := parseNoteFields(in)
+		if err != nil || !slices.Equal(got, want) {
+			t.Errorf("parseNoteFields(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for in, msg := range map[string]string{
+		"id,password": "unknown field password",
+		"Title":       "unknown field Title",
+		",,":          "fields lists no fields",
+	} {
+		if _, err := parseNoteFields(in); err == nil || err.Error() != msg {
+			t.Errorf("parseNoteFields(%q) err = %v, want %q", in, err, msg)
+		}
+	}
+}
+
+func TestSelectNoteFields(t *testing.T) {
+	notes := []Note{{ID: 1, Title: "a", Content: "one two"}, {ID: 2, Title: "b"}}
+	got, err := selectNoteFields(notes, []string{"id", "word_count"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(got)
+	if want := `[{"id":1,"word_count":2},{"id":2,"word_count":0}]`; string(b) != want {
+		t.Fatalf("selected = %s, want %s", b, want)
+	}
+
+	old := jsonCamelCase
+	t.Cleanup(func() { jsonCamelCase = old })
+	jsonCamelCase = true
+	fields, err := parseNoteFields("id,createdAt,user_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = selectNoteFields(notes[:1], fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got[0]["createdAt"]; !ok || len(got[0]) != 3 {
+		t.Fatalf("camelCase selection = %v", got[0])
+	}
+}
+
+func TestNotesFieldsParam(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	c.createNote(map[string]string{"title": "short", "content": "a long body the phone doesn't need"})
+
+	resp := c.do("GET", "/notes?fields=id,title", nil)
+	wantStatus(t, resp, http.StatusOK)
+	body := readBody(t, resp)
+	var notes []map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &notes); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || len(notes[0]) != 2 || notes[0]["title"] != "short" || notes[0]["id"] == nil {
+		t.Fatalf("fields=id,title: %s", body)
+	}
+	if strings.Contains(body, "content") {
+		t.Fatalf("content sent anyway: %s", body)
+	}
+
+	// Paged, the notes inside the page are trimmed the same way.
+	resp = c.do("GET", "/notes?fields=title&limit=1", nil)
+	wantStatus(t, resp, http.StatusOK)
+	var page struct {
+		Notes []map[string]interface{} `json:"notes"`
+	}
+	decodeBody(t, resp, &page)
+	if len(page.Notes) != 1 || len(page.Notes[0]) != 1 {
+		t.Fatalf("paged fields=title: %v", page.Notes)
+	}
+}
+
+func TestNotesFieldsRejected(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	for v, msg := range map[string]string{"id,secret": "unknown field secret", ",": "fields lists no fields"} {
+		resp := c.do("GET", "/notes?fields="+v, nil)
+		wantStatus(t, resp, http.StatusBadRequest)
+		if body := readBody(t, resp); !strings.Contains(body, msg) {
+			t.Errorf("fields=%s: body %q, want %q", v, body, msg)
+		}
+	}
+}
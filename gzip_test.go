@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveGzip runs body through gzipMiddleware as contentType, written in
+// small chunks, for a client sending acceptEncoding.
+func serveGzip(t *testing.T, contentType, acceptEncoding string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	h := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		for b := body; len(b) > 0; {
+			n := min(len(b), 100)
+			w.Write(b[:n])
+			b = b[n:]
+		}
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	if acceptEncoding != "" {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestGzipLargeJSON(t *testing.T) {
+	body := []byte(`[` + strings.Repeat(`{"title":"a note","content":"some text"},`, 200) + `{}]`)
+	w := serveGzip(t, "application/json", "gzip, deflate", body)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", w.Header().Get("Content-Encoding"))
+	}
+	if w.Body.Len() >= len(body) {
+		t.Errorf("compressed to %d bytes from %d", w.Body.Len(), len(body))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("truncated gzip stream: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatal("decompressed body differs from the original")
+	}
+}
+
+func TestGzipSkipped(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 2*gzipMinSize)
+	for _, tc := range []struct {
+		name, contentType, accept string
+		body                      []byte
+	}{
+		{"not accepted", "application/json", "", large},
+		{"refused with q=0", "application/json", "gzip;q=0", large},
+		{"small", "application/json", "gzip", []byte(`{"ok":true}`)},
+		{"already compressed", "image/png", "gzip", large},
+	} {
+		w := serveGzip(t, tc.contentType, tc.accept, tc.body)
+		if ce := w.Header().Get("Content-Encoding"); ce != "" {
+			t.Errorf("%s: Content-Encoding = %q, want none", tc.name, ce)
+		}
+		if !bytes.Equal(w.Body.Bytes(), tc.body) {
+			t.Errorf("%s: body altered", tc.name)
+		}
+		if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+			t.Errorf("%s: Vary = %q", tc.name, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                false,
+		"gzip":            true,
+		"GZIP":            true,
+		"br, gzip;q=0.5":  true,
+		"gzip;q=0":        false,
+		"*":               true,
+		"deflate, br":     false,
+		"identity, *;q=0": false,
+	} {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// healthPingTimeout bounds the database check in /readyz and /health.
+const healthPingTimeout = 2 * time.Second
+
+// serverReady is set once startup has finished: schema, prepared
+// statements and everything else main does before it starts listening.
+var serverReady atomic.Bool
+
+// The probes below need no login and aren't subject to the in-flight
+// limit, so an orchestrator still gets an answer while the server is
+// shedding load.
+
+// livezHandler is the liveness probe: it answers 200 as long as the
+// process can serve HTTP at all, and never looks at the database, so a
+// database outage doesn't get every instance restarted.
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	if !healthMethod(w, r) {
+		return
+	}
+	writeHealth(w, r, http.StatusOK, "ok")
+}
+
+// readyzHandler is the readiness probe: 503 until startup has finished
+// and whenever the database can't be reached, so traffic is only routed
+// to instances that can serve it.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !healthMethod(w, r) {
+		return
+	}
+	if !serverReady.Load() {
+		writeHealth(w, r, http.StatusServiceUnavailable, "starting")
+		return
+	}
+	if !pingDB(r) {
+		writeHealth(w, r, http.StatusServiceUnavailable, "unavailable")
+		return
+	}
+	writeHealth(w, r, http.StatusOK, "ok")
+}
+
+// healthHandler is the combined check for people and simple monitors:
+// 200 {"status":"ok"} or 503 {"status":"unavailable"} when the database
+// can't be reached.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if !healthMethod(w, r) {
+		return
+	}
+	if !pingDB(r) {
+		writeHealth(w, r, http.StatusServiceUnavailable, "unavailable")
+		return
+	}
+	writeHealth(w, r, http.StatusOK, "ok")
+}
+
+// healthMethod allows GET and HEAD, answering 405 otherwise.
+func healthMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return false
+	}
+	return true
+}
+
+// pingDB reports whether the database answers within healthPingTimeout.
+func pingDB(r *http.Request) bool {
+	ctx, cancel := context.WithTimeout(r.Context(), healthPingTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		requestLog(r).Error("health ping", "err", err)
+		return false
+	}
+	return true
+}
+
+func writeHealth(w http.ResponseWriter, r *http.Request, code int, status string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
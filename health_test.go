@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+)
+
+// useServerReady sets serverReady for one test.
+func useServerReady(t *testing.T, ready bool) {
+	t.Helper()
+	old := serverReady.Load()
+	t.Cleanup(func() { serverReady.Store(old) })
+	serverReady.Store(ready)
+}
+
+// useUnreachableDB points db at a server that isn't there, for one test.
+func useUnreachableDB(t *testing.T) {
+	t.Helper()
+	// sql.Open doesn't connect; the ping is what fails.
+	d, err := sql.Open("mysql", "test@tcp(127.0.0.1:1)/test?timeout=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := db
+	t.Cleanup(func() { d.Close(); db = old })
+	db = d
+}
+
+// wantHealth checks a probe's status code and {"status": ...} body.
+func wantHealth(t *testing.T, c *testClient, path string, code int, status string) {
+	t.Helper()
+	resp := c.do("GET", path, nil)
+	wantStatus(t, resp, code)
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("%s: Cache-Control = %q", path, cc)
+	}
+	var body map[string]string
+	decodeBody(t, resp, &body)
+	if body["status"] != status {
+		t.Errorf("%s: status %q, want %q", path, body["status"], status)
+	}
+}
+
+func TestProbesWithoutDatabase(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	useUnreachableDB(t)
+	c := newTestClient(t, a.routes())
+
+	useServerReady(t, false)
+	wantHealth(t, c, "/livez", http.StatusOK, "ok")
+	wantHealth(t, c, "/readyz", http.StatusServiceUnavailable, "starting")
+
+	serverReady.Store(true)
+	wantHealth(t, c, "/livez", http.StatusOK, "ok")
+	wantHealth(t, c, "/readyz", http.StatusServiceUnavailable, "unavailable")
+	wantHealth(t, c, "/health", http.StatusServiceUnavailable, "unavailable")
+
+	for _, path := range []string{"/livez", "/readyz", "/health"} {
+		resp := c.do("HEAD", path, nil)
+		if resp.StatusCode == http.StatusMethodNotAllowed || readBody(t, resp) != "" {
+			t.Errorf("HEAD %s: status %d", path, resp.StatusCode)
+		}
+		wantStatus(t, c.do("POST", path, nil), http.StatusMethodNotAllowed)
+	}
+}
+
+func TestProbesWithDatabase(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	useServerReady(t, true)
+	wantHealth(t, c, "/livez", http.StatusOK, "ok")
+	wantHealth(t, c, "/readyz", http.StatusOK, "ok")
+	wantHealth(t, c, "/health", http.StatusOK, "ok")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultLang is what error messages fall back to when the client asks for
+// nothing we have, or for a message with no translation.
+const defaultLang = "en"
+
+// messageID names an error message in the catalog. writeJSONError sends it
+// as "code", which stays the same whatever language the text is in, so
+// clients should match on it rather than on the message.
+type messageID string
+
+const (
+	msgNotFound                messageID = "not_found"
+	msgMethodNotAllowed        messageID = "method_not_allowed"
+	msgInternal                messageID = "internal_error"
+	msgServerBusy              messageID = "server_busy"
+	msgUnsupportedMediaType    messageID = "unsupported_media_type"
+	msgBodyTooLarge            messageID = "body_too_large"
+	msgBodyEmpty               messageID = "body_empty"
+	msgInvalidJSON             messageID = "invalid_json"
+	msgUnknownField            messageID = "unknown_field"
+	msgJSONTooDeep             messageID = "json_too_deep"
+	msgInvalidID               messageID = "invalid_id"
+	msgUnauthorized            messageID = "unauthorized"
+	msgInvalidSession          messageID = "invalid_session"
+	msgInvalidCredentials      messageID = "invalid_credentials"
+	msgInvalidAPIKey           messageID = "invalid_api_key"
+	msgPasswordIncorrect       messageID = "password_incorrect"
+	msgUsernameTaken           messageID = "username_taken"
+	msgAdminOnly               messageID = "admin_only"
+	msgTooManyLogins           messageID = "too_many_logins"
+	msgTooManySessions         messageID = "too_many_sessions"
+	msgNoteNotFound            messageID = "note_not_found"
+	msgNoteNotFoundOrForbidden messageID = "note_not_found_or_unauthorized"
+	msgNotebookNotFound        messageID = "notebook_not_found"
+	msgTemplateNotFound        messageID = "template_not_found"
+	msgRevisionNotFound        messageID = "revision_not_found"
+	msgAttachmentNotFound      messageID = "attachment_not_found"
+	msgShareNotFound           messageID = "share_not_found"
+	msgCollaboratorNotFound    messageID = "collaborator_not_found"
+	msgWebhookNotFound         messageID = "webhook_not_found"
+	msgAPIKeyNotFound          messageID = "api_key_not_found"
+	msgIfMatchFailed           messageID = "if_match_failed"
+	msgVersionConflict         messageID = "version_conflict"
+	msgTooManyPins             messageID = "too_many_pins"
+	msgTooManyWebhooks         messageID = "too_many_webhooks"
+	msgTooManyNotes            messageID = "too_many_notes"
+	msgNoteBurstTooLarge       messageID = "note_burst_too_large"
+)
+
+// messages holds each message's text by language, as fmt formats for the
+// arguments writeJSONError is given. Every entry has an "en" text; other
+// languages may be missing, in which case English is used.
+var messages = map[messageID]map[string]string{
+	msgNotFound:                {"en": "not found", "es": "no encontrado"},
+	msgMethodNotAllowed:        {"en": "method not allowed", "es": "método no permitido"},
+	msgInternal:                {"en": "internal server error", "es": "error interno del servidor"},
+	msgServerBusy:              {"en": "server busy, try again shortly", "es": "servidor ocupado, inténtalo de nuevo en breve"},
+	msgUnsupportedMediaType:    {"en": "Content-Type must be application/json", "es": "el Content-Type debe ser application/json"},
+	msgBodyTooLarge:            {"en": "request body too large", "es": "el cuerpo de la petición es demasiado grande"},
+	msgBodyEmpty:               {"en": "request body is empty", "es": "el cuerpo de la petición está vacío"},
+	msgInvalidJSON:             {"en": "invalid JSON", "es": "JSON no válido"},
+	msgUnknownField:            {"en": "unknown field %s", "es": "campo desconocido %s"},
+	msgJSONTooDeep:             {"en": "JSON nested more than %d levels deep", "es": "JSON anidado en más de %d niveles"},
+	msgInvalidID:               {"en": "invalid id", "es": "id no válido"},
+	msgUnauthorized:            {"en": "unauthorized", "es": "no autorizado"},
+	msgInvalidSession:          {"en": "invalid session", "es": "sesión no válida"},
+	msgInvalidCredentials:      {"en": "invalid credentials", "es": "credenciales no válidas"},
+	msgInvalidAPIKey:           {"en": "invalid API key", "es": "clave de API no válida"},
+	msgPasswordIncorrect:       {"en": "password is incorrect", "es": "la contraseña es incorrecta"},
+	msgUsernameTaken:           {"en": "username already taken", "es": "el nombre de usuario ya está en uso"},
+	msgAdminOnly:               {"en": "admin only", "es": "solo para administradores"},
+	msgTooManyLogins:           {"en": "too many failed logins, try again later", "es": "demasiados inicios de sesión fallidos, inténtalo más tarde"},
+	msgTooManySessions:         {"en": "too many active sessions; log out elsewhere first", "es": "demasiadas sesiones activas; cierra sesión en otro lugar primero"},
+	msgNoteNotFound:            {"en": "note not found", "es": "nota no encontrada"},
+	msgNoteNotFoundOrForbidden: {"en": "note not found or unauthorized", "es": "nota no encontrada o sin autorización"},
+	msgNotebookNotFound:        {"en": "notebook not found or unauthorized", "es": "cuaderno no encontrado o sin autorización"},
+	msgTemplateNotFound:        {"en": "template not found or unauthorized", "es": "plantilla no encontrada o sin autorización"},
+	msgRevisionNotFound:        {"en": "revision not found", "es": "revisión no encontrada"},
+	msgAttachmentNotFound:      {"en": "attachment not found", "es": "adjunto no encontrado"},
+	msgShareNotFound:           {"en": "share not found", "es": "enlace compartido no encontrado"},
+	msgCollaboratorNotFound:    {"en": "collaborator not found", "es": "colaborador no encontrado"},
+	msgWebhookNotFound:         {"en": "webhook not found", "es": "webhook no encontrado"},
+	msgAPIKeyNotFound:          {"en": "API key not found", "es": "clave de API no encontrada"},
+	msgIfMatchFailed:           {"en": "note is at version %d, which If-Match doesn't list", "es": "la nota está en la versión %d, que If-Match no incluye"},
+	msgVersionConflict:         {"en": "note was modified since version %d", "es": "la nota se modificó después de la versión %d"},
+	msgTooManyPins:             {"en": "at most %d notes can be pinned", "es": "se pueden fijar como máximo %d notas"},
+	msgTooManyWebhooks:         {"en": "at most %d webhooks are allowed", "es": "se permiten como máximo %d webhooks"},
+	msgTooManyNotes:            {"en": "too many notes created, try again later", "es": "demasiadas notas creadas, inténtalo más tarde"},
+	msgNoteBurstTooLarge:       {"en": "can't create %d notes at once; the limit is %d per minute", "es": "no se pueden crear %d notas a la vez; el límite es %d por minuto"},
+}
+
+// supportedLangs are the languages negotiateLang will pick.
+var supportedLangs = map[string]bool{"en": true, "es": true}
+
+// localize renders message id in lang, falling back to English when lang
+// has no text for it, and reports the language it used.
+func localize(id messageID, lang string, args ...interface{}) (string, string) {
+	text, ok := messages[id][lang]
+	if !ok {
+		lang = defaultLang
+		text = messages[id][defaultLang]
+	}
+	if len(args) > 0 {
+		text = fmt.Sprintf(text, args...)
+	}
+	return text, lang
+}
+
+// negotiateLang picks the supported language the Accept-Language header
+// prefers most, matching on the primary subtag so "es-MX" selects "es".
+// Ties go to the earlier entry, and q=0 rules a language out.
+func negotiateLang(header string) string {
+	best, bestQ := defaultLang, 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if primary == "*" {
+			primary = defaultLang
+		}
+		if supportedLangs[primary] && q > bestQ {
+			best, bestQ = primary, q
+		}
+	}
+	return best
+}
+
+// localeMiddleware resolves the client's language once per request and
+// carries it on the response writer, where writeJSONError finds it.
+func localeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&localeWriter{ResponseWriter: w, lang: negotiateLang(r.Header.Get("Accept-Language"))}, r)
+	})
+}
+
+type localeWriter struct {
+	http.ResponseWriter
+	lang string
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *localeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// responseLang finds the language localeMiddleware chose for w, looking
+// through any writers wrapped around it since.
+func responseLang(w http.ResponseWriter) string {
+	for {
+		switch v := w.(type) {
+		case *localeWriter:
+			return v.lang
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return defaultLang
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestNegotiateLang(t *testing.T) {
+	for _, tc := range []struct{ header, want string }{
+		{"", "en"},
+		{"es", "es"},
+		{"es-MX", "es"},
+		{"ES", "es"},
+		{"fr, es;q=0.5", "es"},
+		{"fr, de", "en"},
+		{"en, es", "en"},
+		{"es, en", "es"},
+		{"en;q=0.4, es;q=0.8", "es"},
+		{"es;q=0, en", "en"},
+		{"es;q=0", "en"},
+		{"*", "en"},
+		{"es;q=abc, en;q=0.1", "en"},
+	} {
+		if got := negotiateLang(tc.header); got != tc.want {
+			t.Errorf("negotiateLang(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestLocalizeFallback(t *testing.T) {
+	if msg, lang := localize(msgNoteNotFound, "es"); msg != "nota no encontrada" || lang != "es" {
+		t.Errorf("es: %q, %q", msg, lang)
+	}
+	if msg, lang := localize(msgTooManyPins, "es", 3); msg != "se pueden fijar como máximo 3 notas" || lang != "es" {
+		t.Errorf("es with args: %q, %q", msg, lang)
+	}
+	if msg, lang := localize(msgTooManyPins, "fr", 3); msg != "at most 3 notes can be pinned" || lang != "en" {
+		t.Errorf("unknown language: %q, %q", msg, lang)
+	}
+
+	// A message nobody has translated yet goes out in English, and says so.
+	messages["test_untranslated"] = map[string]string{"en": "only in English"}
+	t.Cleanup(func() { delete(messages, "test_untranslated") })
+	if msg, lang := localize("test_untranslated", "es"); msg != "only in English" || lang != "en" {
+		t.Errorf("untranslated: %q, %q", msg, lang)
+	}
+}
+
+// TestMessageCatalog checks every message has English text, and that each
+// translation takes the same arguments as the English.
+func TestMessageCatalog(t *testing.T) {
+	verbs := regexp.MustCompile(`%[a-z]`)
+	for id, texts := range messages {
+		en, ok := texts[defaultLang]
+		if !ok {
+			t.Errorf("%s has no English text", id)
+			continue
+		}
+		for lang, text := range texts {
+			if !supportedLangs[lang] {
+				t.Errorf("%s: unsupported language %q", id, lang)
+			}
+			if got, want := verbs.FindAllString(text, -1), verbs.FindAllString(en, -1); !slices.Equal(got, want) {
+				t.Errorf("%s/%s takes %v, English takes %v", id, lang, got, want)
+			}
+		}
+	}
+}
+
+// errorIn makes a request with Accept-Language lang and returns the JSON
+// error it gets back.
+func errorIn(t *testing.T, c *testClient, lang, method, path string, body interface{}, status int) (msg, code, contentLang string) {
+	t.Helper()
+	resp := c.do(method, path, body, "Accept-Language", lang)
+	if v := resp.Header.Values("Vary"); !slices.Contains(v, "Accept-Language") {
+		t.Errorf("%s %s: Vary %v lacks Accept-Language", method, path, v)
+	}
+	contentLang = resp.Header.Get("Content-Language")
+	var got struct{ Error, Code string }
+	wantStatus(t, resp, status)
+	decodeBody(t, resp, &got)
+	return got.Error, got.Code, contentLang
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	for _, tc := range []struct {
+		lang, wantMsg, wantLang string
+	}{
+		{"es-ES,es;q=0.9", "nota no encontrada o sin autorización", "es"},
+		{"en-GB", "note not found or unauthorized", "en"},
+		{"fr", "note not found or unauthorized", "en"},
+		{"", "note not found or unauthorized", "en"},
+	} {
+		msg, code, lang := errorIn(t, c, tc.lang, "GET", "/notes/999999", nil, http.StatusNotFound)
+		if msg != tc.wantMsg || lang != tc.wantLang || code != string(msgNoteNotFoundOrForbidden) {
+			t.Errorf("Accept-Language %q: %q (%s) in %q, want %q in %q", tc.lang, msg, code, lang, tc.wantMsg, tc.wantLang)
+		}
+	}
+
+	// The common request errors are localized too, not just the 404s.
+	for _, tc := range []struct {
+		method, path string
+		body         interface{}
+		status       int
+		code         messageID
+		want         string
+	}{
+		{"GET", "/notes/0", nil, http.StatusBadRequest, msgInvalidID, "id no válido"},
+		{"POST", "/notes", "{", http.StatusBadRequest, msgInvalidJSON, "JSON no válido"},
+		{"POST", "/notes", "", http.StatusBadRequest, msgBodyEmpty, "el cuerpo de la petición está vacío"},
+		{"POST", "/notes", map[string]string{"colour": "red"}, http.StatusBadRequest, msgUnknownField, `campo desconocido "colour"`},
+		{"POST", "/login", map[string]string{"username": "alice", "password": "wrong password"}, http.StatusUnauthorized, msgInvalidCredentials, "credenciales no válidas"},
+	} {
+		msg, code, lang := errorIn(t, c, "es", tc.method, tc.path, tc.body, tc.status)
+		if msg != tc.want || code != string(tc.code) || lang != "es" {
+			t.Errorf("%s %s: %q (%s) in %q, want %q (%s)", tc.method, tc.path, msg, code, lang, tc.want, tc.code)
+		}
+	}
+
+	anon := c.newClient()
+	if msg, code, _ := errorIn(t, anon, "es", "GET", "/notes", nil, http.StatusUnauthorized); msg != "no autorizado" || code != string(msgUnauthorized) {
+		t.Errorf("logged out: %q (%s)", msg, code)
+	}
+}
+
+// TestInternalErrorLocalized checks a store failure answers with the
+// catalog's internal error rather than plain text.
+func TestInternalErrorLocalized(t *testing.T) {
+	a, _, users := newMemApp(t)
+	a.users = failingUserStore{users, errors.New("driver: bad connection")}
+	c := newTestClient(t, a.routes())
+	body := map[string]string{"username": "alice", "password": "correct horse battery"}
+	msg, code, lang := errorIn(t, c, "es", "POST", "/register", body, http.StatusInternalServerError)
+	if msg != "error interno del servidor" || code != string(msgInternal) || lang != "es" {
+		t.Fatalf("%q (%s) in %q", msg, code, lang)
+	}
+}
+
+// TestWriteJSONErrorWithoutMiddleware checks a handler run outside
+// localeMiddleware still answers in English.
+func TestWriteJSONErrorWithoutMiddleware(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeJSONError(w, http.StatusConflict, msgVersionConflict, int64(4))
+	msg, code := recordedError(t, w)
+	if msg != "note was modified since version 4" || code != string(msgVersionConflict) || w.Header().Get("Content-Language") != "en" {
+		t.Fatalf("%q (%s), Content-Language %q", msg, code, w.Header().Get("Content-Language"))
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const maxIdempotencyKeyLen = 255
+
+// idempotentNote returns the note previously created by userID with key, if
+// the key was used within ttl and the note still exists.
+func idempotentNote(ctx context.Context, userID int, key string, ttl time.Duration) (Note, bool, error) {
+	var noteID int
+	err := db.QueryRowContext(ctx,
+		`SELECT note_id FROM idempotency_keys WHERE user_id = ? AND idem_key = ? AND created_at > ?`,
+		userID, key, time.Now().Add(-ttl),
+	).Scan(&noteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Note{}, false, nil
+	}
+	if err != nil {
+		return Note{}, false, err
+	}
+
+	note, err := fetchNote(ctx, userID, noteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Note{}, false, nil
+	}
+	if err != nil {
+		return Note{}, false, err
+	}
+	return note, true, nil
+}
+
+// saveIdempotencyKey records key as having created noteID, replacing any
+// expired entry for the same key. It runs on ex so callers can include it in
+// the note's transaction.
+func saveIdempotencyKey(ctx context.Context, ex execer, userID int, key string, noteID int) error {
+	if _, err := ex.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = ? AND idem_key = ?`, userID, key); err != nil {
+		return err
+	}
+	_, err := ex.ExecContext(ctx,
+		`INSERT INTO idempotency_keys (user_id, idem_key, note_id, created_at) VALUES (?, ?, ?, ?)`,
+		userID, key, noteID, time.Now(),
+	)
+	return err
+}
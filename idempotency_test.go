@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotentCreate(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+	body := map[string]string{"title": "once"}
+
+	create := func(c *testClient, key string) (Note, bool) {
+		t.Helper()
+		resp := c.do("POST", "/notes", body, "Idempotency-Key", key)
+		wantStatus(t, resp, http.StatusCreated)
+		var n Note
+		decodeBody(t, resp, &n)
+		return n, resp.Header.Get("Idempotent-Replayed") == "true"
+	}
+
+	first, replayed := create(c, "k1")
+	if replayed {
+		t.Fatal("first request marked as replayed")
+	}
+	again, replayed := create(c, "k1")
+	if !replayed || again.ID != first.ID {
+		t.Fatalf("retry = note %d replayed=%v, want note %d replayed", again.ID, replayed, first.ID)
+	}
+	if other, _ := create(c, "k2"); other.ID == first.ID {
+		t.Fatal("a different key replayed the first note")
+	}
+	// Keys are per user.
+	bob := c.newClient()
+	bob.login("bob")
+	if theirs, replayed := create(bob, "k1"); replayed || theirs.ID == first.ID {
+		t.Fatal("another user's key replayed alice's note")
+	}
+	if n, _ := a.notes.Count(t.Context(), userID, NoteFilter{}); n != 2 {
+		t.Fatalf("alice has %d notes, want 2", n)
+	}
+
+	// Past the TTL the key creates afresh.
+	a.cfg.IdempotencyTTL = -time.Minute
+	if fresh, replayed := create(c, "k1"); replayed || fresh.ID == first.ID {
+		t.Fatal("expired key replayed")
+	}
+}
+
+func TestIdempotencyKeyTooLong(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+	key := strings.Repeat("k", maxIdempotencyKeyLen+1)
+	wantStatus(t, c.do("POST", "/notes", map[string]string{"title": "x"}, "Idempotency-Key", key), http.StatusBadRequest)
+	if n, _ := store.Count(t.Context(), userID, NoteFilter{}); n != 0 {
+		t.Fatalf("%d notes created", n)
+	}
+}
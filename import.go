@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// maxImportNotes caps how many notes one import may create.
+const maxImportNotes = 1000
+
+// importNotesHandler creates notes from a top-level JSON array, all or none.
+// Each item needs a string title and may have a string content; other
+// fields are ignored, so a JSON export can be imported as-is. Problems are
+// reported per item, keyed by index ("[3].title").
+func (a *app) importNotesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+
+	var raw json.RawMessage
+	if !decodeJSONShallow(w, r, &raw) {
+		return
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil || items == nil {
+		http.Error(w, `body must be a JSON array of notes, e.g. [{"title": "...", "content": "..."}]`, http.StatusBadRequest)
+		return
+	}
+
+	var verr ValidationError
+	if len(items) == 0 {
+		verr.Add("notes", "required")
+	} else if len(items) > maxImportNotes {
+		verr.Add("notes", "at most "+strconv.Itoa(maxImportNotes)+" notes per import")
+	}
+	ins := make([]NoteInput, 0, len(items))
+	for i, item := range items {
+		prefix := "[" + strconv.Itoa(i) + "]"
+		title, content, ok := importItem(&verr, prefix, item)
+		if !ok {
+			continue
+		}
+		var itemErr ValidationError
+		title = validateNote(&itemErr, title, content)
+		for field, msg := range itemErr.Fields {
+			verr.Add(prefix+"."+field, msg)
+		}
+		ins = append(ins, NoteInput{
+			Title:       title,
+			Content:     content,
+			ContentType: defaultNoteContentType,
+			Color:       defaultNoteColor,
+
+			CreatedIP:        clientIP(r),
+			CreatedUserAgent: truncateUTF8(r.UserAgent(), maxUserAgentLen),
+		})
+	}
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return
+	}
+	if !allowNoteCreate(w, userID, len(ins)) {
+		return
+	}
+
+	notes, err := a.notes.CreateBatch(r.Context(), userID, ins)
+	if err != nil {
+		requestLog(r).Error("importNotes", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	for _, n := range notes {
+		notifyNote("note.created", n)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(notes)
+}
+
+// importItem checks the shape of one import item, recording type errors
+// under prefix. ok is false when the item can't be validated further.
+func importItem(verr *ValidationError, prefix string, item json.RawMessage) (title, content string, ok bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(item, &fields); err != nil || fields == nil {
+		verr.Add(prefix, "must be an object")
+		return "", "", false
+	}
+	ok = true
+	if v, present := fields["title"]; !present || string(v) == "null" {
+		verr.Add(prefix+".title", "required")
+		ok = false
+	} else if err := json.Unmarshal(v, &title); err != nil {
+		verr.Add(prefix+".title", "must be a string")
+		ok = false
+	}
+	if v, present := fields["content"]; present && string(v) != "null" {
+		if err := json.Unmarshal(v, &content); err != nil {
+			verr.Add(prefix+".content", "must be a string")
+			ok = false
+		}
+	}
+	return title, content, ok
+}
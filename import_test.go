@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestImportNotes(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+
+	for _, body := range []string{`{"title": "x"}`, `"x"`, `null`, `42`} {
+		resp := c.do("POST", "/notes/import", body)
+		wantStatus(t, resp, http.StatusBadRequest)
+		if msg := readBody(t, resp); !strings.Contains(msg, "JSON array") {
+			t.Errorf("import %s: message %q doesn't say an array is wanted", body, msg)
+		}
+	}
+
+	resp := c.do("POST", "/notes/import", `[
+		{"title": "fine", "content": "ok"},
+		{"content": "no title"},
+		{"title": 7},
+		"not an object",
+		{"title": "x", "content": ["y"]},
+		{"title": "   "},
+		{"title": "also fine", "content": null}
+	]`)
+	wantFieldErrors(t, resp, "[1].title", "[2].title", "[3]", "[4].content", "[5].title")
+	if n, _ := store.Count(t.Context(), userID, NoteFilter{}); n != 0 {
+		t.Fatalf("a failed import left %d notes", n)
+	}
+	wantFieldErrors(t, c.do("POST", "/notes/import", `[]`), "notes")
+
+	// Unknown fields, such as those in an export, are ignored.
+	resp = c.do("POST", "/notes/import", `[{"id": 9, "title": "one", "color": "red"}, {"title": "two", "content": "2"}]`)
+	wantStatus(t, resp, http.StatusCreated)
+	var notes []Note
+	decodeBody(t, resp, &notes)
+	if len(notes) != 2 || notes[0].Title != "one" || notes[1].Content != "2" || notes[0].ID == 9 {
+		t.Fatalf("imported %+v", notes)
+	}
+}
+
+func TestImportNotesTooDeep(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+	old := maxJSONDepth
+	t.Cleanup(func() { maxJSONDepth = old })
+	maxJSONDepth = 8
+
+	nested := `[{"title": "x", "content": ` + strings.Repeat("[", 10_000) + strings.Repeat("]", 10_000) + `}]`
+	if msg := wantJSONError(t, c.do("POST", "/notes/import", nested), http.StatusBadRequest); msg != "JSON nested more than 8 levels deep" {
+		t.Errorf("message %q", msg)
+	}
+	wantJSONError(t, c.do("PATCH", "/notes/batch", `{"ids": `+strings.Repeat("[", 9)+strings.Repeat("]", 9)+`}`), http.StatusBadRequest)
+	if n, _ := store.Count(t.Context(), userID, NoteFilter{}); n != 0 {
+		t.Fatalf("%d notes imported from a refused body", n)
+	}
+
+	// Within the cap, import works as usual.
+	wantStatus(t, c.do("POST", "/notes/import", `[{"title": "ok", "content": "fine"}]`), http.StatusCreated)
+}
@@ -0,0 +1,13 @@
+//go:build !integration
+
+package main
+
+import "testing"
+
+// newDBApp skips tests that need the database unless they were built with
+// -tags integration; see integration_test.go.
+func newDBApp(t testing.TB) *app {
+	t.Helper()
+	t.Skip("needs a database; run with -tags integration")
+	return nil
+}
@@ -0,0 +1,160 @@
+//go:build integration
+
+// The integration tests run the handlers against a real MariaDB:
+//
+//	go test -tags integration ./...
+//
+// By default a MariaDB container is started through testcontainers, which
+// needs a Docker daemon. Setting TEST_DB_DSN uses that database instead; it
+// must be empty or disposable, as every test clears all the tables.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const mariadbImage = "mariadb:11.4"
+
+func TestMain(m *testing.M) {
+	os.Exit(runIntegration(m))
+}
+
+// runIntegration brings the database up, runs the tests and tears it down
+// again; it's separate from TestMain so deferred cleanups run before exit.
+func runIntegration(m *testing.M) int {
+	ctx := context.Background()
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+			ContainerRequest: testcontainers.ContainerRequest{
+				Image:        mariadbImage,
+				ExposedPorts: []string{"3306/tcp"},
+				Env: map[string]string{
+					"MARIADB_ROOT_PASSWORD": "test",
+					"MARIADB_DATABASE":      "todo_test",
+				},
+				// The entrypoint starts the server twice, once to
+				// initialize and once for real.
+				WaitingFor: wait.ForLog("ready for connections").WithOccurrence(2).WithStartupTimeout(2 * time.Minute),
+			},
+			Started: true,
+		})
+		if err != nil {
+			log.Printf("start MariaDB: %v", err)
+			return 1
+		}
+		defer c.Terminate(ctx)
+		host, err := c.Host(ctx)
+		if err != nil {
+			log.Printf("container host: %v", err)
+			return 1
+		}
+		port, err := c.MappedPort(ctx, "3306/tcp")
+		if err != nil {
+			log.Printf("container port: %v", err)
+			return 1
+		}
+		dsn = fmt.Sprintf("root:test@tcp(%s:%s)/todo_test?parseTime=true&charset=utf8mb4&loc=Local", host, port.Port())
+	}
+
+	var err error
+	sqlDialect = dialects["mysql"]
+	if db, err = sql.Open(sqlDialect.driver, dsn); err != nil {
+		log.Printf("open database: %v", err)
+		return 1
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		log.Printf("connect to database: %v", err)
+		return 1
+	}
+	if err := initSchema(false); err != nil {
+		log.Printf("init schema: %v", err)
+		return 1
+	}
+	if err := prepareNoteStmts(); err != nil {
+		log.Printf("prepare statements: %v", err)
+		return 1
+	}
+	defer stmts.Close()
+	return m.Run()
+}
+
+// resetTables empties every table, children before parents so foreign keys
+// don't object.
+func resetTables(t testing.TB) {
+	t.Helper()
+	for i := len(schema) - 1; i >= 0; i-- {
+		if _, err := db.Exec(`DELETE FROM ` + schema[i].table); err != nil {
+			t.Fatalf("reset %s: %v", schema[i].table, err)
+		}
+	}
+}
+
+// newDBApp is an app over the SQL stores, on freshly emptied tables.
+func newDBApp(t testing.TB) *app {
+	t.Helper()
+	resetTables(t)
+	setupServerGlobals(t)
+	return newApp(testConfig(t), &sqlNoteStore{db: db, stmts: &stmts}, &sqlUserStore{db: db})
+}
+
+// TestRegisterLoginCRUD walks a user through the whole basic flow over HTTP.
+func TestRegisterLoginCRUD(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+
+	wantStatus(t, c.do("GET", "/notes", nil), http.StatusUnauthorized)
+	userID := c.login("alice")
+
+	note := c.createNote(map[string]string{"title": "Groceries", "content": "milk"})
+	if note.UserID != userID || note.Title != "Groceries" || note.Content != "milk" || note.Version != 1 {
+		t.Fatalf("created note = %+v", note)
+	}
+	path := fmt.Sprintf("/notes/%d", note.ID)
+
+	resp := c.do("GET", path, nil)
+	wantStatus(t, resp, http.StatusOK)
+	var got Note
+	decodeBody(t, resp, &got)
+	if got.ID != note.ID || got.Content != "milk" {
+		t.Fatalf("fetched note = %+v", got)
+	}
+
+	resp = c.do("PUT", path, map[string]string{"title": "Groceries", "content": "milk, eggs"})
+	wantStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &got)
+	if got.Content != "milk, eggs" || got.Version != 2 {
+		t.Fatalf("updated note = %+v", got)
+	}
+
+	resp = c.do("GET", "/notes", nil)
+	wantStatus(t, resp, http.StatusOK)
+	var list []Note
+	decodeBody(t, resp, &list)
+	if len(list) != 1 || list[0].ID != note.ID {
+		t.Fatalf("list = %+v", list)
+	}
+
+	// Another user can neither see nor delete it.
+	other := c.newClient()
+	other.login("bob")
+	wantStatus(t, other.do("GET", path, nil), http.StatusNotFound)
+	wantStatus(t, other.do("DELETE", path, nil), http.StatusNotFound)
+
+	wantStatus(t, c.do("DELETE", path, nil), http.StatusNoContent)
+	wantStatus(t, c.do("GET", path, nil), http.StatusNotFound)
+
+	wantStatus(t, c.do("POST", "/logout", nil), http.StatusOK)
+	wantStatus(t, c.do("GET", "/notes", nil), http.StatusUnauthorized)
+}
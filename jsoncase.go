@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// jsonCamelCase switches the keys of Note and User objects from snake_case
+// to camelCase (JSON_FIELD_CASE=camel), for frontends that expect it. The
+// struct tags stay snake_case and the keys are rewritten on the way out,
+// so the structs aren't duplicated. Request bodies and other responses are
+// unaffected.
+var jsonCamelCase bool
+
+// snakeToCamel turns "created_at" into "createdAt".
+func snakeToCamel(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// camelToSnake turns "createdAt" into "created_at".
+func camelToSnake(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('_')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// jsonFieldName is the key a snake_case field is emitted under.
+func jsonFieldName(snake string) string {
+	if jsonCamelCase {
+		return snakeToCamel(snake)
+	}
+	return snake
+}
+
+// withFieldCase rewrites the top-level keys of the JSON object b for
+// jsonCamelCase, keeping their order. Values, including nested objects,
+// are copied untouched.
+func withFieldCase(b []byte) ([]byte, error) {
+	if !jsonCamelCase {
+		return b, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, errors.New("withFieldCase: not a JSON object")
+	}
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		key, err := json.Marshal(snakeToCamel(tok.(string)))
+		if err != nil {
+			return nil, err
+		}
+		out.Write(key)
+		out.WriteByte(':')
+		out.Write(v)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// useCamelCase sets jsonCamelCase for the rest of the test.
+func useCamelCase(t *testing.T, on bool) {
+	t.Helper()
+	old := jsonCamelCase
+	t.Cleanup(func() { jsonCamelCase = old })
+	jsonCamelCase = on
+}
+
+// jsonKeys returns the top-level keys of the JSON object b, in order.
+func jsonKeys(t *testing.T, b []byte) []string {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		t.Fatalf("%s isn't an object", b)
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, tok.(string))
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys
+}
+
+func TestSnakeCamel(t *testing.T) {
+	for snake, camel := range map[string]string{
+		"id": "id", "created_at": "createdAt", "notebook_id": "notebookId",
+		"is_admin": "isAdmin", "char_count": "charCount",
+	} {
+		if got := snakeToCamel(snake); got != camel {
+			t.Errorf("snakeToCamel(%q) = %q, want %q", snake, got, camel)
+		}
+		if got := camelToSnake(camel); got != snake {
+			t.Errorf("camelToSnake(%q) = %q, want %q", camel, got, snake)
+		}
+	}
+}
+
+func TestWithFieldCase(t *testing.T) {
+	in := []byte(`{"user_id":1,"due_at":null,"nested":{"keep_me":true},"list":[{"a_b":1}]}`)
+	useCamelCase(t, false)
+	if out, err := withFieldCase(in); err != nil || !bytes.Equal(out, in) {
+		t.Fatalf("snake: %s, %v; want the input untouched", out, err)
+	}
+	useCamelCase(t, true)
+	out, err := withFieldCase(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only top-level keys change, in their original order.
+	if want := `{"userId":1,"dueAt":null,"nested":{"keep_me":true},"list":[{"a_b":1}]}`; string(out) != want {
+		t.Fatalf("camel: %s, want %s", out, want)
+	}
+	if _, err := withFieldCase([]byte(`[1,2]`)); err == nil {
+		t.Error("array accepted")
+	}
+}
+
+func TestNoteAndUserFieldCase(t *testing.T) {
+	nb := 3
+	note := Note{ID: 1, UserID: 2, Title: "t", NotebookID: &nb}
+	user := User{ID: 2, Username: "alice", Password: "hash", IsAdmin: true}
+
+	for _, tc := range []struct {
+		camel      bool
+		note, user []string
+	}{
+		{false,
+			[]string{"id", "user_id", "title", "content", "content_type", "archived", "done", "pinned", "starred", "color", "notebook_id", "due_at", "position", "version", "view_count", "read_only", "created_at", "updated_at", "char_count", "word_count"},
+			[]string{"id", "username", "is_admin"}},
+		{true,
+			[]string{"id", "userId", "title", "content", "contentType", "archived", "done", "pinned", "starred", "color", "notebookId", "dueAt", "position", "version", "viewCount", "readOnly", "createdAt", "updatedAt", "charCount", "wordCount"},
+			[]string{"id", "username", "isAdmin"}},
+	} {
+		useCamelCase(t, tc.camel)
+		b, err := json.Marshal(note)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := jsonKeys(t, b); !slices.Equal(got, tc.note) {
+			t.Errorf("camel=%v note keys = %v\nwant %v", tc.camel, got, tc.note)
+		}
+		b, err = json.Marshal(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := jsonKeys(t, b); !slices.Equal(got, tc.user) {
+			t.Errorf("camel=%v user keys = %v, want %v", tc.camel, got, tc.user)
+		}
+		if strings.Contains(string(b), "hash") {
+			t.Errorf("user JSON leaks the password: %s", b)
+		}
+	}
+
+	// Exports stay snake_case so they import anywhere.
+	useCamelCase(t, true)
+	var buf bytes.Buffer
+	if err := writeExportJSON(&buf, note, true); err != nil {
+		t.Fatal(err)
+	}
+	if keys := jsonKeys(t, buf.Bytes()); !slices.Contains(keys, "notebook_id") || slices.Contains(keys, "notebookId") {
+		t.Errorf("export keys = %v, want snake_case", keys)
+	}
+}
+
+func TestCamelCaseResponses(t *testing.T) {
+	useCamelCase(t, true)
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	// Request bodies are still snake_case.
+	resp := c.do("POST", "/notes", map[string]string{"title": "camel", "content_type": "markdown"})
+	wantStatus(t, resp, http.StatusCreated)
+	body := readBody(t, resp)
+	if !strings.Contains(body, `"contentType":"markdown"`) || strings.Contains(body, "content_type") {
+		t.Fatalf("created note = %s", body)
+	}
+	resp = c.do("GET", "/me", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); !strings.Contains(body, `"isAdmin":`) {
+		t.Fatalf("/me = %s", body)
+	}
+}
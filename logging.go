@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// parseLogLevel reads LOG_LEVEL: debug, info (the default), warn or error.
+func parseLogLevel(v string) (slog.Level, error) {
+	switch strings.ToLower(v) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid LOG_LEVEL %q: want debug, info, warn or error", v)
+}
+
+// setupLogging sends all logging, including anything still written through
+// the log package, to stderr as key=value text or, with format "json", one
+// JSON object per line. Records below level are dropped.
+func setupLogging(level slog.Level, format string) {
+	slog.SetDefault(slog.New(newLogHandler(os.Stderr, level, format)))
+}
+
+// newLogHandler writes records at level and above to w in format.
+func newLogHandler(w io.Writer, level slog.Level, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// fatal logs msg at ERROR and exits, for startup failures.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	for v, want := range map[string]slog.Level{
+		"": slog.LevelInfo, "info": slog.LevelInfo, "DEBUG": slog.LevelDebug,
+		"warn": slog.LevelWarn, "warning": slog.LevelWarn, "Error": slog.LevelError,
+	} {
+		if got, err := parseLogLevel(v); err != nil || got != want {
+			t.Errorf("parseLogLevel(%q) = %v, %v; want %v", v, got, err, want)
+		}
+	}
+	if _, err := parseLogLevel("loud"); err == nil {
+		t.Error("parseLogLevel accepted loud")
+	}
+}
+
+func TestLogLevelFilters(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(newLogHandler(&buf, slog.LevelError, "text"))
+	log.Debug("debug noise")
+	log.Info("started")
+	log.Warn("slow query")
+	if buf.Len() != 0 {
+		t.Fatalf("below-ERROR records written at level ERROR: %s", buf.String())
+	}
+	log.Error("db down", "err", "refused")
+	if got := buf.String(); !strings.Contains(got, "level=ERROR") || !strings.Contains(got, `msg="db down" err=refused`) {
+		t.Fatalf("error record = %q", got)
+	}
+}
+
+func TestLogFormatJSON(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(newLogHandler(&buf, slog.LevelDebug, "json"))
+	log.Debug("request", "status", 200)
+	log.Warn("slow", "ms", 900)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d lines, want one per record:\n%s", len(lines), buf.String())
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatalf("line %q isn't JSON: %v", lines[1], err)
+	}
+	if rec["level"] != "WARN" || rec["msg"] != "slow" || rec["ms"] != 900.0 {
+		t.Fatalf("record = %v", rec)
+	}
+}
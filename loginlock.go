@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// loginGuard locks out usernames after repeated failed logins
+// (LOGIN_MAX_FAILURES within LOGIN_LOCKOUT). Nil means no lockout.
+var loginGuard *LoginGuard
+
+type loginState struct {
+	failures    int
+	lockedUntil time.Time
+	updated     time.Time
+}
+
+// LoginGuard counts failed logins per username. After max failures, each
+// within lockout of the previous one, the username is locked for lockout.
+// Counters live in the login_attempts table so a restart doesn't hand an
+// attacker a fresh set of guesses; the map in front of it saves a query on
+// every login. Usernames are counted whether or not they exist, so a
+// lockout reveals nothing about which accounts are real.
+//
+// Each instance trusts its own cache once it has read a username, so with
+// several instances the effective limit is per instance until the cache
+// entry is pruned.
+//
+// mu guards the maps only and is never held across a query. Each
+// username's read-modify-write is serialized by its own userLock instead,
+// so a slow database holds up logins for that username and no other.
+type LoginGuard struct {
+	db      *sql.DB
+	max     int
+	lockout time.Duration
+
+	mu    sync.Mutex
+	cache map[string]loginState
+	locks map[string]*userLock
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newLoginGuard locks a username for lockout after max failures, and prunes
+// stale counters every lockout.
+func newLoginGuard(db *sql.DB, max int, lockout time.Duration) *LoginGuard {
+	g := &LoginGuard{
+		db:      db,
+		max:     max,
+		lockout: lockout,
+		cache:   make(map[string]loginState),
+		locks:   make(map[string]*userLock),
+		stop:    make(chan struct{}),
+	}
+	go g.pruneLoop(lockout)
+	return g
+}
+
+// userLock serializes one username's updates. refs counts the callers
+// holding or waiting for it, so the last one out can drop it from the map.
+type userLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock takes username's lock and returns the function that releases it.
+func (g *LoginGuard) lock(username string) (unlock func()) {
+	g.mu.Lock()
+	l := g.locks[username]
+	if l == nil {
+		l = &userLock{}
+		g.locks[username] = l
+	}
+	l.refs++
+	g.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		g.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(g.locks, username)
+		}
+		g.mu.Unlock()
+	}
+}
+
+// cached returns username's counters if they're in the cache.
+func (g *LoginGuard) cached(username string) (loginState, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st, ok := g.cache[username]
+	return st, ok
+}
+
+// setCached replaces username's cached counters.
+func (g *LoginGuard) setCached(username string, st loginState) {
+	g.mu.Lock()
+	g.cache[username] = st
+	g.mu.Unlock()
+}
+
+// state returns username's counters, reading through to the database on a
+// cache miss. Callers hold username's lock.
+func (g *LoginGuard) state(ctx context.Context, username string) (loginState, error) {
+	if st, ok := g.cached(username); ok {
+		return st, nil
+	}
+	var st loginState
+	var lockedUntil sql.NullTime
+	err := g.db.QueryRowContext(ctx,
+		`SELECT failures, locked_until, updated_at FROM login_attempts WHERE username = ?`, username,
+	).Scan(&st.failures, &lockedUntil, &st.updated)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return loginState{}, err
+	}
+	st.lockedUntil = lockedUntil.Time
+	g.setCached(username, st)
+	return st, nil
+}
+
+// Locked reports how much longer username is locked out, or 0.
+func (g *LoginGuard) Locked(ctx context.Context, username string, now time.Time) (time.Duration, error) {
+	defer g.lock(username)()
+	st, err := g.state(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+	if now.Before(st.lockedUntil) {
+		return st.lockedUntil.Sub(now), nil
+	}
+	return 0, nil
+}
+
+// Fail records a failed login and reports whether it locked username out.
+func (g *LoginGuard) Fail(ctx context.Context, username string, now time.Time) (bool, error) {
+	defer g.lock(username)()
+	st, err := g.state(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	// Failures spread out further than the lockout apart don't add up.
+	if now.Sub(st.updated) > g.lockout {
+		st.failures = 0
+	}
+	st.failures++
+	st.updated = now
+	locked := st.failures >= g.max
+	if locked {
+		st.failures = 0
+		st.lockedUntil = now.Add(g.lockout)
+	}
+
+	if err := g.save(ctx, username, st); err != nil {
+		// Drop the entry so the next attempt rereads what was stored.
+		g.mu.Lock()
+		delete(g.cache, username)
+		g.mu.Unlock()
+		return false, err
+	}
+	g.setCached(username, st)
+	return locked, nil
+}
+
+// save replaces username's row. Delete-then-insert works the same on every
+// dialect, unlike the upsert syntaxes.
+func (g *LoginGuard) save(ctx context.Context, username string, st loginState) error {
+	tx, err := g.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lockedUntil sql.NullTime
+	if !st.lockedUntil.IsZero() {
+		lockedUntil = sql.NullTime{Time: st.lockedUntil, Valid: true}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_attempts WHERE username = ?`, username); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO login_attempts (username, failures, locked_until, updated_at) VALUES (?, ?, ?, ?)`,
+		username, st.failures, lockedUntil, st.updated,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Succeed clears username's counters after a good login.
+func (g *LoginGuard) Succeed(ctx context.Context, username string) error {
+	defer g.lock(username)()
+	if st, ok := g.cached(username); ok && st.failures == 0 && st.lockedUntil.IsZero() {
+		return nil
+	}
+	if _, err := g.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE username = ?`, username); err != nil {
+		return err
+	}
+	g.setCached(username, loginState{})
+	return nil
+}
+
+// Stop ends the background prune. It is safe to call more than once.
+func (g *LoginGuard) Stop() {
+	g.stopOnce.Do(func() { close(g.stop) })
+}
+
+func (g *LoginGuard) pruneLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case now := <-ticker.C:
+			if err := g.prune(context.Background(), now); err != nil {
+				slog.Warn("prune login attempts", "err", err)
+			}
+		}
+	}
+}
+
+// prune forgets counters that no longer affect anything: no lockout in
+// force and no failure recent enough to count toward one.
+func (g *LoginGuard) prune(ctx context.Context, now time.Time) error {
+	cutoff := now.Add(-g.lockout)
+	g.mu.Lock()
+	for username, st := range g.cache {
+		if st.updated.Before(cutoff) && !now.Before(st.lockedUntil) {
+			delete(g.cache, username)
+		}
+	}
+	g.mu.Unlock()
+
+	_, err := g.db.ExecContext(ctx,
+		`DELETE FROM login_attempts WHERE updated_at < ? AND (locked_until IS NULL OR locked_until < ?)`,
+		cutoff, now,
+	)
+	return err
+}
+
+// loginLocked answers 429 with Retry-After when username is locked out.
+// It returns true when the login must not proceed, having written the
+// response.
+func loginLocked(w http.ResponseWriter, r *http.Request, username string) bool {
+	if loginGuard == nil {
+		return false
+	}
+	wait, err := loginGuard.Locked(r.Context(), username, time.Now())
+	if err != nil {
+		requestLog(r).Error("login lockout check", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return true
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeJSONError(w, http.StatusTooManyRequests, msgTooManyLogins)
+		return true
+	}
+	return false
+}
+
+// loginFailed records a failed password check for username, at login or
+// when deleting the account. Errors are only logged: the caller is already
+// answering the failure.
+func loginFailed(r *http.Request, username string) {
+	if loginGuard == nil {
+		return
+	}
+	locked, err := loginGuard.Fail(r.Context(), username, time.Now())
+	if err != nil {
+		requestLog(r).Error("login record failure", "err", err)
+		return
+	}
+	if locked {
+		requestLog(r).Warn("login locked out", "username", username, "ip", clientIP(r))
+	}
+}
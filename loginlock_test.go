@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLoginLockoutSurvivesRestart locks a username out, then asks a fresh
+// guard, as a restarted server would have, with nothing in its cache.
+func TestLoginLockoutSurvivesRestart(t *testing.T) {
+	newDBApp(t)
+	ctx := t.Context()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	g := newLoginGuard(db, 3, time.Minute)
+	t.Cleanup(g.Stop)
+	for i := 1; i <= 3; i++ {
+		locked, err := g.Fail(ctx, "alice", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if locked != (i == 3) {
+			t.Fatalf("failure %d: locked = %v", i, locked)
+		}
+	}
+	g.Stop()
+
+	restarted := newLoginGuard(db, 3, time.Minute)
+	t.Cleanup(restarted.Stop)
+	wait, err := restarted.Locked(ctx, "alice", now.Add(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait != 50*time.Second {
+		t.Fatalf("after restart: locked for %v more, want 50s", wait)
+	}
+	if wait, _ := restarted.Locked(ctx, "alice", now.Add(time.Minute)); wait != 0 {
+		t.Errorf("still locked for %v once the lockout has passed", wait)
+	}
+	if wait, _ := restarted.Locked(ctx, "bob", now); wait != 0 {
+		t.Errorf("bob locked for %v", wait)
+	}
+
+	// A good login wipes the row as well as the cache.
+	if err := restarted.Succeed(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, "login_attempts"); n != 0 {
+		t.Fatalf("%d login_attempts rows after success, want 0", n)
+	}
+}
+
+func TestLoginFailuresExpire(t *testing.T) {
+	newDBApp(t)
+	ctx := t.Context()
+	now := time.Now().UTC().Truncate(time.Second)
+	g := newLoginGuard(db, 2, time.Minute)
+	t.Cleanup(g.Stop)
+
+	// Failures further apart than the lockout don't add up.
+	g.Fail(ctx, "alice", now)
+	if locked, _ := g.Fail(ctx, "alice", now.Add(2*time.Minute)); locked {
+		t.Fatal("locked by failures two minutes apart")
+	}
+
+	g.Fail(ctx, "bob", now)
+	if err := g.prune(ctx, now.Add(90*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// bob's lone failure is stale; alice's second is still recent.
+	if n := countRows(t, "login_attempts"); n != 1 {
+		t.Fatalf("%d rows after prune, want alice's only", n)
+	}
+	if _, ok := g.cache["bob"]; ok {
+		t.Error("bob still cached after prune")
+	}
+}
+
+func TestLoginLockedResponse(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	old := loginGuard
+	t.Cleanup(func() { loginGuard = old })
+	loginGuard = newLoginGuard(db, 2, time.Hour)
+	t.Cleanup(loginGuard.Stop)
+
+	bad := map[string]string{"username": "alice", "password": "wrong password"}
+	wantStatus(t, c.do("POST", "/login", bad), http.StatusUnauthorized)
+	wantStatus(t, c.do("POST", "/login", bad), http.StatusUnauthorized)
+	// Locked now, even with the right password.
+	resp := c.do("POST", "/login", map[string]string{"username": "alice", "password": "correct horse battery"})
+	wantJSONError(t, resp, http.StatusTooManyRequests)
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || s < 3590 || s > 3600 {
+		t.Errorf("Retry-After = %q, want about an hour", resp.Header.Get("Retry-After"))
+	}
+}
+
+// TestLoginGuardLocksPerUsername holds alice's lock, as a slow query on her
+// row would, and checks bob's check still goes through.
+func TestLoginGuardLocksPerUsername(t *testing.T) {
+	g := newLoginGuard(nil, 3, time.Minute)
+	t.Cleanup(g.Stop)
+	// Cached, so the check doesn't need the database.
+	g.cache["bob"] = loginState{}
+
+	unlock := g.lock("alice")
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.Locked(t.Context(), "bob", time.Now())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("bob's check waited on alice's lock")
+	}
+	unlock()
+
+	if n := len(g.locks); n != 0 {
+		t.Errorf("%d username locks left after release, want 0", n)
+	}
+}
+
+// TestLoginFailuresConcurrent fails one username from many goroutines at
+// once; each failure must count, and exactly one of them locks it.
+func TestLoginFailuresConcurrent(t *testing.T) {
+	newDBApp(t)
+	ctx := t.Context()
+	now := time.Now().UTC().Truncate(time.Second)
+	g := newLoginGuard(db, 10, time.Minute)
+	t.Cleanup(g.Stop)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	lockouts := 0
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			locked, err := g.Fail(ctx, "alice", now)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if locked {
+				mu.Lock()
+				lockouts++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if lockouts != 1 {
+		t.Fatalf("%d failures locked alice out, want exactly 1", lockouts)
+	}
+	if wait, err := g.Locked(ctx, "alice", now); err != nil || wait != time.Minute {
+		t.Fatalf("locked for %v (err %v), want 1m", wait, err)
+	}
+}
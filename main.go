@@ -3,23 +3,41 @@ package main
 import (
 	"context"
 	"database/sql"
+	"embed"
 	"encoding/json"
+	"errors"
 	"html/template"
-	"log"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	_ "github.com/go-sql-driver/mysql"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
 	Password string `json:"-"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+// MarshalJSON honours jsonCamelCase.
+func (u User) MarshalJSON() ([]byte, error) {
+	type plain User
+	b, err := json.Marshal(plain(u))
+	if err != nil {
+		return nil, err
+	}
+	return withFieldCase(b)
 }
 
 type Note struct {
@@ -27,11 +45,111 @@ type Note struct {
 	UserID  int    `json:"user_id"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	// ContentType says how Content is meant to be rendered; see
+	// noteContentTypes.
+	ContentType string     `json:"content_type"`
+	Archived    bool       `json:"archived"`
+	Done        bool       `json:"done"`
+	Pinned      bool       `json:"pinned"`
+	Starred     bool       `json:"starred"`
+	Color       string     `json:"color"`
+	NotebookID  *int       `json:"notebook_id"`
+	DueAt       *time.Time `json:"due_at"`
+	Position    int        `json:"position"`
+	// Version goes up by one on every edit; see updateNoteHandler.
+	Version int `json:"version"`
+	// ViewCount is how many times the note was fetched through its share
+	// link; see sharedNoteHandler. Views don't count as edits.
+	ViewCount int `json:"view_count"`
+	// ReadOnly marks a note another user shared with the caller.
+	ReadOnly  bool      `json:"read_only"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MarshalJSON emits the note's timestamps in UTC. The driver hands them back
+// in the server's zone (loc=Local), which clients elsewhere misread. It also
+// adds the content's character (rune) and whitespace-separated word counts,
+// which aren't stored. Keys are camelCase with jsonCamelCase.
+func (n Note) MarshalJSON() ([]byte, error) {
+	b, err := n.snakeJSON()
+	if err != nil {
+		return nil, err
+	}
+	return withFieldCase(b)
+}
+
+// snakeJSON is the note's JSON with its snake_case keys whatever
+// jsonCamelCase says, for exports and backups, which must read back the
+// same on any server.
+func (n Note) snakeJSON() ([]byte, error) {
+	type plain Note
+	p := plain(n)
+	p.CreatedAt = p.CreatedAt.UTC()
+	p.UpdatedAt = p.UpdatedAt.UTC()
+	if p.DueAt != nil {
+		due := p.DueAt.UTC()
+		p.DueAt = &due
+	}
+	return json.Marshal(struct {
+		plain
+		CharCount int `json:"char_count"`
+		WordCount int `json:"word_count"`
+	}{p, utf8.RuneCountInString(n.Content), len(strings.Fields(n.Content))})
+}
+
+// noteColumns is the column list scanNote expects, in order.
+const noteColumns = `id, user_id, title, content, content_type, archived, done, pinned, starred, color, notebook_id, due_at, position, version, view_count, created_at, updated_at`
+
+const defaultNoteColor = "gray"
+
+// noteColors is the allowlist of label colors a note may carry.
+var noteColors = map[string]bool{
+	"red":    true,
+	"yellow": true,
+	"green":  true,
+	"blue":   true,
+	"gray":   true,
+}
+
+const defaultNoteContentType = "plain"
+
+// noteContentTypes is the allowlist of content types. They only change how
+// GET /notes/{id}/render presents the content:
+//
+//	plain      text, with line breaks kept
+//	markdown   the subset renderMarkdown supports
+//	checklist  one item per line, "[x] " marking the ones that are done
+var noteContentTypes = map[string]bool{
+	"plain":     true,
+	"markdown":  true,
+	"checklist": true,
 }
 
+// templateFS bundles the frontend template into the binary so it renders
+// regardless of the working directory.
+//
+//go:embed static/index.html
+var templateFS embed.FS
+
+const indexTemplate = "static/index.html"
+
 var (
 	db   *sql.DB
 	tmpl *template.Template
+
+	// maxBodyBytes caps the size of JSON request bodies.
+	maxBodyBytes int64 = 1 << 20
+
+	// maxJSONDepth caps the nesting of the bodies decodeJSONShallow reads.
+	maxJSONDepth = 32
+
+	// sessions holds logged-in users' session tokens.
+	sessions *SessionStore
+
+	// basePath is the URL prefix every route is served under (BASE_PATH,
+	// e.g. "/todo"), with no trailing slash. Empty serves from the root.
+	basePath string
 )
 
 // Context key for user ID
@@ -40,107 +158,260 @@ type contextKey string
 const userIDKey contextKey = "userID"
 
 func main() {
-	// DB config
-	dsn := os.Getenv("TODO_DB_DSN")
-	if dsn == "" {
-		dsn = "cloud:cloud.kenzastore.my.id@tcp(127.0.0.1:3306)/cloud?parseTime=true&charset=utf8mb4&loc=Local"
+	cfg, err := LoadConfig()
+	if err != nil {
+		fatal("load config", "err", err)
 	}
+	setupLogging(cfg.LogLevel, cfg.LogFormat)
+	slog.Info("starting", "version", version, "commit", commit, "built_at", builtAt)
 
-	var err error
-	db, err = sql.Open("mysql", dsn)
+	sqlDialect = dialects[cfg.DBDriver]
+	db, err = sql.Open(sqlDialect.driver, cfg.DSN)
 	if err != nil {
-		log.Fatal("sql.Open:", err)
+		fatal("open database", "err", err)
 	}
 	if err := db.Ping(); err != nil {
-		log.Fatal("db.Ping:", err)
-	}
-	log.Println("Connected to MariaDB")
-
-	// Create users table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id INT AUTO_INCREMENT PRIMARY KEY,
-			username VARCHAR(255) NOT NULL UNIQUE,
-			password VARCHAR(255) NOT NULL
-		)
-	`)
-	if err != nil {
-		log.Fatal("create users table:", err)
+		fatal("connect to database", "err", err)
 	}
+	slog.Info("connected to database", "driver", cfg.DBDriver)
 
-	// Create notes table (dropping old one if it doesn't have user_id is risky in prod, but for this task we assume migration)
-	// For simplicity in this dev env, we'll try to create it if not exists. 
-	// If it exists without user_id, it might fail or we might need to alter. 
-	// Given the instructions, we'll drop and recreate to ensure schema correctness.
-	_, err = db.Exec(`DROP TABLE IF EXISTS notes`)
-	if err != nil {
-		log.Println("drop notes table:", err)
-	}
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS notes (
-			id INT AUTO_INCREMENT PRIMARY KEY,
-			user_id INT NOT NULL,
-			title TEXT NOT NULL,
-			content TEXT,
-			FOREIGN KEY (user_id) REFERENCES users(id)
-		)
-	`)
-	if err != nil {
-		log.Fatal("create notes table:", err)
+	if err := initSchema(cfg.DBReset); err != nil {
+		fatal("init schema", "err", err)
+	}
+	if err := prepareNoteStmts(); err != nil {
+		fatal("prepare statements", "err", err)
+	}
+
+	// Handlers read their settings from a.cfg; the middleware and helpers
+	// shared by every route still read these package variables.
+	maxBodyBytes = cfg.MaxBodyBytes
+	maxJSONDepth = cfg.MaxJSONDepth
+	maxInFlight = cfg.MaxInFlight
+	jsonCamelCase = cfg.JSONFieldCase == "camel"
+	sessions = newSessionStore(cfg.SessionSweepInterval, cfg.MaxSessionsPerUser, cfg.SessionLimitReject)
+	if cfg.NoteCreateRate > 0 {
+		noteCreateLimiter = newRateLimiter(cfg.NoteCreateRate, time.Minute)
+	}
+	if cfg.LoginMaxFailures > 0 {
+		loginGuard = newLoginGuard(db, cfg.LoginMaxFailures, cfg.LoginLockout)
+	}
+	webhooks = newWebhookDispatcher(db, cfg.WebhookTimeout, cfg.WebhookAllowPrivate)
+	for _, o := range cfg.CORSOrigins {
+		corsOrigins[o] = true
+	}
+	contentSecurityPolicy = cfg.ContentSecurityPolicy
+	trustProxy = cfg.TrustProxy
+	trustedProxies = cfg.TrustedProxies
+	serverTimeouts = cfg.Timeouts
+
+	if err := os.MkdirAll(cfg.UploadDir, 0o750); err != nil {
+		fatal("create upload dir", "err", err)
+	}
+
+	if err := promoteAdmin(cfg.AdminUsername); err != nil {
+		fatal("promote admin", "err", err)
+	}
+
+	basePath = cfg.BasePath
+	if basePath != "" {
+		slog.Info("serving under base path", "base_path", basePath)
 	}
 
 	// parse frontend template
-	tmpl = template.Must(template.ParseFiles("static/index.html"))
+	tmpl = template.Must(template.ParseFS(templateFS, indexTemplate))
+	if cfg.TemplateHotReload {
+		slog.Info("template hot reload enabled")
+	}
+
+	a := newApp(cfg,
+		&sqlNoteStore{db: db, stmts: &stmts},
+		&sqlUserStore{db: db, adminUsername: cfg.AdminUsername},
+	)
+
+	// Start server
+	addr := cfg.Addr
+	srv := newServer(addr, a.routes())
+	serverReady.Store(true)
+	go func() {
+		slog.Info("server listening", "addr", addr, "base_path", basePath+"/")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("listen", "err", err)
+		}
+	}()
+
+	// Shut down on SIGINT/SIGTERM, letting in-flight requests finish before
+	// the prepared statements and pool are closed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	slog.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown", "err", err)
+	}
+	sessions.Stop()
+	if noteCreateLimiter != nil {
+		noteCreateLimiter.Stop()
+	}
+	if loginGuard != nil {
+		loginGuard.Stop()
+	}
+	webhooks.Stop()
+	stmts.Close()
+	db.Close()
+	slog.Info("shutdown complete")
+}
+
+// routes registers every endpoint on a fresh mux and wraps it in the
+// middleware the whole server shares, outermost first.
+func (a *app) routes() http.Handler {
+	mux := http.NewServeMux()
 
 	// Auth routes
-	http.HandleFunc("/register", registerHandler)
-	http.HandleFunc("/login", loginHandler)
-	http.HandleFunc("/logout", logoutHandler)
-	http.HandleFunc("/check-auth", checkAuthHandler)
+	mux.HandleFunc("/register", a.registerHandler)
+	mux.HandleFunc("/login", a.loginHandler)
+	mux.HandleFunc("/logout", logoutHandler)
+	mux.HandleFunc("/logout-all", authMiddleware(logoutAllHandler))
+	mux.HandleFunc("/check-auth", checkAuthHandler)
+	mux.HandleFunc("/me", authMiddleware(a.meHandler))
+	mux.HandleFunc("/me/backup", authMiddleware(a.backupHandler))
+	mux.HandleFunc("/me/restore", authMiddleware(a.restoreHandler))
+	mux.HandleFunc("/api-keys", authMiddleware(apiKeysHandler))
+	mux.HandleFunc("/api-keys/{id}", authMiddleware(apiKeyItemHandler))
+	mux.HandleFunc("/webhooks", authMiddleware(webhooksHandler))
+	mux.HandleFunc("/webhooks/{id}", authMiddleware(webhookItemHandler))
+	mux.HandleFunc("/webhooks/{id}/deliveries", authMiddleware(webhookDeliveriesHandler))
 
 	// API routes (protected)
-	http.HandleFunc("/notes", authMiddleware(notesHandler))
-	http.HandleFunc("/notes/", authMiddleware(noteItemHandler))
+	// Methods are checked in the handlers so 405s stay JSON with an Allow header.
+	// /notes/ is the same collection as /notes rather than a note with an
+	// empty id.
+	notesRoute := allowMethods(authMiddleware(a.notesHandler), notesMethods...)
+	mux.HandleFunc("/notes", notesRoute)
+	mux.HandleFunc("/notes/{$}", notesRoute)
+	mux.HandleFunc("/notes/due", authMiddleware(dueNotesHandler))
+	mux.HandleFunc("/notes/starred", authMiddleware(starredNotesHandler))
+	mux.HandleFunc("/notes/export", authMiddleware(exportNotesHandler))
+	mux.HandleFunc("/notes/search", authMiddleware(searchNotesHandler))
+	mux.HandleFunc("/notes/batch", authMiddleware(a.notesBatchHandler))
+	mux.HandleFunc("/notes/import", authMiddleware(a.importNotesHandler))
+	mux.HandleFunc("/notes/reorder", authMiddleware(a.reorderNotesHandler))
+	mux.HandleFunc("/notes/{id}", numericID(allowMethods(authMiddleware(a.noteItemHandler), noteItemMethods...)))
+	mux.HandleFunc("/notes/{id}/duplicate", authMiddleware(a.duplicateNoteHandler))
+	mux.HandleFunc("/notes/{id}/archive", authMiddleware(toggleNoteHandler("archived")))
+	mux.HandleFunc("/notes/{id}/done", authMiddleware(toggleNoteHandler("done")))
+	mux.HandleFunc("/notes/{id}/pin", authMiddleware(a.pinNoteHandler))
+	mux.HandleFunc("/notes/{id}/star", authMiddleware(toggleNoteHandler("starred")))
+	mux.HandleFunc("/notes/{id}/render", authMiddleware(renderNoteHandler))
+	mux.HandleFunc("/notes/{id}/share", authMiddleware(noteShareHandler))
+	mux.HandleFunc("/notes/{id}/collaborators", authMiddleware(collaboratorsHandler))
+	mux.HandleFunc("/notes/{id}/collaborators/{userID}", authMiddleware(collaboratorItemHandler))
+	mux.HandleFunc("/notes/{id}/attachments", authMiddleware(a.attachmentsHandler))
+	mux.HandleFunc("/notes/{id}/attachments/{attachmentID}", authMiddleware(a.attachmentItemHandler))
+	mux.HandleFunc("/notes/{id}/revisions", authMiddleware(listRevisionsHandler))
+	mux.HandleFunc("/notes/{id}/revisions/diff", authMiddleware(revisionDiffHandler))
+	mux.HandleFunc("/notes/{id}/revisions/{rev}/restore", authMiddleware(restoreRevisionHandler))
+	mux.HandleFunc("/notebooks", authMiddleware(notebooksHandler))
+	mux.HandleFunc("/notebooks/{id}", authMiddleware(notebookItemHandler))
+	mux.HandleFunc("/templates", authMiddleware(templatesHandler))
+	mux.HandleFunc("/templates/{id}", authMiddleware(templateItemHandler))
+	mux.HandleFunc("/templates/{id}/notes", authMiddleware(a.noteFromTemplateHandler))
+
+	// Admin
+	mux.HandleFunc("/admin/users", authMiddleware(a.adminMiddleware(adminUsersHandler)))
+	mux.HandleFunc("/admin/users/inactive", authMiddleware(a.adminMiddleware(adminInactiveUsersHandler)))
+	mux.HandleFunc("/admin/db-stats", authMiddleware(a.adminMiddleware(adminDBStatsHandler)))
+	mux.HandleFunc("/admin/notes/{id}/audit", authMiddleware(a.adminMiddleware(adminNoteAuditHandler)))
+
+	// Public read-only shares
+	mux.HandleFunc("/shared/{slug}", sharedNoteHandler)
+
+	// API description
+	mux.HandleFunc("/openapi.json", openAPIHandler)
+
+	// Monitoring
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/livez", livezHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/version", versionHandler)
 
 	// Static files
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	mux.Handle("/static/", cacheStatic(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))), a.cfg.StaticMaxAge))
+	mux.Handle("/favicon.ico", cacheStatic(http.HandlerFunc(a.faviconHandler), a.cfg.StaticMaxAge))
 
 	// Frontend
-	http.HandleFunc("/", frontHandler)
+	mux.HandleFunc("/", a.frontHandler)
 
-	// Start server
-	port := os.Getenv("PORT")
+	return requestIDMiddleware(localeMiddleware(basePathMiddleware(metricsMiddleware(concurrencyLimitMiddleware(gzipMiddleware(recoverMiddleware(securityHeadersMiddleware(corsMiddleware(mux)))))))))
+}
+
+// listenAddr builds the server address. LISTEN_ADDR ("127.0.0.1:8080") wins
+// outright; otherwise HOST, which defaults to all interfaces, is joined with
+// PORT, which defaults to 8080.
+func listenAddr(listen, host, port string) string {
+	if listen != "" {
+		return listen
+	}
 	if port == "" {
 		port = "8080"
 	}
-	log.Println("Server running at http://localhost:" + port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	return net.JoinHostPort(host, port)
 }
 
 // --------- Middleware ----------
 
+// allowMethods answers OPTIONS with 204 and an Allow header listing
+// methods, ahead of authentication so anyone can discover what a route
+// supports. CORS preflights are answered earlier, by corsMiddleware.
+func allowMethods(next http.HandlerFunc, methods ...string) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// numericID answers 404, as for any unknown path, unless the route's {id}
+// is all digits, so /notes/abc is reported as not existing rather than as a
+// note with a malformed id. idParam still rejects 0.
+func numericID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if id == "" || strings.Trim(id, "0123456789") != "" {
+			writeJSONError(w, http.StatusNotFound, msgNotFound)
+			return
+		}
+		next(w, r)
+	}
+}
+
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("session_token")
-		if err != nil {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		// Scripts authenticate with an API key instead of a session.
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			userID, ok := authenticateAPIKey(w, r, key)
+			if !ok {
+				return
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), userIDKey, userID)))
 			return
 		}
 
-		// In a real app, use a session store (Redis/DB). Here we cheat and store UserID in the cookie value directly (INSECURE for prod, but simple for this demo).
-		// Ideally, use a signed cookie or JWT.
-		// For this task, let's assume the cookie value IS the user ID (very insecure, but functional for a quick demo if we don't want to add JWT deps).
-		// BETTER: Let's use a simple in-memory map for sessions to be slightly more realistic.
-		
-		// Wait, I can't easily add a global map without mutexes.
-		// Let's use the cookie value as "userid:signature" or just trust it for this specific "early credential" request?
-		// The user asked for "database as an early credential".
-		// Let's stick to a simple signed-like approach or just the ID for now, acknowledging the security risk in comments.
-		// Actually, let's just store the UserID in the cookie.
-		
-		userID, err := strconv.Atoi(cookie.Value)
+		cookie, err := r.Cookie("session_token")
 		if err != nil {
-			http.Error(w, "invalid session", http.StatusUnauthorized)
+			writeJSONError(w, http.StatusUnauthorized, msgUnauthorized)
+			return
+		}
+		userID, ok := sessions.Get(cookie.Value)
+		if !ok {
+			writeJSONError(w, http.StatusUnauthorized, msgInvalidSession)
 			return
 		}
 
@@ -149,263 +420,347 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// --------- Handlers ----------
-
-func frontHandler(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
-	}
-	if err := tmpl.Execute(w, nil); err != nil {
-		http.Error(w, "template error", http.StatusInternalServerError)
-		log.Println("template error:", err)
-	}
+// basePathMiddleware strips basePath so routes and handlers only see clean
+// paths, and adds it back to any root-relative Location a handler or the
+// mux sets. Paths outside the prefix are 404s.
+func basePathMiddleware(next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+	stripped := http.StripPrefix(basePath, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == basePath {
+			http.Redirect(w, r, basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, basePath+"/") {
+			writeJSONError(w, http.StatusNotFound, msgNotFound)
+			return
+		}
+		stripped.ServeHTTP(&basePathWriter{ResponseWriter: w}, r)
+	})
 }
 
-func registerHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	var body struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
-		return
-	}
+// basePathWriter prefixes a root-relative Location header with basePath just
+// before the status line goes out.
+type basePathWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
-	if err != nil {
-		http.Error(w, "server error", http.StatusInternalServerError)
-		return
+func (w *basePathWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if loc := w.Header().Get("Location"); strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+			w.Header().Set("Location", basePath+loc)
+		}
 	}
+	w.ResponseWriter.WriteHeader(status)
+}
 
-	_, err = db.Exec("INSERT INTO users (username, password) VALUES (?, ?)", body.Username, string(hashedPassword))
-	if err != nil {
-		log.Println("register insert:", err)
-		http.Error(w, "username already taken", http.StatusConflict)
-		return
+func (w *basePathWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
 	}
+	return w.ResponseWriter.Write(b)
+}
 
-	w.WriteHeader(http.StatusCreated)
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *basePathWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
-func loginHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	var body struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
-		return
-	}
+// --------- Helpers ----------
 
-	var id int
-	var hash string
-	err := db.QueryRow("SELECT id, password FROM users WHERE username = ?", body.Username).Scan(&id, &hash)
-	if err != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
-		return
+// requireJSON rejects POST/PUT/PATCH requests whose Content-Type is not
+// application/json (parameters such as charset are allowed) with a 415.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return true
 	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(body.Password)); err != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
-		return
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeJSONError(w, http.StatusUnsupportedMediaType, msgUnsupportedMediaType)
+		return false
 	}
-
-	// Set cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    strconv.Itoa(id),
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-	})
-
-	w.WriteHeader(http.StatusOK)
+	return true
 }
 
-func logoutHandler(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		HttpOnly: true,
-	})
-	w.WriteHeader(http.StatusOK)
+// decodeJSON decodes the request body into dst, refusing bodies larger than
+// maxBodyBytes and fields dst does not declare. On failure it writes the
+// error response and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	return decodeJSONDepth(w, r, dst, 0)
 }
 
-func checkAuthHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_token")
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-	_, err = strconv.Atoi(cookie.Value)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-	w.WriteHeader(http.StatusOK)
+// decodeJSONShallow is decodeJSON for endpoints taking large arrays, such
+// as import and batch, where a deeply nested payload could make the decoder
+// do a lot of work: bodies nesting deeper than maxJSONDepth are refused
+// with a 400 as soon as the decoder reads that far.
+func decodeJSONShallow(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	return decodeJSONDepth(w, r, dst, maxJSONDepth)
 }
 
-func notesHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		getNotesHandler(w, r)
-	case http.MethodPost:
-		createNoteHandler(w, r)
-	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+// decodeJSONDepth is decodeJSON with an optional nesting cap; 0 means none.
+func decodeJSONDepth(w http.ResponseWriter, r *http.Request, dst interface{}, maxDepth int) bool {
+	if !requireJSON(w, r) {
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	var body io.Reader = r.Body
+	if maxDepth > 0 {
+		body = &depthReader{r: body, max: maxDepth}
+	}
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, msgBodyTooLarge)
+			return false
+		}
+		if errors.Is(err, errJSONTooDeep) {
+			writeJSONError(w, http.StatusBadRequest, msgJSONTooDeep, maxDepth)
+			return false
+		}
+		// Decode skips leading whitespace, so a blank body ends the same
+		// way as an empty one.
+		if errors.Is(err, io.EOF) {
+			writeJSONError(w, http.StatusBadRequest, msgBodyEmpty)
+			return false
+		}
+		// encoding/json has no typed error for this case, only the message.
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			writeJSONError(w, http.StatusBadRequest, msgUnknownField, field)
+			return false
+		}
+		writeJSONError(w, http.StatusBadRequest, msgInvalidJSON)
+		return false
 	}
+	return true
 }
 
-func noteItemHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodPut:
-		updateNoteHandler(w, r)
-	case http.MethodDelete:
-		deleteNoteHandler(w, r)
-	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-	}
+// errJSONTooDeep is what a depthReader fails with once the JSON passing
+// through it nests too deeply.
+var errJSONTooDeep = errors.New("JSON nested too deeply")
+
+// depthReader tracks how deeply the arrays and objects in the JSON read
+// through it nest, so the decoder reading from it gets the depth checked in
+// the same pass rather than in one of its own. Brackets inside strings
+// don't count. Past max levels every read fails with errJSONTooDeep, before
+// the decoder is handed the offending bytes. Malformed JSON isn't its
+// concern and is left to the decoder.
+type depthReader struct {
+	r     io.Reader
+	max   int
+	depth int
+	// inString and escaped carry the scanner's place in a string across
+	// reads.
+	inString bool
+	escaped  bool
+	err      error
 }
 
-func getNotesHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(userIDKey).(int)
-	rows, err := db.Query(`SELECT id, user_id, title, content FROM notes WHERE user_id = ? ORDER BY id DESC`, userID)
-	if err != nil {
-		log.Println("getNotes query:", err)
-		http.Error(w, "db error", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var notes []Note
-	for rows.Next() {
-		var n Note
-		if err := rows.Scan(&n.ID, &n.UserID, &n.Title, &n.Content); err != nil {
-			log.Println("getNotes scan:", err)
-			http.Error(w, "db error", http.StatusInternalServerError)
-			return
+func (d *depthReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	n, err := d.r.Read(p)
+	for _, c := range p[:n] {
+		switch {
+		case d.escaped:
+			d.escaped = false
+		case d.inString:
+			if c == '\\' {
+				d.escaped = true
+			} else if c == '"' {
+				d.inString = false
+			}
+		case c == '"':
+			d.inString = true
+		case c == '[' || c == '{':
+			d.depth++
+			if d.depth > d.max {
+				d.err = errJSONTooDeep
+				return 0, d.err
+			}
+		case c == ']' || c == '}':
+			d.depth--
 		}
-		notes = append(notes, n)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(notes)
+	return n, err
 }
 
-func createNoteHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(userIDKey).(int)
-	var body struct {
-		Title   string `json:"title"`
-		Content string `json:"content"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
-		return
+// jsonID is an id in a request body that may arrive as a JSON number (5)
+// or, from clients that keep ids as strings, a numeric string ("5").
+// Anything else, including a fraction or a non-numeric string, fails to
+// decode.
+type jsonID int
+
+func (id *jsonID) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
 	}
-	title := strings.TrimSpace(body.Title)
-	if title == "" {
-		http.Error(w, "title is required", http.StatusBadRequest)
-		return
+	s := string(b)
+	if b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
 	}
-
-	res, err := db.Exec(`INSERT INTO notes (user_id, title, content) VALUES (?, ?, ?)`, userID, title, body.Content)
+	n, err := strconv.Atoi(s)
 	if err != nil {
-		log.Println("createNote insert:", err)
-		http.Error(w, "db error", http.StatusInternalServerError)
-		return
+		return errors.New("invalid id " + string(b))
 	}
-	id64, _ := res.LastInsertId()
+	*id = jsonID(n)
+	return nil
+}
 
-	note := Note{
-		ID:      int(id64),
-		UserID:  userID,
-		Title:   title,
-		Content: body.Content,
+// execer is satisfied by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// normalizeUsername is the single place usernames are canonicalized, so
+// registration and login agree that "Alice" and "alice" are the same user.
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// encodeJSON writes v as the response body. ?pretty=true indents it, for
+// reading with curl; anything else, including a malformed flag, gets the
+// compact form.
+func encodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	enc := json.NewEncoder(w)
+	if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+		enc.SetIndent("", "  ")
 	}
+	return enc.Encode(v)
+}
 
+// writeJSONError writes {"error": msg, "code": id} with the given status
+// code, msg being message id formatted with args in the language
+// localeMiddleware negotiated, or in English if it has no translation.
+func writeJSONError(w http.ResponseWriter, status int, id messageID, args ...interface{}) {
+	msg, lang := localize(id, responseLang(w), args...)
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(note)
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg, "code": string(id)})
 }
 
-func updateNoteHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(userIDKey).(int)
-	idStr := strings.TrimPrefix(r.URL.Path, "/notes/")
-	id, err := strconv.Atoi(idStr)
+// methodNotAllowed answers 405 with an Allow header listing the methods the
+// route does support.
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeJSONError(w, http.StatusMethodNotAllowed, msgMethodNotAllowed)
+}
+
+// idParam parses the {id} path value as a positive ID, writing a 400 and
+// returning false when it isn't one.
+func idParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil || id <= 0 {
-		http.Error(w, "invalid id", http.StatusBadRequest)
-		return
+		writeJSONError(w, http.StatusBadRequest, msgInvalidID)
+		return 0, false
 	}
+	return id, true
+}
 
-	var body struct {
-		Title   string `json:"title"`
-		Content string `json:"content"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
-		return
-	}
-	title := strings.TrimSpace(body.Title)
-	if title == "" {
-		http.Error(w, "title is required", http.StatusBadRequest)
-		return
-	}
+// scanner is satisfied by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	res, err := db.Exec(
-		`UPDATE notes SET title = ?, content = ? WHERE id = ? AND user_id = ?`,
-		title, body.Content, id, userID,
-	)
-	if err != nil {
-		log.Println("updateNote update:", err)
-		http.Error(w, "db error", http.StatusInternalServerError)
-		return
+// scanNote reads a row selected with noteColumns.
+func scanNote(sc scanner) (Note, error) {
+	var n Note
+	var notebookID sql.NullInt64
+	var due sql.NullTime
+	err := sc.Scan(&n.ID, &n.UserID, &n.Title, &n.Content, &n.ContentType, &n.Archived, &n.Done, &n.Pinned, &n.Starred, &n.Color, &notebookID, &due, &n.Position, &n.Version, &n.ViewCount, &n.CreatedAt, &n.UpdatedAt)
+	if notebookID.Valid {
+		id := int(notebookID.Int64)
+		n.NotebookID = &id
 	}
-	aff, _ := res.RowsAffected()
-	if aff == 0 {
-		http.Error(w, "note not found or unauthorized", http.StatusNotFound)
-		return
-	}
-
-	note := Note{
-		ID:      id,
-		UserID:  userID,
-		Title:   title,
-		Content: body.Content,
+	if due.Valid {
+		n.DueAt = &due.Time
 	}
+	return n, err
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(note)
+// fetchNote loads a single note owned by userID. It returns sql.ErrNoRows
+// when the note does not exist or belongs to someone else.
+func fetchNote(ctx context.Context, userID, id int) (Note, error) {
+	row := stmts.get.QueryRowContext(ctx, id, userID)
+	return scanNote(row)
 }
 
-func deleteNoteHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(userIDKey).(int)
-	idStr := strings.TrimPrefix(r.URL.Path, "/notes/")
-	id, err := strconv.Atoi(idStr)
-	if err != nil || id <= 0 {
-		http.Error(w, "invalid id", http.StatusBadRequest)
-		return
-	}
+// --------- Handlers ----------
 
-	res, err := db.Exec(`DELETE FROM notes WHERE id = ? AND user_id = ?`, id, userID)
-	if err != nil {
-		log.Println("deleteNote delete:", err)
-		http.Error(w, "db error", http.StatusInternalServerError)
+func (a *app) frontHandler(w http.ResponseWriter, r *http.Request) {
+	// Anything that reached the catch-all route is an unknown path.
+	if r.URL.Path != "/" {
+		writeJSONError(w, http.StatusNotFound, msgNotFound)
 		return
 	}
-	aff, _ := res.RowsAffected()
-	if aff == 0 {
-		http.Error(w, "note not found or unauthorized", http.StatusNotFound)
-		return
+	t := tmpl
+	if a.cfg.TemplateHotReload {
+		var err error
+		t, err = template.ParseFiles(indexTemplate)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			requestLog(r).Error("template parse", "err", err)
+			return
+		}
+	}
+	// The page is rendered per request and embeds BASE_PATH, so it's
+	// revalidated every time rather than cached like /static/.
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := t.Execute(w, struct{ BasePath string }{basePath}); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		requestLog(r).Error("template error", "err", err)
 	}
+}
+
+// toggleNoteHandler returns a PATCH handler that flips the given boolean
+// column on /notes/{id}/<action>. column is always a literal from main,
+// never request input.
+func toggleNoteHandler(column string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			methodNotAllowed(w, http.MethodPatch)
+			return
+		}
+		userID := r.Context().Value(userIDKey).(int)
+		id, ok := idParam(w, r)
+		if !ok {
+			return
+		}
 
-	w.WriteHeader(http.StatusNoContent)
+		res, err := db.ExecContext(r.Context(), `UPDATE notes SET `+column+` = NOT `+column+`, version = version + 1, updated_at = CURRENT_TIMESTAMP(6) WHERE id = ? AND user_id = ?`, id, userID)
+		if err != nil {
+			requestLog(r).Error("toggleNote update", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		aff, _ := res.RowsAffected()
+		if aff == 0 {
+			writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+			return
+		}
+
+		note, err := fetchNote(r.Context(), userID, id)
+		if err != nil {
+			requestLog(r).Error("toggleNote fetch", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		notifyNote("note.updated", note)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(note)
+	}
 }
@@ -0,0 +1,812 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupServerGlobals gives the package-level state main() would normally
+// configure fresh values for one test, and puts the old ones back after.
+func setupServerGlobals(t testing.TB) {
+	t.Helper()
+	oldSessions, oldLimiter, oldGuard, oldHooks := sessions, noteCreateLimiter, loginGuard, webhooks
+	oldTmpl := tmpl
+	t.Cleanup(func() {
+		sessions.Stop()
+		sessions, noteCreateLimiter, loginGuard, webhooks = oldSessions, oldLimiter, oldGuard, oldHooks
+		tmpl = oldTmpl
+	})
+	sessions = newSessionStore(time.Minute, 0, false)
+	noteCreateLimiter, loginGuard, webhooks = nil, nil, nil
+	tmpl = template.Must(template.ParseFS(templateFS, indexTemplate))
+}
+
+// testConfig is the default Config with uploads going to a fresh temporary
+// directory. Tests register plenty of users, so it also hashes at the
+// lowest bcrypt cost; real hashing cost would dominate.
+func testConfig(t testing.TB) Config {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.UploadDir = t.TempDir()
+	cfg.BcryptCost = bcrypt.MinCost
+	return cfg
+}
+
+// testClient talks to a test server, keeping cookies like a browser.
+type testClient struct {
+	t      *testing.T
+	srv    *httptest.Server
+	client *http.Client
+}
+
+// newTestClient serves h for the rest of the test.
+func newTestClient(t *testing.T, h http.Handler) *testClient {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return (&testClient{t: t, srv: srv}).newClient()
+}
+
+// newClient is another client of the same server with its own cookie jar.
+func (c *testClient) newClient() *testClient {
+	jar, _ := cookiejar.New(nil)
+	return &testClient{t: c.t, srv: c.srv, client: &http.Client{Jar: jar}}
+}
+
+// do sends a request. A string body goes as-is, anything else non-nil as
+// JSON; either way Content-Type is application/json unless headers, given
+// as name/value pairs, say otherwise.
+func (c *testClient) do(method, path string, body interface{}, headers ...string) *http.Response {
+	c.t.Helper()
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = strings.NewReader(b)
+	default:
+		buf, err := json.Marshal(b)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		r = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, c.srv.URL+path, r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// login registers username and logs the client in as them, returning the
+// new user's id.
+func (c *testClient) login(username string) int {
+	c.t.Helper()
+	creds := map[string]string{"username": username, "password": "correct horse battery"}
+	if resp := c.do("POST", "/register", creds); resp.StatusCode != http.StatusCreated {
+		c.t.Fatalf("register %s: %d %s", username, resp.StatusCode, readBody(c.t, resp))
+	}
+	resp := c.do("POST", "/login", creds)
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("login %s: %d %s", username, resp.StatusCode, readBody(c.t, resp))
+	}
+	var u User
+	decodeBody(c.t, resp, &u)
+	return u.ID
+}
+
+// createNote creates a note from body and returns it, failing the test on
+// anything but 201.
+func (c *testClient) createNote(body interface{}) Note {
+	c.t.Helper()
+	resp := c.do("POST", "/notes", body)
+	if resp.StatusCode != http.StatusCreated {
+		c.t.Fatalf("create note: %d %s", resp.StatusCode, readBody(c.t, resp))
+	}
+	var n Note
+	decodeBody(c.t, resp, &n)
+	return n
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func decodeBody(t *testing.T, resp *http.Response, dst interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		t.Fatalf("decode %s response: %v", resp.Request.URL.Path, err)
+	}
+}
+
+// wantStatus fails the test unless resp has the given status.
+func wantStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: status %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, readBody(t, resp))
+	}
+}
+
+// recordedError is the {"error", "code"} body writeJSONError left in w.
+func recordedError(t *testing.T, w *httptest.ResponseRecorder) (msg, code string) {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type %q, want application/json", ct)
+	}
+	var body struct{ Error, Code string }
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %q: %v", w.Body, err)
+	}
+	return body.Error, body.Code
+}
+
+// decodeRequest runs decodeJSON over a request with the given Content-Type
+// and body, decoding into a note input.
+func decodeRequest(t *testing.T, contentType, body string) (*httptest.ResponseRecorder, bool) {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/notes", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	var dst struct {
+		Title   string `json:"title"`
+		Content string `json:"content"`
+	}
+	return w, decodeJSON(w, r, &dst)
+}
+
+func TestDecodeJSONBodyLimit(t *testing.T) {
+	old := maxBodyBytes
+	t.Cleanup(func() { maxBodyBytes = old })
+	maxBodyBytes = 64
+
+	if w, ok := decodeRequest(t, "application/json", `{"title":"short"}`); !ok {
+		t.Fatalf("small body refused: %d %s", w.Code, w.Body)
+	}
+	big := `{"title":"` + strings.Repeat("x", 100) + `"}`
+	w, ok := decodeRequest(t, "application/json", big)
+	if ok || w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized body: ok=%v status %d, want 413", ok, w.Code)
+	}
+	if _, code := recordedError(t, w); code != string(msgBodyTooLarge) {
+		t.Errorf("code = %q", code)
+	}
+}
+
+func TestDecodeJSONUnknownFields(t *testing.T) {
+	if w, ok := decodeRequest(t, "application/json", `{"title":"a","content":"b"}`); !ok {
+		t.Fatalf("known fields refused: %d %s", w.Code, w.Body)
+	}
+	w, ok := decodeRequest(t, "application/json", `{"title":"a","colour":"red"}`)
+	if ok || w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown field: ok=%v status %d, want 400", ok, w.Code)
+	}
+	if msg, code := recordedError(t, w); msg != `unknown field "colour"` || code != string(msgUnknownField) {
+		t.Errorf("error %q (%s) doesn't name the field", msg, code)
+	}
+}
+
+func TestDecodeJSONEmptyBody(t *testing.T) {
+	for body, want := range map[string]messageID{
+		"":          msgBodyEmpty,
+		" \n\t ":    msgBodyEmpty,
+		`{"title":`: msgInvalidJSON,
+	} {
+		w, ok := decodeRequest(t, "application/json", body)
+		if ok || w.Code != http.StatusBadRequest {
+			t.Errorf("body %q: ok=%v status %d, want 400", body, ok, w.Code)
+			continue
+		}
+		if _, code := recordedError(t, w); code != string(want) {
+			t.Errorf("body %q: code %q, want %q", body, code, want)
+		}
+	}
+
+	// Through a handler too, as a client would see it.
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	resp := c.do("POST", "/notes", "", "Content-Type", "application/json")
+	if msg := wantJSONError(t, resp, http.StatusBadRequest); msg != "request body is empty" {
+		t.Errorf("POST /notes with no body: %q", msg)
+	}
+}
+
+func TestDecodeJSONContentType(t *testing.T) {
+	for _, tt := range []struct {
+		contentType string
+		ok          bool
+	}{
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"", false},
+		{"text/plain", false},
+		{"application/x-www-form-urlencoded", false},
+	} {
+		w, ok := decodeRequest(t, tt.contentType, `{"title":"a"}`)
+		if ok != tt.ok {
+			t.Errorf("Content-Type %q: ok = %v, want %v", tt.contentType, ok, tt.ok)
+		}
+		if tt.ok {
+			continue
+		}
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Content-Type %q: status %d, want 415", tt.contentType, w.Code)
+		} else if _, code := recordedError(t, w); code != string(msgUnsupportedMediaType) {
+			t.Errorf("Content-Type %q: code %q", tt.contentType, code)
+		}
+	}
+}
+
+// listNotes is GET /notes?query, failing the test on anything but 200.
+func (c *testClient) listNotes(query string) []Note {
+	c.t.Helper()
+	resp := c.do("GET", "/notes?"+query, nil)
+	wantStatus(c.t, resp, http.StatusOK)
+	var notes []Note
+	decodeBody(c.t, resp, &notes)
+	return notes
+}
+
+// noteIDs is the ids of notes, in order.
+func noteIDs(notes []Note) []int {
+	ids := make([]int, len(notes))
+	for i, n := range notes {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+func TestArchiveNote(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	kept := c.createNote(map[string]string{"title": "kept"})
+	old := c.createNote(map[string]string{"title": "old"})
+	path := fmt.Sprintf("/notes/%d/archive", old.ID)
+
+	resp := c.do("PATCH", path, nil)
+	wantStatus(t, resp, http.StatusOK)
+	var got Note
+	decodeBody(t, resp, &got)
+	if !got.Archived {
+		t.Fatalf("archived note = %+v", got)
+	}
+	// Archiving hides a note from the default list without deleting it.
+	if ids := noteIDs(c.listNotes("")); !slices.Equal(ids, []int{kept.ID}) {
+		t.Fatalf("default list = %v, want only %d", ids, kept.ID)
+	}
+	if ids := noteIDs(c.listNotes("archived=true")); !slices.Equal(ids, []int{old.ID}) {
+		t.Fatalf("archived list = %v, want only %d", ids, old.ID)
+	}
+	wantStatus(t, c.do("GET", fmt.Sprintf("/notes/%d", old.ID), nil), http.StatusOK)
+
+	// The same PATCH brings it back.
+	wantStatus(t, c.do("PATCH", path, nil), http.StatusOK)
+	if n := len(c.listNotes("")); n != 2 {
+		t.Fatalf("default list has %d notes after unarchiving, want 2", n)
+	}
+	wantStatus(t, c.do("GET", "/notes?archived=maybe", nil), http.StatusBadRequest)
+}
+
+func TestFrontHandlerEmbedded(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	w := httptest.NewRecorder()
+	a.frontHandler(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<title>Go Notes App</title>") {
+		t.Fatalf("status %d, body %.200s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	a.frontHandler(w, httptest.NewRequest("GET", "/nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown path: status %d, want 404", w.Code)
+	}
+}
+
+func TestFrontHandlerHotReload(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	a.cfg.TemplateHotReload = true
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("static", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits on disk show up on the next request, without a restart.
+	for _, title := range []string{"first", "second"} {
+		page := "<title>" + title + "</title>"
+		if err := os.WriteFile(indexTemplate, []byte(page), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		a.frontHandler(w, httptest.NewRequest("GET", "/", nil))
+		if want := "<title>" + title + "</title>"; w.Body.String() != want {
+			t.Fatalf("body = %q, want %q", w.Body, want)
+		}
+	}
+
+	if err := os.WriteFile(indexTemplate, []byte("{{.Broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	a.frontHandler(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("broken template: status %d, want 500", w.Code)
+	}
+}
+
+func TestDoneNote(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	open := c.createNote(map[string]string{"title": "open"})
+	finished := c.createNote(map[string]string{"title": "finished"})
+
+	resp := c.do("PATCH", fmt.Sprintf("/notes/%d/done", finished.ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	var got Note
+	decodeBody(t, resp, &got)
+	if !got.Done || got.Version != 2 {
+		t.Fatalf("note marked done = %+v", got)
+	}
+
+	if ids := noteIDs(c.listNotes("done=true")); !slices.Equal(ids, []int{finished.ID}) {
+		t.Fatalf("done=true lists %v", ids)
+	}
+	if ids := noteIDs(c.listNotes("done=false")); !slices.Equal(ids, []int{open.ID}) {
+		t.Fatalf("done=false lists %v", ids)
+	}
+	if n := len(c.listNotes("")); n != 2 {
+		t.Fatalf("unfiltered list has %d notes, want 2", n)
+	}
+
+	// Marking it again undoes it.
+	resp = c.do("PATCH", fmt.Sprintf("/notes/%d/done", finished.ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &got)
+	if got.Done {
+		t.Fatal("second PATCH left the note done")
+	}
+	wantStatus(t, c.do("GET", "/notes?done=true&done=false", nil), http.StatusBadRequest)
+	wantStatus(t, c.do("PATCH", "/notes/999999/done", nil), http.StatusNotFound)
+}
+
+// wantJSONError fails the test unless resp has the given status and a
+// JSON {"error": ...} body.
+func wantJSONError(t *testing.T, resp *http.Response, status int) string {
+	t.Helper()
+	wantStatus(t, resp, status)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s %s: Content-Type %q, want application/json", resp.Request.Method, resp.Request.URL.Path, ct)
+	}
+	var body struct{ Error string }
+	decodeBody(t, resp, &body)
+	if body.Error == "" {
+		t.Fatalf("%s %s: no error message", resp.Request.Method, resp.Request.URL.Path)
+	}
+	return body.Error
+}
+
+func TestJSONNotFoundAndMethodNotAllowed(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	for _, path := range []string{"/nope", "/notes/1/nope", "/notes/abc"} {
+		wantJSONError(t, c.do("GET", path, nil), http.StatusNotFound)
+	}
+	wantJSONError(t, c.do("GET", "/notes/12345", nil), http.StatusNotFound)
+
+	resp := c.do("PATCH", "/notes", nil)
+	wantJSONError(t, resp, http.StatusMethodNotAllowed)
+	if allow := resp.Header.Get("Allow"); allow != strings.Join(notesMethods, ", ") {
+		t.Errorf("Allow = %q", allow)
+	}
+	resp = c.do("POST", "/openapi.json", nil)
+	wantJSONError(t, resp, http.StatusMethodNotAllowed)
+	if allow := resp.Header.Get("Allow"); allow != "GET" {
+		t.Errorf("Allow = %q, want GET", allow)
+	}
+}
+
+func TestIDParam(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		id    int
+		ok    bool
+	}{
+		{"5", 5, true},
+		{"007", 7, true},
+		{"0", 0, false},
+		{"-3", 0, false},
+		{"abc", 0, false},
+		{"", 0, false},
+	} {
+		r := httptest.NewRequest("GET", "/notes/x", nil)
+		r.SetPathValue("id", tt.value)
+		w := httptest.NewRecorder()
+		id, ok := idParam(w, r)
+		if id != tt.id || ok != tt.ok {
+			t.Errorf("idParam(%q) = %d, %v, want %d, %v", tt.value, id, ok, tt.id, tt.ok)
+		}
+		if !ok && w.Code != http.StatusBadRequest {
+			t.Errorf("idParam(%q): status %d, want 400", tt.value, w.Code)
+		}
+	}
+}
+
+func TestNotePathRouting(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "a"})
+
+	resp := c.do("GET", fmt.Sprintf("/notes/%d", note.ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	// Sub-resources and extra segments are routed on their own, never
+	// read as part of the id.
+	wantJSONError(t, c.do("GET", fmt.Sprintf("/notes/%d/extra", note.ID), nil), http.StatusNotFound)
+	wantJSONError(t, c.do("GET", fmt.Sprintf("/notes/%d/extra/more", note.ID), nil), http.StatusNotFound)
+	wantJSONError(t, c.do("GET", "/notes/1.5", nil), http.StatusNotFound)
+	wantStatus(t, c.do("GET", "/notes/0", nil), http.StatusBadRequest)
+}
+
+func TestBasePath(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	old := basePath
+	t.Cleanup(func() { basePath = old })
+	basePath = "/todo"
+	c := newTestClient(t, a.routes())
+	// The client doesn't follow redirects, so /todo's can be checked.
+	c.client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	creds := map[string]string{"username": "alice", "password": "correct horse battery"}
+	wantStatus(t, c.do("POST", "/todo/register", creds), http.StatusCreated)
+	wantStatus(t, c.do("POST", "/todo/login", creds), http.StatusOK)
+	resp := c.do("POST", "/todo/notes", map[string]string{"title": "prefixed"})
+	wantStatus(t, resp, http.StatusCreated)
+	var note Note
+	decodeBody(t, resp, &note)
+	if loc := resp.Header.Get("Location"); loc != fmt.Sprintf("/todo/notes/%d", note.ID) {
+		t.Fatalf("Location = %q, want it under the base path", loc)
+	}
+	wantStatus(t, c.do("GET", fmt.Sprintf("/todo/notes/%d", note.ID), nil), http.StatusOK)
+
+	// Outside the prefix nothing is served.
+	wantJSONError(t, c.do("GET", fmt.Sprintf("/notes/%d", note.ID), nil), http.StatusNotFound)
+	wantJSONError(t, c.do("GET", "/todoish/notes", nil), http.StatusNotFound)
+
+	resp = c.do("GET", "/todo", nil)
+	wantStatus(t, resp, http.StatusMovedPermanently)
+	if loc := resp.Header.Get("Location"); loc != "/todo/" {
+		t.Fatalf("Location = %q, want /todo/", loc)
+	}
+	resp = c.do("GET", "/todo/", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); !strings.Contains(body, `const basePath = "/todo";`) {
+		t.Fatal("front page doesn't carry the base path")
+	}
+}
+
+func TestTimestampsMarshalUTC(t *testing.T) {
+	local := time.Date(2030, 6, 1, 12, 0, 0, 0, time.FixedZone("UTC+5", 5*3600))
+	const want = `"2030-06-01T07:00:00Z"`
+	due := local
+	for name, v := range map[string]interface{}{
+		"note":       Note{CreatedAt: local, UpdatedAt: local, DueAt: &due},
+		"shared":     SharedNote{UpdatedAt: local},
+		"revision":   Revision{EditedAt: local},
+		"attachment": Attachment{CreatedAt: local},
+		"api key":    APIKey{CreatedAt: local},
+		"audit":      NoteAudit{CreatedAt: local},
+		"admin user": AdminUser{LastLoginAt: &due},
+	} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "+05:00") || !strings.Contains(string(b), want) {
+			t.Errorf("%s: %s, want times as %s", name, b, want)
+		}
+	}
+	// Marshalling mustn't change the caller's value.
+	if due.Location() != local.Location() {
+		t.Error("DueAt was converted in place")
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	for _, tc := range []struct{ listen, host, port, want string }{
+		{"", "", "", ":8080"},
+		{"", "", "9000", ":9000"},
+		{"", "127.0.0.1", "", "127.0.0.1:8080"},
+		{"", "127.0.0.1", "9000", "127.0.0.1:9000"},
+		{"", "::1", "9000", "[::1]:9000"},
+		{"10.0.0.5:7000", "127.0.0.1", "9000", "10.0.0.5:7000"},
+	} {
+		if got := listenAddr(tc.listen, tc.host, tc.port); got != tc.want {
+			t.Errorf("listenAddr(%q, %q, %q) = %q, want %q", tc.listen, tc.host, tc.port, got, tc.want)
+		}
+	}
+
+	t.Setenv("LISTEN_ADDR", "")
+	t.Setenv("HOST", "127.0.0.1")
+	t.Setenv("PORT", "9000")
+	cfg, err := LoadConfig()
+	if err != nil || cfg.Addr != "127.0.0.1:9000" {
+		t.Fatalf("LoadConfig: Addr %q, err %v", cfg.Addr, err)
+	}
+	t.Setenv("PORT", "http")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("LoadConfig accepted PORT=http")
+	}
+}
+
+func TestNoteCounts(t *testing.T) {
+	for _, tc := range []struct {
+		content      string
+		chars, words int
+	}{
+		{"", 0, 0},
+		{"hello world", 11, 2},
+		{"  spaced\tout\n\nwords  ", 21, 3},
+		{"héllo wörld", 11, 2},
+		{"日本語のメモ", 6, 1},
+		{"🎉 party 🎉", 9, 3},
+	} {
+		b, err := json.Marshal(Note{Content: tc.content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			CharCount int `json:"char_count"`
+			WordCount int `json:"word_count"`
+		}
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.CharCount != tc.chars || got.WordCount != tc.words {
+			t.Errorf("%q: char_count %d, word_count %d; want %d, %d", tc.content, got.CharCount, got.WordCount, tc.chars, tc.words)
+		}
+	}
+}
+
+func TestOptionsAllow(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	for path, want := range map[string]string{
+		"/notes":   "GET, HEAD, POST, OPTIONS",
+		"/notes/7": "GET, HEAD, PUT, DELETE, OPTIONS",
+	} {
+		// No session needed to ask.
+		resp := c.do("OPTIONS", path, nil)
+		wantStatus(t, resp, http.StatusNoContent)
+		if got := resp.Header.Get("Allow"); got != want {
+			t.Errorf("OPTIONS %s: Allow %q, want %q", path, got, want)
+		}
+		if body := readBody(t, resp); body != "" {
+			t.Errorf("OPTIONS %s: body %q", path, body)
+		}
+	}
+
+	// A 405 lists the same methods.
+	c.login("alice")
+	for path, want := range map[string]string{
+		"/notes":   "GET, HEAD, POST, OPTIONS",
+		"/notes/7": "GET, HEAD, PUT, DELETE, OPTIONS",
+	} {
+		resp := c.do("PATCH", path, nil)
+		wantJSONError(t, resp, http.StatusMethodNotAllowed)
+		if got := resp.Header.Get("Allow"); got != want {
+			t.Errorf("PATCH %s: Allow %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestPrettyJSON(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	resp := c.do("POST", "/notes?pretty=true", map[string]string{"title": "pretty"})
+	wantStatus(t, resp, http.StatusCreated)
+	body := readBody(t, resp)
+	if !strings.HasPrefix(body, "{\n  \"id\": ") || !strings.Contains(body, "\n  \"title\": \"pretty\",\n") {
+		t.Fatalf("pretty body = %q, want two-space indentation", body)
+	}
+	var n Note
+	if err := json.Unmarshal([]byte(body), &n); err != nil {
+		t.Fatal(err)
+	}
+
+	path := fmt.Sprintf("/notes/%d", n.ID)
+	for query, pretty := range map[string]bool{"": false, "?pretty=false": false, "?pretty=nonsense": false, "?pretty=1": true, "?pretty=true": true} {
+		resp := c.do("GET", path+query, nil)
+		wantStatus(t, resp, http.StatusOK)
+		body := strings.TrimSuffix(readBody(t, resp), "\n")
+		if got := strings.Contains(body, "\n"); got != pretty {
+			t.Errorf("GET %s%s: body %q, want pretty %v", path, query, body, pretty)
+		}
+	}
+}
+
+func TestJSONID(t *testing.T) {
+	for in, want := range map[string]jsonID{`5`: 5, `"5"`: 5, `"042"`: 42, `null`: 0} {
+		var id jsonID
+		if err := json.Unmarshal([]byte(in), &id); err != nil || id != want {
+			t.Errorf("%s: %d, %v; want %d", in, id, err, want)
+		}
+	}
+	for _, in := range []string{`"five"`, `""`, `5.5`, `"5.0"`, `1e3`, `true`, `[5]`, `{"id":5}`, `" 5"`} {
+		var id jsonID
+		if err := json.Unmarshal([]byte(in), &id); err == nil {
+			t.Errorf("%s accepted as %d", in, id)
+		}
+	}
+
+	var body struct {
+		IDs []jsonID `json:"ids"`
+	}
+	if err := json.Unmarshal([]byte(`{"ids":[3,"4",5]}`), &body); err != nil || !slices.Equal(body.IDs, []jsonID{3, 4, 5}) {
+		t.Fatalf("mixed ids = %v, %v", body.IDs, err)
+	}
+}
+
+func TestNotesRouting(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	// /notes/ is the collection, just like /notes.
+	resp := c.do("POST", "/notes/", map[string]string{"title": "slash"})
+	wantStatus(t, resp, http.StatusCreated)
+	var n Note
+	decodeBody(t, resp, &n)
+	c.createNote(map[string]string{"title": "plain"})
+	resp = c.do("DELETE", "/notes/", nil)
+	wantStatus(t, resp, http.StatusMethodNotAllowed)
+	if allow := c.do("DELETE", "/notes", nil).Header.Get("Allow"); resp.Header.Get("Allow") != allow {
+		t.Errorf("Allow on /notes/ = %q, on /notes = %q", resp.Header.Get("Allow"), allow)
+	}
+
+	// A numeric suffix is a note.
+	resp = c.do("GET", fmt.Sprintf("/notes/%d", n.ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	var got Note
+	decodeBody(t, resp, &got)
+	if got.ID != n.ID || got.Title != "slash" {
+		t.Fatalf("GET /notes/%d = %+v", n.ID, got)
+	}
+	wantJSONError(t, c.do("GET", "/notes/999999", nil), http.StatusNotFound)
+	if msg := wantJSONError(t, c.do("GET", "/notes/0", nil), http.StatusBadRequest); msg != "invalid id" {
+		t.Errorf("/notes/0: %q, want invalid id", msg)
+	}
+
+	// Anything else under /notes/ doesn't exist, logged in or not.
+	anon := c.newClient()
+	for _, path := range []string{"/notes/abc", "/notes/-1", "/notes/1e3", "/notes/%205"} {
+		for _, cl := range []*testClient{c, anon} {
+			if msg := wantJSONError(t, cl.do("GET", path, nil), http.StatusNotFound); msg != "not found" {
+				t.Errorf("%s: %q", path, msg)
+			}
+		}
+	}
+}
+
+func TestNotesTrailingSlashList(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	c.createNote(map[string]string{"title": "one"})
+	c.createNote(map[string]string{"title": "two"})
+
+	plain := c.do("GET", "/notes", nil)
+	wantStatus(t, plain, http.StatusOK)
+	slash := c.do("GET", "/notes/", nil)
+	wantStatus(t, slash, http.StatusOK)
+	if a, b := readBody(t, plain), readBody(t, slash); a != b {
+		t.Fatalf("/notes = %s\n/notes/ = %s", a, b)
+	}
+}
+
+func TestDepthReader(t *testing.T) {
+	for _, tc := range []struct {
+		body    string
+		tooDeep bool
+	}{
+		{`[[1]]`, false},
+		{`[[[1]]]`, false},
+		{`[[[[1]]]]`, true},
+		{`{"a":{"b":{"c":{}}}}`, true},
+		{`[[1],[2],[3],{"a":[]}]`, false},
+		{`{"a":"[[[[[[[["}`, false},
+		{`{"a":"\"[[[[","b":"\\"}`, false},
+		{`["\\",[[[1]]]]`, true},
+		{`[1] [[[[2]]]]`, true}, // the reader sees bytes past the first value
+	} {
+		for name, r := range map[string]io.Reader{
+			"whole":        strings.NewReader(tc.body),
+			"byte by byte": iotest.OneByteReader(strings.NewReader(tc.body)),
+		} {
+			_, err := io.ReadAll(&depthReader{r: r, max: 3})
+			if got := errors.Is(err, errJSONTooDeep); got != tc.tooDeep || (err != nil && !got) {
+				t.Errorf("%s, %s: err = %v, want too deep %v", tc.body, name, err, tc.tooDeep)
+			}
+		}
+	}
+}
+
+// TestDecodeJSONShallowStopsEarly checks a pathologically nested body is
+// refused having read only a little of it, not buffered or parsed whole.
+func TestDecodeJSONShallowStopsEarly(t *testing.T) {
+	old := maxJSONDepth
+	t.Cleanup(func() { maxJSONDepth = old })
+	maxJSONDepth = 32
+
+	nested := strings.Repeat("[", 500_000) + strings.Repeat("]", 500_000)
+	body := &countingReader{r: strings.NewReader(nested)}
+	r := httptest.NewRequest("POST", "/notes/import", body)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	var dst interface{}
+	if decodeJSONShallow(w, r, &dst) {
+		t.Fatal("nested body accepted")
+	}
+	if msg, code := recordedError(t, w); w.Code != http.StatusBadRequest || code != string(msgJSONTooDeep) || msg != "JSON nested more than 32 levels deep" {
+		t.Fatalf("status %d, %q (%s)", w.Code, msg, code)
+	}
+	if body.n > 64<<10 {
+		t.Errorf("read %d of %d bytes before refusing", body.n, len(nested))
+	}
+
+	// decodeJSON has no cap.
+	r = httptest.NewRequest("POST", "/notes", strings.NewReader(`{"a":[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[1]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]]}`))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	if !decodeJSON(w, r, &dst) {
+		t.Fatalf("decodeJSON refused a nested body: %d %s", w.Code, w.Body)
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
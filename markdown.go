@@ -0,0 +1,226 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	mdHeading     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	mdBullet      = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	mdOrdered     = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+	mdLink        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold        = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	mdItalic      = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	mdSafeSchemes = []string{"http:", "https:", "mailto:"}
+)
+
+// renderMarkdown converts a small Markdown subset to HTML: ATX headings,
+// paragraphs, bullet and numbered lists, fenced code blocks, **bold**,
+// *italic*, `code` and [links](url). All input is HTML-escaped before any
+// markup is added, so raw HTML in a note is shown as text, and links are
+// limited to http(s), mailto and relative URLs.
+func renderMarkdown(src string) string {
+	var b strings.Builder
+	var para []string
+	list := "" // the list element currently open, "ul" or "ol"
+	inCode := false
+
+	flushPara := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>" + renderInline(strings.Join(para, "\n")) + "</p>\n")
+			para = nil
+		}
+	}
+	openList := func(tag string) {
+		if list != tag {
+			if list != "" {
+				b.WriteString("</" + list + ">\n")
+			}
+			b.WriteString("<" + tag + ">\n")
+			list = tag
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			b.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if inCode {
+			if strings.HasPrefix(trimmed, "```") {
+				b.WriteString("</code></pre>\n")
+				inCode = false
+			} else {
+				b.WriteString(html.EscapeString(line) + "\n")
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "```") {
+			flushPara()
+			closeList()
+			b.WriteString("<pre><code>")
+			inCode = true
+		} else if trimmed == "" {
+			flushPara()
+			closeList()
+		} else if m := mdHeading.FindStringSubmatch(trimmed); m != nil {
+			flushPara()
+			closeList()
+			tag := "h" + string(rune('0'+len(m[1])))
+			b.WriteString("<" + tag + ">" + renderInline(m[2]) + "</" + tag + ">\n")
+		} else if m := mdBullet.FindStringSubmatch(trimmed); m != nil {
+			flushPara()
+			openList("ul")
+			b.WriteString("<li>" + renderInline(m[1]) + "</li>\n")
+		} else if m := mdOrdered.FindStringSubmatch(trimmed); m != nil {
+			flushPara()
+			openList("ol")
+			b.WriteString("<li>" + renderInline(m[1]) + "</li>\n")
+		} else {
+			closeList()
+			para = append(para, trimmed)
+		}
+	}
+	if inCode {
+		b.WriteString("</code></pre>\n")
+	}
+	flushPara()
+	closeList()
+	return b.String()
+}
+
+// renderInline escapes s and applies inline markup. Text between backticks
+// becomes code and is left otherwise untouched.
+func renderInline(s string) string {
+	parts := strings.Split(s, "`")
+	// An unmatched trailing backtick is literal.
+	if len(parts)%2 == 0 {
+		parts[len(parts)-2] += "`" + parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+	}
+	var b strings.Builder
+	for i, part := range parts {
+		part = html.EscapeString(part)
+		if i%2 == 1 {
+			b.WriteString("<code>" + part + "</code>")
+			continue
+		}
+		part = mdLink.ReplaceAllStringFunc(part, func(m string) string {
+			sub := mdLink.FindStringSubmatch(m)
+			if !safeLinkURL(html.UnescapeString(sub[2])) {
+				return sub[1]
+			}
+			return `<a href="` + sub[2] + `" rel="nofollow noopener noreferrer">` + sub[1] + `</a>`
+		})
+		part = mdBold.ReplaceAllString(part, "<strong>$1$2</strong>")
+		part = mdItalic.ReplaceAllString(part, "<em>$1</em>")
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// safeLinkURL allows relative URLs and a few harmless schemes, keeping out
+// javascript: and data: links.
+func safeLinkURL(u string) bool {
+	lower := strings.ToLower(strings.TrimSpace(u))
+	for _, scheme := range mdSafeSchemes {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	// No scheme: a colon may only appear after the first path, query or
+	// fragment delimiter.
+	colon := strings.Index(lower, ":")
+	return colon < 0 || (strings.IndexAny(lower, "/?#") >= 0 && strings.IndexAny(lower, "/?#") < colon)
+}
+
+// renderNoteHandler returns the note's content as HTML, interpreted
+// according to its content type.
+func renderNoteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+	note, err := fetchNote(r.Context(), userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("renderNote fetch", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The fragment has no scripts or styles of its own.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Write([]byte(renderContent(note.ContentType, note.Content)))
+}
+
+// renderContent renders content as HTML the way contentType calls for.
+// Unknown types fall back to plain.
+func renderContent(contentType, content string) string {
+	switch contentType {
+	case "markdown":
+		return renderMarkdown(content)
+	case "checklist":
+		return renderChecklist(content)
+	}
+	return renderPlain(content)
+}
+
+// renderPlain escapes text, turning blank-line-separated blocks into
+// paragraphs and keeping single line breaks.
+func renderPlain(src string) string {
+	var b strings.Builder
+	for _, para := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n\n") {
+		para = strings.Trim(para, "\n")
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+		b.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(para), "\n", "<br>\n") + "</p>\n")
+	}
+	return b.String()
+}
+
+// renderChecklist renders one item per non-blank line as a read-only
+// checkbox list. A line may start with a Markdown-style "- " bullet and a
+// "[ ]" or "[x]" box; items without a box are unchecked.
+func renderChecklist(src string) string {
+	var b strings.Builder
+	b.WriteString("<ul class=\"checklist\">\n")
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		item := strings.TrimSpace(line)
+		item = strings.TrimSpace(strings.TrimPrefix(item, "- "))
+		if item == "" {
+			continue
+		}
+		checked := false
+		if len(item) >= 3 && item[0] == '[' && item[2] == ']' && strings.ContainsRune(" xX", rune(item[1])) {
+			checked = item[1] != ' '
+			item = strings.TrimSpace(item[3:])
+		}
+		box := `<input type="checkbox" disabled>`
+		if checked {
+			box = `<input type="checkbox" disabled checked>`
+		}
+		b.WriteString("<li>" + box + " " + html.EscapeString(item) + "</li>\n")
+	}
+	b.WriteString("</ul>\n")
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"# Title", "<h1>Title</h1>\n"},
+		{"### Sub ###", "<h3>Sub</h3>\n"},
+		{"some **bold** and *italic* text", "<p>some <strong>bold</strong> and <em>italic</em> text</p>\n"},
+		{"__bold__", "<p><strong>bold</strong></p>\n"},
+		{"one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>\n"},
+		{"- a\n- b\n1. c", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n<ol>\n<li>c</li>\n</ol>\n"},
+		{"use `a < b` here", "<p>use <code>a &lt; b</code> here</p>\n"},
+		{"```\n<b>**x**</b>\n```", "<pre><code>&lt;b&gt;**x**&lt;/b&gt;\n</code></pre>\n"},
+		{"[site](https://example.com)", `<p><a href="https://example.com" rel="nofollow noopener noreferrer">site</a></p>` + "\n"},
+	} {
+		if got := renderMarkdown(tc.src); got != tc.want {
+			t.Errorf("renderMarkdown(%q) =\n%q\nwant\n%q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestRenderMarkdownEscapesHTML(t *testing.T) {
+	for _, src := range []string{
+		"<script>alert(1)</script>",
+		"# <script>alert(1)</script>",
+		"- <img src=x onerror=alert(1)>",
+		`[x](javascript:alert(1))`,
+		`[x](JavaScript:alert(1))`,
+		`[x](data:text/html,<script>alert(1)</script>)`,
+		`[x](" onmouseover="alert(1))`,
+	} {
+		got := renderMarkdown(src)
+		for _, bad := range []string{"<script", "<img", "javascript:", "data:", `" onmouseover`} {
+			if strings.Contains(strings.ToLower(got), strings.ToLower(bad)) {
+				t.Errorf("renderMarkdown(%q) = %q, contains %s", src, got, bad)
+			}
+		}
+	}
+}
+
+func TestSafeLinkURL(t *testing.T) {
+	for u, want := range map[string]bool{
+		"https://example.com": true,
+		"mailto:a@b.c":        true,
+		"/notes/1":            true,
+		"page?at=10:30":       true,
+		"javascript:alert(1)": false,
+		" JAVASCRIPT:x":       false,
+		"data:text/html,x":    false,
+		"vbscript:x":          false,
+	} {
+		if got := safeLinkURL(u); got != want {
+			t.Errorf("safeLinkURL(%q) = %v, want %v", u, got, want)
+		}
+	}
+}
+
+func TestRenderNoteHandler(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{
+		"title": "md", "content_type": "markdown",
+		"content": "# Hi\n\n**there** <script>alert(1)</script>",
+	})
+
+	resp := c.do("GET", fmt.Sprintf("/notes/%d/render", note.ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := readBody(t, resp)
+	if !strings.Contains(body, "<h1>Hi</h1>") || !strings.Contains(body, "<strong>there</strong>") {
+		t.Errorf("body = %q, want a heading and bold", body)
+	}
+	if strings.Contains(body, "<script>") || !strings.Contains(body, "&lt;script&gt;") {
+		t.Errorf("body = %q, want the script escaped", body)
+	}
+
+	other := c.newClient()
+	other.login("bob")
+	wantStatus(t, other.do("GET", fmt.Sprintf("/notes/%d/render", note.ID), nil), http.StatusNotFound)
+}
+
+func TestRenderContent(t *testing.T) {
+	for _, tc := range []struct {
+		contentType, content, want string
+	}{
+		{"plain", "a <b>\nc\n\n\nd", "<p>a &lt;b&gt;<br>\nc</p>\n<p>d</p>\n"},
+		{"plain", "# not a heading", "<p># not a heading</p>\n"},
+		{"markdown", "# heading", "<h1>heading</h1>\n"},
+		{"checklist", "- [ ] eggs\n[x] milk\n\n  bread <b>\n[X] tea",
+			"<ul class=\"checklist\">\n" +
+				"<li><input type=\"checkbox\" disabled> eggs</li>\n" +
+				"<li><input type=\"checkbox\" disabled checked> milk</li>\n" +
+				"<li><input type=\"checkbox\" disabled> bread &lt;b&gt;</li>\n" +
+				"<li><input type=\"checkbox\" disabled checked> tea</li>\n" +
+				"</ul>\n"},
+		// A type the server doesn't know is rendered as plain text.
+		{"", "*x*", "<p>*x*</p>\n"},
+		{"rich", "*x*", "<p>*x*</p>\n"},
+	} {
+		if got := renderContent(tc.contentType, tc.content); got != tc.want {
+			t.Errorf("renderContent(%q, %q) = %q, want %q", tc.contentType, tc.content, got, tc.want)
+		}
+	}
+}
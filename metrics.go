@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the histogram upper bounds in seconds (Prometheus defaults).
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	path   string
+	status int
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, non-cumulative
+	sum    float64
+	count  uint64
+}
+
+// metrics is a minimal, concurrency-safe registry for the /metrics endpoint.
+type metrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[string]*histogram
+}
+
+var appMetrics = &metrics{
+	requests:  map[requestKey]uint64{},
+	durations: map[string]*histogram{},
+}
+
+func (m *metrics) observe(path string, status int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{path, status}]++
+
+	h := m.durations[path]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[path] = h
+	}
+	secs := d.Seconds()
+	for i, b := range durationBuckets {
+		if secs <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += secs
+	h.count++
+}
+
+// writeTo renders the registry in the Prometheus text exposition format.
+func (m *metrics) writeTo(w http.ResponseWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	fmt.Fprintln(w, "# HELP http_requests_total Total HTTP requests by route and status.")
+	fmt.Fprintln(w, "# TYPE http_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "http_requests_total{path=%q,status=\"%d\"} %d\n", k.path, k.status, m.requests[k])
+	}
+
+	paths := make([]string, 0, len(m.durations))
+	for p := range m.durations {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	fmt.Fprintln(w, "# HELP http_request_duration_seconds HTTP request latency by route.")
+	fmt.Fprintln(w, "# TYPE http_request_duration_seconds histogram")
+	for _, p := range paths {
+		h := m.durations[p]
+		var cum uint64
+		for i, b := range durationBuckets {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "http_request_duration_seconds_bucket{path=%q,le=%q} %d\n", p, strconv.FormatFloat(b, 'g', -1, 64), cum)
+		}
+		fmt.Fprintf(w, "http_request_duration_seconds_bucket{path=%q,le=\"+Inf\"} %d\n", p, h.count)
+		fmt.Fprintf(w, "http_request_duration_seconds_sum{path=%q} %g\n", p, h.sum)
+		fmt.Fprintf(w, "http_request_duration_seconds_count{path=%q} %d\n", p, h.count)
+	}
+}
+
+// metricsOther labels every request no route claimed, so unknown paths
+// share one series.
+const metricsOther = "other"
+
+// metricsLabel is the route r was served by, such as "/notes/{id}" or
+// "/shared/{slug}", read once the ServeMux has dispatched it. Labelling by
+// pattern rather than path keeps the series to one per route whatever
+// clients ask for. Requests the mux matched to nothing, or only to the "/"
+// catch-all, are metricsOther. The middlewares between metricsMiddleware
+// and the mux must pass r along as is for the pattern to be seen here.
+func metricsLabel(r *http.Request) string {
+	if r.Pattern == "" || (r.Pattern == "/" && r.URL.Path != "/") {
+		return metricsOther
+	}
+	return r.Pattern
+}
+
+// statusRecorder captures the status code written by the wrapped handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+		appMetrics.observe(metricsLabel(r), rec.status, elapsed)
+		requestLog(r).Debug("request", "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", elapsed, "ip", clientIP(r))
+	})
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	appMetrics.writeTo(w)
+}
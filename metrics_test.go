@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useFreshMetrics gives the test an empty registry.
+func useFreshMetrics(t *testing.T) {
+	old := appMetrics
+	t.Cleanup(func() { appMetrics = old })
+	appMetrics = &metrics{requests: map[requestKey]uint64{}, durations: map[string]*histogram{}}
+}
+
+// scrapeMetrics renders the registry as GET /metrics would.
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	return w.Body.String()
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	useFreshMetrics(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/notes/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "2" {
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/shared/{slug}", func(w http.ResponseWriter, r *http.Request) {})
+	h := metricsMiddleware(mux)
+	for _, path := range []string{"/notes/1", "/notes/2", "/notes/abc", "/shared/x1", "/shared/y2", "/nope"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	body := scrapeMetrics(t)
+	for _, line := range []string{
+		`http_requests_total{path="/notes/{id}",status="200"} 2`,
+		`http_requests_total{path="/notes/{id}",status="404"} 1`,
+		`http_request_duration_seconds_bucket{path="/notes/{id}",le="+Inf"} 3`,
+		`http_request_duration_seconds_count{path="/notes/{id}"} 3`,
+		`http_requests_total{path="/shared/{slug}",status="200"} 2`,
+		`http_requests_total{path="other",status="404"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics lack %s:\n%s", line, body)
+		}
+	}
+}
+
+// TestMetricsRandomPaths checks clients can't add series by inventing
+// paths: through the real routes, a burst of unknown paths and slugs
+// leaves the registry no bigger than a single one did.
+func TestMetricsRandomPaths(t *testing.T) {
+	useFreshMetrics(t)
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	series := func() int {
+		appMetrics.mu.Lock()
+		defer appMetrics.mu.Unlock()
+		return len(appMetrics.requests) + len(appMetrics.durations)
+	}
+
+	c.do("GET", "/random-0", nil)
+	c.do("GET", "/shared/slug-0", nil)
+	c.do("GET", "/notes/abc-0", nil)
+	before := series()
+	for i := 1; i <= 20; i++ {
+		c.do("GET", fmt.Sprintf("/random-%d/x", i), nil)
+		c.do("GET", fmt.Sprintf("/shared/slug-%d", i), nil)
+		c.do("GET", fmt.Sprintf("/notes/abc-%d", i), nil)
+	}
+	if after := series(); after != before {
+		t.Fatalf("%d series after random paths, %d before", after, before)
+	}
+	if body := scrapeMetrics(t); strings.Contains(body, "random") || strings.Contains(body, "slug-") {
+		t.Fatalf("a raw path leaked into the labels:\n%s", body)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Notebook struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+const maxNotebookNameLen = 255
+
+// ownsNotebook reports whether notebook id exists and belongs to userID.
+func ownsNotebook(ctx context.Context, userID, id int) (bool, error) {
+	var one int
+	err := db.QueryRowContext(ctx, `SELECT 1 FROM notebooks WHERE id = ? AND user_id = ?`, id, userID).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// notebookName validates and trims a notebook name from a request body.
+func notebookName(w http.ResponseWriter, raw string) (string, bool) {
+	name := strings.TrimSpace(raw)
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return "", false
+	}
+	if len(name) > maxNotebookNameLen {
+		http.Error(w, "name is too long", http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
+
+func notebooksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listNotebooksHandler(w, r)
+	case http.MethodPost:
+		createNotebookHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func notebookItemHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getNotebookHandler(w, r)
+	case http.MethodPut:
+		updateNotebookHandler(w, r)
+	case http.MethodDelete:
+		deleteNotebookHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func listNotebooksHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	rows, err := db.QueryContext(r.Context(), `SELECT id, user_id, name FROM notebooks WHERE user_id = ? ORDER BY name, id`, userID)
+	if err != nil {
+		requestLog(r).Error("listNotebooks query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	notebooks := []Notebook{}
+	for rows.Next() {
+		var nb Notebook
+		if err := rows.Scan(&nb.ID, &nb.UserID, &nb.Name); err != nil {
+			requestLog(r).Error("listNotebooks scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		notebooks = append(notebooks, nb)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notebooks)
+}
+
+func getNotebookHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	nb := Notebook{ID: id, UserID: userID}
+	err := db.QueryRowContext(r.Context(), `SELECT name FROM notebooks WHERE id = ? AND user_id = ?`, id, userID).Scan(&nb.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgNotebookNotFound)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("getNotebook query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nb)
+}
+
+func createNotebookHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	var body struct {
+		Name string `json:"name"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	name, ok := notebookName(w, body.Name)
+	if !ok {
+		return
+	}
+
+	id64, err := insertID(r.Context(), db, `INSERT INTO notebooks (user_id, name) VALUES (?, ?)`, userID, name)
+	if err != nil {
+		requestLog(r).Error("createNotebook insert", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/notebooks/"+strconv.FormatInt(id64, 10))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Notebook{ID: int(id64), UserID: userID, Name: name})
+}
+
+func updateNotebookHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Name string `json:"name"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	name, ok := notebookName(w, body.Name)
+	if !ok {
+		return
+	}
+
+	owned, err := ownsNotebook(r.Context(), userID, id)
+	if err != nil {
+		requestLog(r).Error("updateNotebook check", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	if !owned {
+		writeJSONError(w, http.StatusNotFound, msgNotebookNotFound)
+		return
+	}
+	if _, err := db.ExecContext(r.Context(), `UPDATE notebooks SET name = ? WHERE id = ? AND user_id = ?`, name, id, userID); err != nil {
+		requestLog(r).Error("updateNotebook update", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Notebook{ID: id, UserID: userID, Name: name})
+}
+
+// deleteNotebookHandler removes a notebook; its notes are kept and moved out
+// of it rather than deleted.
+func deleteNotebookHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		requestLog(r).Error("deleteNotebook begin", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer tx.Rollback()
+
+	// Detach explicitly (rather than relying on ON DELETE SET NULL) so the
+	// notes' updated_at moves and cached list ETags are invalidated.
+	if _, err := tx.ExecContext(r.Context(),
+		`UPDATE notes SET notebook_id = NULL, version = version + 1, updated_at = CURRENT_TIMESTAMP(6) WHERE notebook_id = ? AND user_id = ?`,
+		id, userID,
+	); err != nil {
+		requestLog(r).Error("deleteNotebook detach", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	res, err := tx.ExecContext(r.Context(), `DELETE FROM notebooks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		requestLog(r).Error("deleteNotebook delete", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	aff, _ := res.RowsAffected()
+	if aff == 0 {
+		writeJSONError(w, http.StatusNotFound, msgNotebookNotFound)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		requestLog(r).Error("deleteNotebook commit", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// createNotebook makes a notebook and returns it, failing on anything but 201.
+func createNotebook(t *testing.T, c *testClient, name string) Notebook {
+	t.Helper()
+	resp := c.do("POST", "/notebooks", map[string]string{"name": name})
+	wantStatus(t, resp, http.StatusCreated)
+	var nb Notebook
+	decodeBody(t, resp, &nb)
+	return nb
+}
+
+func TestNotebooks(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	work := createNotebook(t, c, "  Work ")
+	if work.Name != "Work" {
+		t.Fatalf("name = %q, want trimmed", work.Name)
+	}
+	home := createNotebook(t, c, "Home")
+	wantStatus(t, c.do("POST", "/notebooks", map[string]string{"name": " "}), http.StatusBadRequest)
+
+	resp := c.do("GET", "/notebooks", nil)
+	wantStatus(t, resp, http.StatusOK)
+	var list []Notebook
+	decodeBody(t, resp, &list)
+	if len(list) != 2 || list[0].ID != home.ID || list[1].ID != work.ID {
+		t.Fatalf("notebooks = %+v, want by name", list)
+	}
+
+	filed := c.createNote(map[string]interface{}{"title": "report", "notebook_id": work.ID})
+	loose := c.createNote(map[string]string{"title": "loose"})
+	if filed.NotebookID == nil || *filed.NotebookID != work.ID {
+		t.Fatalf("notebook_id = %v, want %d", filed.NotebookID, work.ID)
+	}
+	if ids := noteIDs(c.listNotes(fmt.Sprintf("notebook_id=%d", work.ID))); !slices.Equal(ids, []int{filed.ID}) {
+		t.Fatalf("notes in Work = %v", ids)
+	}
+
+	// Another user's notebook is invisible and can't be filed into.
+	bob := c.newClient()
+	bob.login("bob")
+	wantStatus(t, bob.do("GET", fmt.Sprintf("/notebooks/%d", work.ID), nil), http.StatusNotFound)
+	wantFieldErrors(t, bob.do("POST", "/notes", map[string]interface{}{"title": "x", "notebook_id": work.ID}), "notebook_id")
+	wantStatus(t, bob.do("DELETE", fmt.Sprintf("/notebooks/%d", work.ID), nil), http.StatusNotFound)
+
+	resp = c.do("PUT", fmt.Sprintf("/notebooks/%d", work.ID), map[string]string{"name": "Office"})
+	wantStatus(t, resp, http.StatusOK)
+
+	// Deleting a notebook keeps its notes, outside any notebook.
+	wantStatus(t, c.do("DELETE", fmt.Sprintf("/notebooks/%d", work.ID), nil), http.StatusNoContent)
+	notes := c.listNotes("")
+	if ids := noteIDs(notes); len(ids) != 2 || !slices.Contains(ids, filed.ID) || !slices.Contains(ids, loose.ID) {
+		t.Fatalf("notes after deleting the notebook = %v", ids)
+	}
+	for _, n := range notes {
+		if n.NotebookID != nil {
+			t.Fatalf("note %d still in notebook %d", n.ID, *n.NotebookID)
+		}
+	}
+}
@@ -0,0 +1,864 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxNoteTitleLen = 255
+	// maxNoteContentLen is the most a TEXT column holds, in bytes.
+	maxNoteContentLen = 65535
+)
+
+// validateNote checks a note body's title and content, recording problems
+// in v, and returns the trimmed title.
+func validateNote(v *ValidationError, rawTitle, content string) string {
+	title := strings.TrimSpace(rawTitle)
+	if title == "" {
+		v.Add("title", "required")
+	} else if len(title) > maxNoteTitleLen {
+		v.Add("title", "too long")
+	}
+	if len(content) > maxNoteContentLen {
+		v.Add("content", "too long")
+	}
+	return title
+}
+
+// parseDueAt parses a due_at body field, recording a problem in v.
+func parseDueAt(v *ValidationError, s string) sql.NullTime {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.Add("due_at", "must be an RFC3339 timestamp")
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t, Valid: true}
+}
+
+// maxNotesPageSize caps ?limit on GET /notes.
+const maxNotesPageSize = 500
+
+// encodeCursor makes the opaque ?cursor token for resuming the notes list
+// after n. Clients shouldn't build or inspect these.
+func encodeCursor(n Note) string {
+	pinned := "0"
+	if n.Pinned {
+		pinned = "1"
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(pinned + ":" + strconv.Itoa(n.Position) + ":" + strconv.Itoa(n.ID)))
+}
+
+// parseCursor reverses encodeCursor.
+func parseCursor(s string) (*NoteCursor, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.Split(string(b), ":")
+	if len(parts) != 3 || (parts[0] != "0" && parts[0] != "1") {
+		return nil, false
+	}
+	pos, id := parts[1], parts[2]
+	c := NoteCursor{Pinned: parts[0] == "1"}
+	if c.Position, err = strconv.Atoi(pos); err != nil {
+		return nil, false
+	}
+	if c.ID, err = strconv.Atoi(id); err != nil || c.ID <= 0 {
+		return nil, false
+	}
+	return &c, true
+}
+
+// notesMethods and noteItemMethods are what /notes and /notes/{id} answer,
+// for Allow headers. OPTIONS is handled by allowMethods.
+var (
+	notesMethods    = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions}
+	noteItemMethods = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions}
+)
+
+func (a *app) notesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		a.getNotesHandler(w, r)
+	case http.MethodPost:
+		a.createNoteHandler(w, r)
+	default:
+		methodNotAllowed(w, notesMethods...)
+	}
+}
+
+func (a *app) noteItemHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		a.getNoteHandler(w, r)
+	case http.MethodPut:
+		a.updateNoteHandler(w, r)
+	case http.MethodDelete:
+		a.deleteNoteHandler(w, r)
+	default:
+		methodNotAllowed(w, noteItemMethods...)
+	}
+}
+
+// getNoteHandler returns one note. Last-Modified comes from updated_at, so
+// a client holding a copy can revalidate with If-Modified-Since and get a
+// 304 when nothing changed. The ETag is the version, ready for If-Match on
+// a later PUT.
+func (a *app) getNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	note, err := a.notes.Get(r.Context(), userID, id)
+	if errors.Is(err, errNotFound) {
+		writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("getNote", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	// HTTP dates have whole-second precision; updated_at doesn't.
+	modified := note.UpdatedAt.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	w.Header().Set("ETag", `"`+strconv.Itoa(note.Version)+`"`)
+	if v := r.Header.Get("If-Modified-Since"); v != "" {
+		if since, err := http.ParseTime(v); err == nil && !modified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	encodeJSON(w, r, note)
+}
+
+func (a *app) getNotesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+
+	// Filters combine with AND. Repeating one with different values
+	// (done=true&done=false) can't match anything, so it's refused.
+	query := r.URL.Query()
+	for _, name := range []string{"archived", "done", "pinned", "notebook_id", "include_shared", "q", "created_after", "created_before", "limit", "cursor", "fields"} {
+		for _, v := range query[name] {
+			if v != query.Get(name) {
+				http.Error(w, "conflicting values for "+name, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	var f NoteFilter
+	// Archived notes are hidden unless explicitly requested.
+	if v := query.Get("archived"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid archived filter", http.StatusBadRequest)
+			return
+		}
+		f.Archived = b
+	}
+	// Completion state is only filtered when asked for.
+	if v := query.Get("done"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid done filter", http.StatusBadRequest)
+			return
+		}
+		f.Done = sql.NullBool{Bool: b, Valid: true}
+	}
+	if v := query.Get("pinned"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid pinned filter", http.StatusBadRequest)
+			return
+		}
+		f.Pinned = sql.NullBool{Bool: b, Valid: true}
+	}
+	if v := query.Get("notebook_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid notebook_id filter", http.StatusBadRequest)
+			return
+		}
+		f.NotebookID = sql.NullInt64{Int64: n, Valid: true}
+	}
+	if v := query.Get("include_shared"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid include_shared flag", http.StatusBadRequest)
+			return
+		}
+		f.IncludeShared = b
+	}
+	f.Query = strings.TrimSpace(query.Get("q"))
+	if utf8.RuneCountInString(f.Query) > maxSearchLen {
+		http.Error(w, "q is too long", http.StatusBadRequest)
+		return
+	}
+	for _, bound := range []struct {
+		name string
+		dst  *sql.NullTime
+	}{{"created_after", &f.CreatedAfter}, {"created_before", &f.CreatedBefore}} {
+		v := query.Get(bound.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, bound.name+" must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		*bound.dst = sql.NullTime{Time: t, Valid: true}
+	}
+	if f.CreatedAfter.Valid && f.CreatedBefore.Valid && f.CreatedAfter.Time.After(f.CreatedBefore.Time) {
+		http.Error(w, "created_after must not be later than created_before", http.StatusBadRequest)
+		return
+	}
+	// Without ?limit the whole list comes back at once, as a bare array, as
+	// it always has. With it the notes come wrapped in a notesPage whose
+	// next_cursor (also sent as X-Next-Cursor) is the ?cursor for the next
+	// page. Cursors
+	// mark a place in the list rather than a count of rows, so notes added
+	// or deleted between requests don't shift later pages.
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxNotesPageSize {
+			http.Error(w, "limit must be 1-"+strconv.Itoa(maxNotesPageSize), http.StatusBadRequest)
+			return
+		}
+		f.Limit = n
+	}
+	if v := query.Get("cursor"); v != "" {
+		c, ok := parseCursor(v)
+		if !ok {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		f.After = c
+	}
+	// ?fields=id,title trims each note down to those keys, for clients on
+	// slow links that don't need the content.
+	var fields []string
+	if v := query.Get("fields"); v != "" {
+		var err error
+		if fields, err = parseNoteFields(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	etag, err := notesETag(r.Context(), userID, f.IncludeShared, r.URL.RawQuery)
+	if err != nil {
+		requestLog(r).Error("getNotes etag", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Ask for one extra note to learn whether there's another page.
+	page := f.Limit
+	if page > 0 {
+		f.Limit++
+	}
+	notes, err := a.notes.List(r.Context(), userID, f)
+	if err != nil {
+		requestLog(r).Error("getNotes list", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	total := len(notes)
+	var next *string
+	if page > 0 {
+		if total, err = a.notes.Count(r.Context(), userID, f); err != nil {
+			requestLog(r).Error("getNotes count", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		if len(notes) > page {
+			notes = notes[:page]
+			c := encodeCursor(notes[page-1])
+			next = &c
+			w.Header().Set("X-Next-Cursor", c)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	// HEAD gets the same headers without the body.
+	if r.Method == http.MethodHead {
+		return
+	}
+	var body interface{} = notes
+	if fields != nil {
+		selected, err := selectNoteFields(notes, fields)
+		if err != nil {
+			requestLog(r).Error("getNotes select fields", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		body = selected
+	}
+	if page > 0 {
+		body = notesPage{Notes: body, NextCursor: next}
+	}
+	encodeJSON(w, r, body)
+}
+
+// notesPage is one page of GET /notes?limit=N. NextCursor is null on the
+// last page.
+type notesPage struct {
+	Notes      interface{} `json:"notes"`
+	NextCursor *string     `json:"next_cursor"`
+}
+
+func (a *app) createNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+
+	// ?validate_only=true runs every check but creates nothing, so forms
+	// can validate against the real rules as the user types.
+	var validateOnly bool
+	if v := r.URL.Query().Get("validate_only"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid validate_only flag", http.StatusBadRequest)
+			return
+		}
+		validateOnly = b
+	}
+	// ?dedupe=true hands back an existing note with the same title and
+	// content, with 200, instead of creating a copy. Two such requests
+	// racing each other can still both create.
+	var dedupe bool
+	if v := r.URL.Query().Get("dedupe"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid dedupe flag", http.StatusBadRequest)
+			return
+		}
+		dedupe = b
+	}
+
+	// A retried request with a known Idempotency-Key replays the original note.
+	idemKey := r.Header.Get("Idempotency-Key")
+	if len(idemKey) > maxIdempotencyKeyLen {
+		http.Error(w, "Idempotency-Key too long", http.StatusBadRequest)
+		return
+	}
+	if idemKey != "" && !validateOnly {
+		note, ok, err := idempotentNote(r.Context(), userID, idemKey, a.cfg.IdempotencyTTL)
+		if err != nil {
+			requestLog(r).Error("createNote idempotency lookup", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		if ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.Header().Set("Location", "/notes/"+strconv.Itoa(note.ID))
+			w.WriteHeader(http.StatusCreated)
+			encodeJSON(w, r, note)
+			return
+		}
+	}
+
+	var body struct {
+		Title       string  `json:"title"`
+		Content     string  `json:"content"`
+		ContentType string  `json:"content_type"`
+		Color       string  `json:"color"`
+		NotebookID  *int    `json:"notebook_id"`
+		DueAt       *string `json:"due_at"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	var verr ValidationError
+	in := NoteInput{
+		Title:          validateNote(&verr, body.Title, body.Content),
+		Content:        body.Content,
+		ContentType:    body.ContentType,
+		Color:          body.Color,
+		IdempotencyKey: idemKey,
+
+		CreatedIP:        clientIP(r),
+		CreatedUserAgent: truncateUTF8(r.UserAgent(), maxUserAgentLen),
+	}
+	if body.DueAt != nil && *body.DueAt != "" {
+		in.DueAt = parseDueAt(&verr, *body.DueAt)
+	}
+	if in.ContentType == "" {
+		in.ContentType = defaultNoteContentType
+	}
+	if !noteContentTypes[in.ContentType] {
+		verr.Add("content_type", "must be plain, markdown or checklist")
+	}
+	if in.Color == "" {
+		in.Color = defaultNoteColor
+	}
+	if !noteColors[in.Color] {
+		verr.Add("color", "invalid")
+	}
+	if body.NotebookID != nil {
+		ok, err := ownsNotebook(r.Context(), userID, *body.NotebookID)
+		if err != nil {
+			requestLog(r).Error("createNote notebook check", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		if !ok {
+			verr.Add("notebook_id", "not found")
+		}
+		in.NotebookID = sql.NullInt64{Int64: int64(*body.NotebookID), Valid: true}
+	}
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return
+	}
+	if validateOnly {
+		w.Header().Set("Content-Type", "application/json")
+		encodeJSON(w, r, ValidationError{Fields: map[string]string{}})
+		return
+	}
+	if dedupe {
+		note, err := a.notes.FindDuplicate(r.Context(), userID, in.Title, in.Content)
+		if err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			encodeJSON(w, r, note)
+			return
+		}
+		if !errors.Is(err, errNotFound) {
+			requestLog(r).Error("createNote dedupe lookup", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+	}
+	if !allowNoteCreate(w, userID, 1) {
+		return
+	}
+
+	note, err := a.notes.Create(r.Context(), userID, in)
+	if err != nil {
+		requestLog(r).Error("createNote", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	notifyNote("note.created", note)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/notes/"+strconv.Itoa(note.ID))
+	w.WriteHeader(http.StatusCreated)
+	encodeJSON(w, r, note)
+}
+
+func (a *app) updateNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Title       string  `json:"title"`
+		Content     string  `json:"content"`
+		ContentType string  `json:"content_type"`
+		Color       string  `json:"color"`
+		NotebookID  *int    `json:"notebook_id"`
+		DueAt       *string `json:"due_at"`
+		Version     *int    `json:"version"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	var verr ValidationError
+	in := NoteUpdate{
+		Title:       validateNote(&verr, body.Title, body.Content),
+		Content:     body.Content,
+		ContentType: body.ContentType,
+		Color:       body.Color,
+	}
+	// Clients that send the version they last read (If-Match or "version")
+	// get a 409 instead of overwriting someone else's edit. If-Match: *
+	// skips the check, and a list of versions accepts any of them.
+	if v := r.Header.Get("If-Match"); v != "" {
+		versions, err := parseIfMatch(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(versions) > 1 {
+			// Narrow the list to the note's current version, if listed;
+			// Update still checks it hasn't moved on since.
+			cur, err := a.notes.Get(r.Context(), userID, id)
+			if errors.Is(err, errNotFound) {
+				writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+				return
+			}
+			if err != nil {
+				requestLog(r).Error("updateNote get", "err", err)
+				writeJSONError(w, http.StatusInternalServerError, msgInternal)
+				return
+			}
+			if !slices.Contains(versions, cur.Version) {
+				writeJSONError(w, http.StatusConflict, msgIfMatchFailed, cur.Version)
+				return
+			}
+			versions = []int{cur.Version}
+		}
+		if len(versions) == 1 {
+			in.Version = sql.NullInt64{Int64: int64(versions[0]), Valid: true}
+		}
+	} else if body.Version != nil {
+		in.Version = sql.NullInt64{Int64: int64(*body.Version), Valid: true}
+	}
+	// An omitted content_type or color keeps the note's current one.
+	if in.ContentType != "" && !noteContentTypes[in.ContentType] {
+		verr.Add("content_type", "must be plain, markdown or checklist")
+	}
+	if in.Color != "" && !noteColors[in.Color] {
+		verr.Add("color", "invalid")
+	}
+	// An omitted due_at keeps the current one; an empty string clears it.
+	in.SetDue = body.DueAt != nil
+	if in.SetDue && *body.DueAt != "" {
+		in.DueAt = parseDueAt(&verr, *body.DueAt)
+	}
+	// An omitted notebook_id keeps the current one; 0 removes the note from
+	// its notebook.
+	in.SetNotebook = body.NotebookID != nil
+	if in.SetNotebook && *body.NotebookID != 0 {
+		ok, err := ownsNotebook(r.Context(), userID, *body.NotebookID)
+		if err != nil {
+			requestLog(r).Error("updateNote notebook check", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		if !ok {
+			verr.Add("notebook_id", "not found")
+		}
+		in.NotebookID = sql.NullInt64{Int64: int64(*body.NotebookID), Valid: true}
+	}
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return
+	}
+
+	note, err := a.notes.Update(r.Context(), userID, id, in)
+	if errors.Is(err, errNotFound) {
+		writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+		return
+	}
+	if errors.Is(err, errVersionConflict) {
+		writeJSONError(w, http.StatusConflict, msgVersionConflict, in.Version.Int64)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("updateNote", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	notifyNote("note.updated", note)
+
+	w.Header().Set("Content-Type", "application/json")
+	encodeJSON(w, r, note)
+}
+
+// maxBatchNotes caps how many notes one POST /notes/batch may create or
+// one PATCH /notes/batch may change.
+const maxBatchNotes = 100
+
+func (a *app) notesBatchHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		a.batchCreateNotesHandler(w, r)
+	case http.MethodPatch:
+		a.batchUpdateNotesHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodPost, http.MethodPatch)
+	}
+}
+
+// batchCreateNotesHandler creates several notes from {"notes": [{title,
+// content}, ...]} in one transaction. Any invalid entry fails the whole
+// batch, with errors keyed by index such as "notes[2].title".
+func (a *app) batchCreateNotesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+
+	var body struct {
+		Notes []struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		} `json:"notes"`
+	}
+	if !decodeJSONShallow(w, r, &body) {
+		return
+	}
+	var verr ValidationError
+	if len(body.Notes) == 0 {
+		verr.Add("notes", "required")
+	} else if len(body.Notes) > maxBatchNotes {
+		verr.Add("notes", "at most "+strconv.Itoa(maxBatchNotes)+" notes per batch")
+	}
+	ins := make([]NoteInput, 0, len(body.Notes))
+	for i, n := range body.Notes {
+		var itemErr ValidationError
+		title := validateNote(&itemErr, n.Title, n.Content)
+		for field, msg := range itemErr.Fields {
+			verr.Add("notes["+strconv.Itoa(i)+"]."+field, msg)
+		}
+		ins = append(ins, NoteInput{
+			Title:       title,
+			Content:     n.Content,
+			ContentType: defaultNoteContentType,
+			Color:       defaultNoteColor,
+
+			CreatedIP:        clientIP(r),
+			CreatedUserAgent: truncateUTF8(r.UserAgent(), maxUserAgentLen),
+		})
+	}
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return
+	}
+	if !allowNoteCreate(w, userID, len(ins)) {
+		return
+	}
+
+	notes, err := a.notes.CreateBatch(r.Context(), userID, ins)
+	if err != nil {
+		requestLog(r).Error("batchCreateNotes", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	for _, n := range notes {
+		notifyNote("note.created", n)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(notes)
+}
+
+// batchUpdateNotesHandler applies {"notebook_id": ..., "archived": ...} to
+// every note in "ids" at once, for moving or archiving a selection. As with
+// PUT /notes/{id}, a notebook_id of 0 takes the notes out of their
+// notebook. Ids that aren't the user's are skipped rather than failing the
+// batch; the response counts the notes actually updated.
+func (a *app) batchUpdateNotesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+
+	var body struct {
+		IDs        []jsonID `json:"ids"`
+		NotebookID *int     `json:"notebook_id"`
+		Archived   *bool    `json:"archived"`
+	}
+	if !decodeJSONShallow(w, r, &body) {
+		return
+	}
+	var verr ValidationError
+	if len(body.IDs) == 0 {
+		verr.Add("ids", "required")
+	} else if len(body.IDs) > maxBatchNotes {
+		verr.Add("ids", "at most "+strconv.Itoa(maxBatchNotes)+" notes per batch")
+	}
+	if body.NotebookID == nil && body.Archived == nil {
+		verr.Add("notebook_id", "notebook_id or archived is required")
+	}
+	var in NoteBatchUpdate
+	in.SetNotebook = body.NotebookID != nil
+	if in.SetNotebook && *body.NotebookID != 0 {
+		ok, err := ownsNotebook(r.Context(), userID, *body.NotebookID)
+		if err != nil {
+			requestLog(r).Error("batchUpdateNotes notebook check", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		if !ok {
+			verr.Add("notebook_id", "not found")
+		}
+		in.NotebookID = sql.NullInt64{Int64: int64(*body.NotebookID), Valid: true}
+	}
+	if body.Archived != nil {
+		in.Archived = sql.NullBool{Bool: *body.Archived, Valid: true}
+	}
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return
+	}
+
+	seen := make(map[int]bool, len(body.IDs))
+	ids := make([]int, 0, len(body.IDs))
+	for _, v := range body.IDs {
+		if !seen[int(v)] {
+			seen[int(v)] = true
+			ids = append(ids, int(v))
+		}
+	}
+
+	notes, err := a.notes.UpdateMany(r.Context(), userID, ids, in)
+	if err != nil {
+		requestLog(r).Error("batchUpdateNotes", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	for _, n := range notes {
+		notifyNote("note.updated", n)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"updated": len(notes)})
+}
+
+const duplicateSuffix = " (copy)"
+
+// duplicateNoteHandler copies a note's title, content, content type and
+// color into a new note for the same user.
+func (a *app) duplicateNoteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	src, err := a.notes.Get(r.Context(), userID, id)
+	if errors.Is(err, errNotFound) {
+		writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("duplicateNote fetch", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	if !allowNoteCreate(w, userID, 1) {
+		return
+	}
+
+	// Shorten a long title so the suffix still fits, without splitting a
+	// multi-byte character.
+	title := truncateUTF8(src.Title, maxNoteTitleLen-len(duplicateSuffix))
+	note, err := a.notes.Create(r.Context(), userID, NoteInput{
+		Title:       title + duplicateSuffix,
+		Content:     src.Content,
+		ContentType: src.ContentType,
+		Color:       src.Color,
+
+		CreatedIP:        clientIP(r),
+		CreatedUserAgent: truncateUTF8(r.UserAgent(), maxUserAgentLen),
+	})
+	if err != nil {
+		requestLog(r).Error("duplicateNote create", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	notifyNote("note.created", note)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/notes/"+strconv.Itoa(note.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(note)
+}
+
+// reorderNotesHandler stores a manual order for the user's notes from a
+// body of {"ids": [...]}, first to last. Notes left out keep their position;
+// new notes start at 0 and so sort ahead of reordered ones. Ids may be
+// numbers or numeric strings.
+func (a *app) reorderNotesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodPut)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+
+	var body struct {
+		IDs []jsonID `json:"ids"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	if len(body.IDs) == 0 {
+		http.Error(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+	ids := make([]int, len(body.IDs))
+	seen := make(map[int]bool, len(body.IDs))
+	for i, v := range body.IDs {
+		id := int(v)
+		if seen[id] {
+			http.Error(w, "duplicate note id "+strconv.Itoa(id), http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+		ids[i] = id
+	}
+
+	err := a.notes.Reorder(r.Context(), userID, ids)
+	if errors.Is(err, errNotFound) {
+		http.Error(w, "ids contains a note that doesn't exist", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("reorderNotes", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) deleteNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	// Attachment rows cascade with the note, but their files must be
+	// removed by hand once the delete succeeds.
+	files, err := attachmentFiles(r.Context(), id)
+	if err != nil {
+		requestLog(r).Error("deleteNote attachments", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	err = a.notes.Delete(r.Context(), userID, id)
+	if errors.Is(err, errNotFound) {
+		writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("deleteNote delete", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	a.removeAttachmentFiles(files)
+	notifyNoteDeleted(userID, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,802 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestNoteHandlersMemStore(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+
+	note := c.createNote(map[string]string{"title": "  Groceries  ", "content": "milk"})
+	if note.UserID != userID || note.Title != "Groceries" || note.Color != defaultNoteColor || note.ContentType != defaultNoteContentType {
+		t.Fatalf("created note = %+v", note)
+	}
+	if _, err := store.Get(t.Context(), userID, note.ID); err != nil {
+		t.Fatalf("note not in store: %v", err)
+	}
+	path := fmt.Sprintf("/notes/%d", note.ID)
+
+	resp := c.do("GET", path, nil)
+	wantStatus(t, resp, http.StatusOK)
+	var got Note
+	decodeBody(t, resp, &got)
+	if got.ID != note.ID || got.Content != "milk" {
+		t.Fatalf("fetched note = %+v", got)
+	}
+
+	resp = c.do("PUT", path, map[string]interface{}{"title": "Groceries", "content": "milk, eggs", "version": 1})
+	wantStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &got)
+	if got.Content != "milk, eggs" || got.Version != 2 {
+		t.Fatalf("updated note = %+v", got)
+	}
+
+	// Validation failures never reach the store.
+	wantStatus(t, c.do("POST", "/notes", map[string]string{"title": " "}), http.StatusUnprocessableEntity)
+	if n, _ := store.Count(t.Context(), userID, NoteFilter{}); n != 1 {
+		t.Fatalf("store holds %d notes, want 1", n)
+	}
+
+	// Notes are scoped to their owner.
+	other := c.newClient()
+	other.login("bob")
+	wantStatus(t, other.do("GET", path, nil), http.StatusNotFound)
+	wantStatus(t, other.do("PUT", path, map[string]string{"title": "mine"}), http.StatusNotFound)
+}
+
+func TestReorderNotesMemStore(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+	first := c.createNote(map[string]string{"title": "first"})
+	second := c.createNote(map[string]string{"title": "second"})
+
+	wantStatus(t, c.do("PUT", "/notes/reorder", map[string]interface{}{"ids": []int{second.ID, first.ID}}), http.StatusNoContent)
+	notes, _ := store.List(t.Context(), userID, NoteFilter{})
+	if len(notes) != 2 || notes[0].ID != second.ID || notes[1].ID != first.ID {
+		t.Fatalf("order after reorder = %+v", notes)
+	}
+
+	// Ids may come as numeric strings.
+	wantStatus(t, c.do("PUT", "/notes/reorder", map[string]interface{}{"ids": []string{strconv.Itoa(first.ID), strconv.Itoa(second.ID)}}), http.StatusNoContent)
+	notes, _ = store.List(t.Context(), userID, NoteFilter{})
+	if notes[0].ID != first.ID {
+		t.Fatalf("order after reorder by strings = %v", noteIDs(notes))
+	}
+
+	bob := c.newClient()
+	bob.login("bob")
+	theirs := bob.createNote(map[string]string{"title": "bob's"})
+	for _, ids := range [][]int{
+		nil,
+		{first.ID, first.ID},
+		{first.ID, theirs.ID},
+		{first.ID, 999999},
+	} {
+		wantStatus(t, c.do("PUT", "/notes/reorder", map[string]interface{}{"ids": ids}), http.StatusBadRequest)
+	}
+	for _, ids := range []interface{}{
+		[]string{strconv.Itoa(first.ID), "second"},
+		[]interface{}{first.ID, float64(second.ID) + 0.5},
+	} {
+		resp := c.do("PUT", "/notes/reorder", map[string]interface{}{"ids": ids})
+		wantStatus(t, resp, http.StatusBadRequest)
+		if body := readBody(t, resp); !strings.Contains(body, "invalid JSON") {
+			t.Errorf("ids %v: body %q", ids, body)
+		}
+	}
+	// A refused reorder changes nothing.
+	notes, _ = store.List(t.Context(), userID, NoteFilter{})
+	if notes[0].ID != first.ID {
+		t.Fatalf("order changed by a refused reorder: %v", noteIDs(notes))
+	}
+}
+
+func TestReorderNotes(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	var ids []int
+	for _, title := range []string{"a", "b", "c"} {
+		ids = append(ids, c.createNote(map[string]string{"title": title}).ID)
+	}
+	// Newest first until told otherwise.
+	if got := noteIDs(c.listNotes("")); !slices.Equal(got, []int{ids[2], ids[1], ids[0]}) {
+		t.Fatalf("initial order = %v", got)
+	}
+	want := []int{ids[1], ids[0], ids[2]}
+	wantStatus(t, c.do("PUT", "/notes/reorder", map[string]interface{}{"ids": want}), http.StatusNoContent)
+	notes := c.listNotes("")
+	if got := noteIDs(notes); !slices.Equal(got, want) {
+		t.Fatalf("order after reorder = %v, want %v", got, want)
+	}
+	for i, n := range notes {
+		if n.Position != i+1 {
+			t.Fatalf("note %d position %d, want %d", n.ID, n.Position, i+1)
+		}
+	}
+	// New notes start ahead of the ordered ones.
+	fresh := c.createNote(map[string]string{"title": "d"})
+	if got := noteIDs(c.listNotes("")); got[0] != fresh.ID {
+		t.Fatalf("order after a new note = %v", got)
+	}
+}
+
+// wantFieldErrors fails the test unless resp is a 422 naming exactly fields.
+func wantFieldErrors(t *testing.T, resp *http.Response, fields ...string) {
+	t.Helper()
+	wantStatus(t, resp, http.StatusUnprocessableEntity)
+	var v ValidationError
+	decodeBody(t, resp, &v)
+	if len(v.Fields) != len(fields) {
+		t.Fatalf("errors = %v, want %v", v.Fields, fields)
+	}
+	for _, f := range fields {
+		if _, ok := v.Fields[f]; !ok {
+			t.Fatalf("errors = %v, want %v", v.Fields, fields)
+		}
+	}
+}
+
+func TestNoteColors(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	if n := c.createNote(map[string]string{"title": "plain"}); n.Color != "gray" {
+		t.Errorf("default color = %q, want gray", n.Color)
+	}
+	note := c.createNote(map[string]string{"title": "urgent", "color": "red"})
+	if note.Color != "red" {
+		t.Fatalf("color = %q, want red", note.Color)
+	}
+	wantFieldErrors(t, c.do("POST", "/notes", map[string]string{"title": "x", "color": "chartreuse"}), "color")
+
+	path := fmt.Sprintf("/notes/%d", note.ID)
+	resp := c.do("PUT", path, map[string]string{"title": "urgent", "content": "now"})
+	wantStatus(t, resp, http.StatusOK)
+	var got Note
+	decodeBody(t, resp, &got)
+	if got.Color != "red" {
+		t.Errorf("color after update without one = %q, want red kept", got.Color)
+	}
+	resp = c.do("PUT", path, map[string]string{"title": "urgent", "color": "green"})
+	wantStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &got)
+	if got.Color != "green" {
+		t.Errorf("color after update = %q, want green", got.Color)
+	}
+	wantFieldErrors(t, c.do("PUT", path, map[string]string{"title": "urgent", "color": "RED"}), "color")
+}
+
+func TestNoteContentTypes(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	if n := c.createNote(map[string]string{"title": "untyped"}); n.ContentType != "plain" {
+		t.Errorf("default content_type = %q, want plain", n.ContentType)
+	}
+	note := c.createNote(map[string]string{"title": "todo", "content": "[ ] eggs", "content_type": "checklist"})
+	if note.ContentType != "checklist" {
+		t.Fatalf("content_type = %q, want checklist", note.ContentType)
+	}
+	for _, bad := range []string{"html", "Markdown", " plain"} {
+		wantFieldErrors(t, c.do("POST", "/notes", map[string]string{"title": "x", "content_type": bad}), "content_type")
+	}
+
+	path := fmt.Sprintf("/notes/%d", note.ID)
+	resp := c.do("PUT", path, map[string]string{"title": "todo", "content": "[x] eggs"})
+	wantStatus(t, resp, http.StatusOK)
+	var got Note
+	decodeBody(t, resp, &got)
+	if got.ContentType != "checklist" {
+		t.Errorf("content_type after update without one = %q, want checklist kept", got.ContentType)
+	}
+	resp = c.do("PUT", path, map[string]string{"title": "todo", "content_type": "markdown"})
+	wantStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &got)
+	if got.ContentType != "markdown" {
+		t.Errorf("content_type after update = %q, want markdown", got.ContentType)
+	}
+	wantFieldErrors(t, c.do("PUT", path, map[string]string{"title": "todo", "content_type": "rich"}), "content_type")
+}
+
+func TestEmptyNotesListIsArray(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	c.createNote(map[string]string{"title": "open"})
+
+	for _, query := range []string{"archived=true", "done=true", "q=nothing-matches", "archived=true&fields=id,title"} {
+		resp := c.do("GET", "/notes?"+query, nil)
+		wantStatus(t, resp, http.StatusOK)
+		if body := strings.TrimSpace(readBody(t, resp)); body != "[]" {
+			t.Errorf("GET /notes?%s = %s, want []", query, body)
+		}
+	}
+}
+
+func TestCreateNoteLocation(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	resp := c.do("POST", "/notes", map[string]string{"title": "located"})
+	wantStatus(t, resp, http.StatusCreated)
+	var note Note
+	decodeBody(t, resp, &note)
+	loc := resp.Header.Get("Location")
+	if loc != fmt.Sprintf("/notes/%d", note.ID) {
+		t.Fatalf("Location = %q", loc)
+	}
+	// It points at the note just created.
+	resp = c.do("GET", loc, nil)
+	wantStatus(t, resp, http.StatusOK)
+	var got Note
+	decodeBody(t, resp, &got)
+	if got.ID != note.ID {
+		t.Fatalf("Location leads to note %d, want %d", got.ID, note.ID)
+	}
+}
+
+func TestValidateNote(t *testing.T) {
+	for _, tt := range []struct {
+		name, title, content string
+		wantTitle            string
+		errs                 []string
+	}{
+		{"trimmed", "  hello \n", "", "hello", nil},
+		{"blank title", " \t ", "", "", []string{"title"}},
+		{"longest title", strings.Repeat("t", maxNoteTitleLen), "", strings.Repeat("t", maxNoteTitleLen), nil},
+		{"title too long", strings.Repeat("t", maxNoteTitleLen+1), "", strings.Repeat("t", maxNoteTitleLen+1), []string{"title"}},
+		{"longest content", "t", strings.Repeat("c", maxNoteContentLen), "t", nil},
+		{"content too long", "t", strings.Repeat("c", maxNoteContentLen+1), "t", []string{"content"}},
+		{"both", "", strings.Repeat("c", maxNoteContentLen+1), "", []string{"title", "content"}},
+	} {
+		var v ValidationError
+		title := validateNote(&v, tt.title, tt.content)
+		if title != tt.wantTitle {
+			t.Errorf("%s: title = %q, want %q", tt.name, title, tt.wantTitle)
+		}
+		if len(v.Fields) != len(tt.errs) {
+			t.Errorf("%s: errors = %v, want %v", tt.name, v.Fields, tt.errs)
+			continue
+		}
+		for _, f := range tt.errs {
+			if _, ok := v.Fields[f]; !ok {
+				t.Errorf("%s: errors = %v, want %v", tt.name, v.Fields, tt.errs)
+			}
+		}
+	}
+}
+
+func TestNoteLengthLimits(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+
+	wantFieldErrors(t, c.do("POST", "/notes", map[string]string{"title": strings.Repeat("t", maxNoteTitleLen+1)}), "title")
+	wantFieldErrors(t, c.do("POST", "/notes", map[string]string{"title": "t", "content": strings.Repeat("c", maxNoteContentLen+1)}), "content")
+	note := c.createNote(map[string]string{"title": "t"})
+	wantFieldErrors(t, c.do("PUT", fmt.Sprintf("/notes/%d", note.ID), map[string]string{"title": "  "}), "title")
+	if got, _ := store.Get(t.Context(), userID, note.ID); got.Title != "t" {
+		t.Fatalf("refused update changed the title to %q", got.Title)
+	}
+}
+
+func TestDuplicateNote(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	src := c.createNote(map[string]string{"title": "list", "content": "[ ] eggs", "content_type": "checklist", "color": "blue"})
+
+	resp := c.do("POST", fmt.Sprintf("/notes/%d/duplicate", src.ID), nil)
+	wantStatus(t, resp, http.StatusCreated)
+	var dup Note
+	decodeBody(t, resp, &dup)
+	if dup.ID == src.ID || dup.Title != "list (copy)" || dup.Content != src.Content || dup.ContentType != "checklist" || dup.Color != "blue" {
+		t.Fatalf("duplicate = %+v", dup)
+	}
+	if loc := resp.Header.Get("Location"); loc != fmt.Sprintf("/notes/%d", dup.ID) {
+		t.Errorf("Location = %q", loc)
+	}
+
+	// A title at the limit is shortened, on a character boundary, to fit
+	// the suffix.
+	long := c.createNote(map[string]string{"title": strings.Repeat("é", maxNoteTitleLen/2)})
+	resp = c.do("POST", fmt.Sprintf("/notes/%d/duplicate", long.ID), nil)
+	wantStatus(t, resp, http.StatusCreated)
+	decodeBody(t, resp, &dup)
+	if len(dup.Title) > maxNoteTitleLen || !utf8.ValidString(dup.Title) || !strings.HasSuffix(dup.Title, duplicateSuffix) {
+		t.Fatalf("duplicate of a long title = %q (%d bytes)", dup.Title, len(dup.Title))
+	}
+
+	bob := c.newClient()
+	bob.login("bob")
+	wantStatus(t, bob.do("POST", fmt.Sprintf("/notes/%d/duplicate", src.ID), nil), http.StatusNotFound)
+	wantStatus(t, c.do("GET", fmt.Sprintf("/notes/%d/duplicate", src.ID), nil), http.StatusMethodNotAllowed)
+}
+
+func TestHeadNotesList(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	for _, title := range []string{"one", "two", "three"} {
+		c.createNote(map[string]string{"title": title})
+	}
+
+	for path, count := range map[string]string{"/notes": "3", "/notes?limit=1": "3", "/notes?q=two": "1"} {
+		get := c.do("GET", path, nil)
+		wantStatus(t, get, http.StatusOK)
+		readBody(t, get)
+
+		head := c.do("HEAD", path, nil)
+		wantStatus(t, head, http.StatusOK)
+		if got := head.Header.Get("X-Total-Count"); got != count {
+			t.Errorf("HEAD %s: X-Total-Count %q, want %s", path, got, count)
+		}
+		if head.Header.Get("ETag") != get.Header.Get("ETag") {
+			t.Errorf("HEAD %s: ETag %q, GET gave %q", path, head.Header.Get("ETag"), get.Header.Get("ETag"))
+		}
+		if body := readBody(t, head); body != "" {
+			t.Errorf("HEAD %s: body %q, want none", path, body)
+		}
+	}
+}
+
+func TestBatchCreateNotes(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+
+	resp := c.do("POST", "/notes/batch", map[string]interface{}{"notes": []map[string]string{
+		{"title": "first", "content": "a"}, {"title": "second"}, {"title": " third "},
+	}})
+	wantStatus(t, resp, http.StatusCreated)
+	var notes []Note
+	decodeBody(t, resp, &notes)
+	if len(notes) != 3 {
+		t.Fatalf("created %d notes, want 3", len(notes))
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		if notes[i].Title != want || notes[i].ID == 0 || notes[i].UserID != userID {
+			t.Errorf("notes[%d] = %+v, want %q", i, notes[i], want)
+		}
+	}
+
+	// One bad entry fails the lot, naming its index.
+	resp = c.do("POST", "/notes/batch", map[string]interface{}{"notes": []map[string]string{
+		{"title": "fine"}, {"title": ""}, {"title": "also fine"},
+	}})
+	wantFieldErrors(t, resp, "notes[1].title")
+	if n, _ := store.Count(t.Context(), userID, NoteFilter{}); n != 3 {
+		t.Fatalf("store holds %d notes after a failed batch, want 3", n)
+	}
+
+	wantFieldErrors(t, c.do("POST", "/notes/batch", map[string]interface{}{"notes": []string{}}), "notes")
+	tooMany := make([]map[string]string, maxBatchNotes+1)
+	for i := range tooMany {
+		tooMany[i] = map[string]string{"title": "x"}
+	}
+	wantFieldErrors(t, c.do("POST", "/notes/batch", map[string]interface{}{"notes": tooMany}), "notes")
+}
+
+func TestBatchArchiveNotes(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+	first := c.createNote(map[string]string{"title": "first"})
+	second := c.createNote(map[string]string{"title": "second"})
+	kept := c.createNote(map[string]string{"title": "kept"})
+	bob := c.newClient()
+	bob.login("bob")
+	foreign := bob.createNote(map[string]string{"title": "bob's"})
+
+	// Foreign and missing ids are skipped; string ids and repeats are fine.
+	resp := c.do("PATCH", "/notes/batch", map[string]interface{}{
+		"ids":      []interface{}{first.ID, strconv.Itoa(second.ID), first.ID, foreign.ID, 99999},
+		"archived": true,
+	})
+	wantStatus(t, resp, http.StatusOK)
+	var got map[string]int
+	decodeBody(t, resp, &got)
+	if got["updated"] != 2 {
+		t.Fatalf("updated = %v, want 2", got)
+	}
+	for _, want := range []struct {
+		id       int
+		archived bool
+	}{{first.ID, true}, {second.ID, true}, {kept.ID, false}} {
+		n, err := store.Get(t.Context(), userID, want.id)
+		if err != nil || n.Archived != want.archived {
+			t.Errorf("note %d archived = %v (%v), want %v", want.id, n.Archived, err, want.archived)
+		}
+		if want.archived && n.Version != 2 {
+			t.Errorf("note %d version = %d, want 2", want.id, n.Version)
+		}
+	}
+	if n, _ := store.Get(t.Context(), foreign.UserID, foreign.ID); n.Archived {
+		t.Error("another user's note was archived")
+	}
+
+	wantFieldErrors(t, c.do("PATCH", "/notes/batch", map[string]interface{}{"archived": true}), "ids")
+	wantFieldErrors(t, c.do("PATCH", "/notes/batch", map[string]interface{}{"ids": []int{first.ID}}), "notebook_id")
+	tooMany := make([]int, maxBatchNotes+1)
+	for i := range tooMany {
+		tooMany[i] = i + 1
+	}
+	wantFieldErrors(t, c.do("PATCH", "/notes/batch", map[string]interface{}{"ids": tooMany, "archived": true}), "ids")
+}
+
+func TestBatchMoveToNotebook(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	work := createNotebook(t, c, "Work")
+	first := c.createNote(map[string]string{"title": "first"})
+	second := c.createNote(map[string]string{"title": "second"})
+	c.createNote(map[string]string{"title": "loose"})
+	bob := c.newClient()
+	bob.login("bob")
+	foreign := bob.createNote(map[string]string{"title": "bob's"})
+
+	resp := c.do("PATCH", "/notes/batch", map[string]interface{}{
+		"ids": []int{first.ID, second.ID, foreign.ID}, "notebook_id": work.ID,
+	})
+	wantStatus(t, resp, http.StatusOK)
+	var got map[string]int
+	decodeBody(t, resp, &got)
+	if got["updated"] != 2 {
+		t.Fatalf("updated = %v, want 2", got)
+	}
+	if ids := noteIDs(c.listNotes(fmt.Sprintf("notebook_id=%d", work.ID))); !slices.Equal(ids, []int{first.ID, second.ID}) && !slices.Equal(ids, []int{second.ID, first.ID}) {
+		t.Fatalf("notebook holds %v, want the two moved notes", ids)
+	}
+	if ids := noteIDs(bob.listNotes(fmt.Sprintf("notebook_id=%d", work.ID))); len(ids) != 0 {
+		t.Fatalf("bob sees %v in alice's notebook", ids)
+	}
+
+	// Bob can't move his notes into alice's notebook.
+	wantFieldErrors(t, bob.do("PATCH", "/notes/batch", map[string]interface{}{
+		"ids": []int{foreign.ID}, "notebook_id": work.ID,
+	}), "notebook_id")
+
+	// notebook_id 0 takes them back out.
+	wantStatus(t, c.do("PATCH", "/notes/batch", map[string]interface{}{
+		"ids": []int{first.ID}, "notebook_id": 0,
+	}), http.StatusOK)
+	if ids := noteIDs(c.listNotes(fmt.Sprintf("notebook_id=%d", work.ID))); !slices.Equal(ids, []int{second.ID}) {
+		t.Fatalf("notebook holds %v after removing one, want [%d]", ids, second.ID)
+	}
+}
+
+func TestUpdateNoteVersions(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "draft"})
+	path := fmt.Sprintf("/notes/%d", note.ID)
+	if note.Version != 1 {
+		t.Fatalf("new note has version %d, want 1", note.Version)
+	}
+
+	resp := c.do("GET", path, nil)
+	wantStatus(t, resp, http.StatusOK)
+	etag := resp.Header.Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("ETag = %q, want \"1\"", etag)
+	}
+
+	update := func(title string, headers ...string) *http.Response {
+		return c.do("PUT", path, map[string]string{"title": title}, headers...)
+	}
+	// The version moves on with each update; the old ETag is then stale.
+	wantStatus(t, update("tab one", "If-Match", etag), http.StatusOK)
+	wantJSONError(t, update("tab two", "If-Match", etag), http.StatusConflict)
+	wantJSONError(t, c.do("PUT", path, map[string]interface{}{"title": "tab two", "version": 1}), http.StatusConflict)
+	wantStatus(t, c.do("PUT", path, map[string]interface{}{"title": "tab two", "version": 2}), http.StatusOK)
+
+	// A list matches any of its versions.
+	wantStatus(t, update("listed", "If-Match", `"1", "3"`), http.StatusOK)
+	if msg := wantJSONError(t, update("listed", "If-Match", `"1", "2"`), http.StatusConflict); !strings.Contains(msg, "version 4") {
+		t.Errorf("conflict message %q doesn't name the current version", msg)
+	}
+	// * skips the check, even against a stale body version.
+	resp = c.do("PUT", path, map[string]interface{}{"title": "forced", "version": 1}, "If-Match", "*")
+	wantStatus(t, resp, http.StatusOK)
+	var got Note
+	decodeBody(t, resp, &got)
+	if got.Title != "forced" || got.Version != 5 {
+		t.Fatalf("after If-Match: *, note = %+v", got)
+	}
+
+	wantStatus(t, update("bad", "If-Match", "5"), http.StatusBadRequest)
+	wantJSONError(t, c.do("PUT", "/notes/999999", map[string]string{"title": "x"}, "If-Match", `"1", "2"`), http.StatusNotFound)
+}
+
+func TestCreateNoteValidateOnly(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+
+	resp := c.do("POST", "/notes?validate_only=true", map[string]string{"title": "fine", "color": "red"})
+	wantStatus(t, resp, http.StatusOK)
+	var v ValidationError
+	decodeBody(t, resp, &v)
+	if v.HasErrors() {
+		t.Fatalf("valid note reported %v", v.Fields)
+	}
+	wantFieldErrors(t, c.do("POST", "/notes?validate_only=1", map[string]string{"title": "", "color": "plaid"}), "title", "color")
+	wantStatus(t, c.do("POST", "/notes?validate_only=perhaps", map[string]string{"title": "fine"}), http.StatusBadRequest)
+	if n, _ := store.Count(t.Context(), userID, NoteFilter{}); n != 0 {
+		t.Fatalf("validate_only created %d notes", n)
+	}
+
+	// validate_only=false is an ordinary create.
+	wantStatus(t, c.do("POST", "/notes?validate_only=false", map[string]string{"title": "fine"}), http.StatusCreated)
+	if n, _ := store.Count(t.Context(), userID, NoteFilter{}); n != 1 {
+		t.Fatalf("store holds %d notes, want 1", n)
+	}
+}
+
+func TestGetNoteIfModifiedSince(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "cached"})
+	path := fmt.Sprintf("/notes/%d", note.ID)
+
+	resp := c.do("GET", path, nil)
+	wantStatus(t, resp, http.StatusOK)
+	readBody(t, resp)
+	lastModified := resp.Header.Get("Last-Modified")
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		t.Fatalf("Last-Modified %q: %v", lastModified, err)
+	}
+	if want := note.UpdatedAt.UTC().Truncate(time.Second); !modified.Equal(want) {
+		t.Errorf("Last-Modified = %v, want %v", modified, want)
+	}
+
+	for _, tc := range []struct {
+		since  string
+		status int
+	}{
+		{lastModified, http.StatusNotModified},
+		{modified.Add(time.Hour).Format(http.TimeFormat), http.StatusNotModified},
+		{modified.Add(-time.Second).Format(http.TimeFormat), http.StatusOK},
+		// An unparseable date is ignored, as RFC 9110 asks.
+		{"yesterday", http.StatusOK},
+	} {
+		resp := c.do("GET", path, nil, "If-Modified-Since", tc.since)
+		wantStatus(t, resp, tc.status)
+		body := readBody(t, resp)
+		if tc.status == http.StatusNotModified && body != "" {
+			t.Errorf("304 with a body: %q", body)
+		}
+	}
+
+	// Once the note changes, the old date no longer matches.
+	store.mu.Lock()
+	n := store.notes[note.ID]
+	n.UpdatedAt = n.UpdatedAt.Add(time.Minute)
+	store.notes[note.ID] = n
+	store.mu.Unlock()
+	wantStatus(t, c.do("GET", path, nil, "If-Modified-Since", lastModified), http.StatusOK)
+}
+
+func TestNotesFilterConflicts(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	for _, query := range []string{
+		"done=true&done=false",
+		"archived=true&archived=false",
+		"q=a&q=b",
+		"created_after=2030-02-01T00:00:00Z&created_before=2030-01-01T00:00:00Z",
+		"done=maybe",
+		"notebook_id=-1",
+	} {
+		wantStatus(t, c.do("GET", "/notes?"+query, nil), http.StatusBadRequest)
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	for _, n := range []Note{{ID: 7}, {ID: 42, Pinned: true, Position: 3}, {ID: 1, Position: -2}} {
+		c, ok := parseCursor(encodeCursor(n))
+		if !ok || c.ID != n.ID || c.Pinned != n.Pinned || c.Position != n.Position {
+			t.Errorf("cursor for %+v decodes to %+v, %v", n, c, ok)
+		}
+	}
+	for _, s := range []string{"", "!!", "MTo3", "MjowOjc", "MDowOjA", "MDp4Ojc"} {
+		if _, ok := parseCursor(s); ok {
+			t.Errorf("parseCursor(%q) accepted", s)
+		}
+	}
+}
+
+// TestNotesCursorPages pages through the list two at a time while a note
+// is added part way, and checks every original note is seen exactly once.
+func TestNotesCursorPages(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	for i := range 5 {
+		c.createNote(map[string]string{"title": "note " + strconv.Itoa(i)})
+	}
+	want := noteIDs(c.listNotes(""))
+
+	var got []int
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("no end after %d pages: %v", pages, got)
+		}
+		path := "/notes?limit=2"
+		if cursor != "" {
+			path += "&cursor=" + cursor
+		}
+		resp := c.do("GET", path, nil)
+		wantStatus(t, resp, http.StatusOK)
+		if n := resp.Header.Get("X-Total-Count"); pages == 0 && n != "5" {
+			t.Errorf("X-Total-Count = %q, want 5", n)
+		}
+		header := resp.Header.Get("X-Next-Cursor")
+		var page struct {
+			Notes      []Note  `json:"notes"`
+			NextCursor *string `json:"next_cursor"`
+		}
+		decodeBody(t, resp, &page)
+		got = append(got, noteIDs(page.Notes)...)
+		if page.NextCursor == nil {
+			if header != "" {
+				t.Errorf("last page has X-Next-Cursor %q", header)
+			}
+			break
+		}
+		if *page.NextCursor != header {
+			t.Errorf("next_cursor %q, X-Next-Cursor %q", *page.NextCursor, header)
+		}
+		cursor = *page.NextCursor
+		if pages == 0 {
+			c.createNote(map[string]string{"title": "added mid-way"})
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("paged ids = %v, want %v", got, want)
+	}
+
+	// Without ?limit the list is still a bare array.
+	resp := c.do("GET", "/notes", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); !strings.HasPrefix(body, "[") {
+		t.Errorf("unpaged body = %.40s, want an array", body)
+	}
+	wantStatus(t, c.do("GET", "/notes?limit=2&cursor=nope", nil), http.StatusBadRequest)
+}
+
+func TestNotesCreatedRange(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	day := func(d int) time.Time { return time.Date(2030, 1, d, 0, 0, 0, 0, time.UTC) }
+	ids := map[int]int{}
+	for _, d := range []int{1, 2, 3} {
+		n := c.createNote(map[string]string{"title": fmt.Sprint("day ", d)})
+		if _, err := db.Exec(`UPDATE notes SET created_at = ? WHERE id = ?`, day(d), n.ID); err != nil {
+			t.Fatal(err)
+		}
+		ids[d] = n.ID
+	}
+	stamp := func(d int) string { return day(d).Format(time.RFC3339) }
+
+	for query, want := range map[string][]int{
+		"created_after=" + stamp(2):                                 {ids[3], ids[2]},
+		"created_before=" + stamp(2):                                {ids[1]},
+		"created_after=" + stamp(2) + "&created_before=" + stamp(3): {ids[2]},
+		// The same instant in another zone.
+		"created_after=" + url.QueryEscape("2030-01-02T01:00:00+01:00"): {ids[3], ids[2]},
+		"created_after=" + stamp(2) + "&created_before=" + stamp(2):     nil,
+	} {
+		if got := noteIDs(c.listNotes(query)); !slices.Equal(got, want) {
+			t.Errorf("%s: %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestNotesCreatedRangeValidation(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	for query, msg := range map[string]string{
+		"created_after=yesterday":   "created_after must be an RFC3339 timestamp",
+		"created_before=2030-01-02": "created_before must be an RFC3339 timestamp",
+		"created_after=2030-01-03T00:00:00Z&created_before=2030-01-02T00:00:00Z": "created_after must not be later than created_before",
+	} {
+		resp := c.do("GET", "/notes?"+query, nil)
+		wantStatus(t, resp, http.StatusBadRequest)
+		if body := readBody(t, resp); !strings.Contains(body, msg) {
+			t.Errorf("%s: body %q, want %q", query, body, msg)
+		}
+	}
+}
+
+func TestCreateNoteDedupe(t *testing.T) {
+	a, store, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	userID := c.login("alice")
+	orig := c.createNote(map[string]string{"title": "groceries", "content": "milk"})
+
+	post := func(query string, body map[string]string) (*http.Response, Note) {
+		t.Helper()
+		resp := c.do("POST", "/notes"+query, body)
+		var n Note
+		if resp.StatusCode < 300 {
+			decodeBody(t, resp, &n)
+		}
+		return resp, n
+	}
+
+	// A hit hands back the original with 200; the title is trimmed first,
+	// as it is when stored.
+	resp, n := post("?dedupe=true", map[string]string{"title": "  groceries ", "content": "milk"})
+	wantStatus(t, resp, http.StatusOK)
+	if n.ID != orig.ID {
+		t.Fatalf("dedupe hit returned note %d, want %d", n.ID, orig.ID)
+	}
+
+	// Anything that differs is a new note.
+	for _, body := range []map[string]string{
+		{"title": "Groceries", "content": "milk"},
+		{"title": "groceries", "content": "milk "},
+		{"title": "groceries"},
+	} {
+		resp, n := post("?dedupe=true", body)
+		wantStatus(t, resp, http.StatusCreated)
+		if n.ID == orig.ID {
+			t.Errorf("%v matched the original", body)
+		}
+	}
+	// Without the flag a copy is made, as before.
+	resp, n = post("", map[string]string{"title": "groceries", "content": "milk"})
+	wantStatus(t, resp, http.StatusCreated)
+	if n.ID == orig.ID {
+		t.Fatal("created without ?dedupe but got the original back")
+	}
+	// With two identical notes, the oldest is the match.
+	if _, n := post("?dedupe=1", map[string]string{"title": "groceries", "content": "milk"}); n.ID != orig.ID {
+		t.Errorf("matched note %d, want the oldest, %d", n.ID, orig.ID)
+	}
+	if cnt, _ := store.Count(t.Context(), userID, NoteFilter{}); cnt != 5 {
+		t.Errorf("store holds %d notes, want 5", cnt)
+	}
+
+	// Only the caller's notes are candidates.
+	bob := c.newClient()
+	bob.login("bob")
+	resp = bob.do("POST", "/notes?dedupe=true", map[string]string{"title": "groceries", "content": "milk"})
+	wantStatus(t, resp, http.StatusCreated)
+	wantStatus(t, c.do("POST", "/notes?dedupe=maybe", map[string]string{"title": "x"}), http.StatusBadRequest)
+
+	// A hit creates nothing, so it doesn't use up the rate limit.
+	useNoteCreateLimit(t, 1)
+	for range 3 {
+		resp, _ := post("?dedupe=true", map[string]string{"title": "groceries", "content": "milk"})
+		wantStatus(t, resp, http.StatusOK)
+	}
+	resp, _ = post("?dedupe=true", map[string]string{"title": "new", "content": "one"})
+	wantStatus(t, resp, http.StatusCreated)
+	resp, _ = post("?dedupe=true", map[string]string{"title": "new", "content": "two"})
+	wantStatus(t, resp, http.StatusTooManyRequests)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"embed"
+	"net/http"
+)
+
+// specFS holds the hand-maintained API description served at /openapi.json.
+// Keep openapi.json in sync when adding or changing endpoints.
+//
+//go:embed openapi.json
+var specFS embed.FS
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	spec, err := specFS.ReadFile("openapi.json")
+	if err != nil {
+		requestLog(r).Error("openapi read", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	openAPIHandler(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", spec.OpenAPI)
+	}
+
+	w = httptest.NewRecorder()
+	openAPIHandler(w, httptest.NewRequest("POST", "/openapi.json", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", w.Code)
+	}
+}
+
+// TestOpenAPICoversRoutes fails when a route is registered in main.go
+// without being described in openapi.json, or the other way round.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	src, err := os.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Routes that aren't part of the JSON API.
+	undocumented := map[string]bool{
+		"/notes/{$}": true, "/openapi.json": true, "/metrics": true,
+		"/static/": true, "/favicon.ico": true, "/": true,
+	}
+	routes := map[string]bool{}
+	for _, m := range regexp.MustCompile(`mux\.Handle(?:Func)?\("([^"]+)"`).FindAllSubmatch(src, -1) {
+		if p := string(m[1]); !undocumented[p] {
+			routes[p] = true
+		}
+	}
+
+	spec, err := specFS.ReadFile("openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for p := range routes {
+		if _, ok := doc.Paths[p]; !ok {
+			t.Errorf("route %s is missing from openapi.json", p)
+		}
+	}
+	for p := range doc.Paths {
+		if !routes[p] {
+			t.Errorf("openapi.json describes %s, which isn't routed", p)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+)
+
+// pinNoteHandler toggles PATCH /notes/{id}/pin. Pinned notes are listed
+// ahead of the rest and keep their own order among themselves through
+// position, which PUT /notes/reorder sets. Pinning past cfg.MaxPinnedNotes
+// is refused with 409; unpinning always works.
+func (a *app) pinNoteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		methodNotAllowed(w, http.MethodPatch)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	// The cap is checked in the UPDATE itself rather than by a separate
+	// read first. MySQL won't read the table it's updating in a subquery
+	// (error 1093), hence the derived table around the count; as in
+	// sqlUserStore.Create, its LIMIT stops the optimizer merging it back
+	// in. Counting no further than the cap doesn't change the answer.
+	limit := a.cfg.MaxPinnedNotes
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	res, err := db.ExecContext(r.Context(),
+		`UPDATE notes SET pinned = NOT pinned, version = version + 1, updated_at = CURRENT_TIMESTAMP(6)
+		WHERE id = ? AND user_id = ?
+		AND (pinned OR (SELECT COUNT(*) FROM (SELECT id FROM notes WHERE user_id = ? AND pinned LIMIT ?) p) < ?)`,
+		id, userID, userID, limit, limit,
+	)
+	if err != nil {
+		requestLog(r).Error("pinNote update", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	aff, _ := res.RowsAffected()
+
+	note, err := fetchNote(r.Context(), userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("pinNote fetch", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	if aff == 0 {
+		writeJSONError(w, http.StatusConflict, msgTooManyPins, a.cfg.MaxPinnedNotes)
+		return
+	}
+	notifyNote("note.updated", note)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
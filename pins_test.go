@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestPinLimit(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	a.cfg.MaxPinnedNotes = 2
+
+	pin := func(id int) *http.Response {
+		return c.do("PATCH", fmt.Sprintf("/notes/%d/pin", id), nil)
+	}
+	var ids []int
+	for i := range 3 {
+		ids = append(ids, c.createNote(map[string]string{"title": fmt.Sprint("note ", i)}).ID)
+	}
+	wantStatus(t, pin(ids[0]), http.StatusOK)
+	wantStatus(t, pin(ids[1]), http.StatusOK)
+	if msg := wantJSONError(t, pin(ids[2]), http.StatusConflict); msg != "at most 2 notes can be pinned" {
+		t.Errorf("error = %q", msg)
+	}
+
+	// Unpinning always works, and frees a slot.
+	resp := pin(ids[0])
+	wantStatus(t, resp, http.StatusOK)
+	var n Note
+	decodeBody(t, resp, &n)
+	if n.Pinned {
+		t.Fatal("note still pinned after a second toggle")
+	}
+	wantStatus(t, pin(ids[2]), http.StatusOK)
+
+	// Other users have their own allowance.
+	bob := c.newClient()
+	bob.login("bob")
+	wantStatus(t, bob.do("PATCH", fmt.Sprintf("/notes/%d/pin", bob.createNote(map[string]string{"title": "b"}).ID), nil), http.StatusOK)
+	wantStatus(t, bob.do("PATCH", fmt.Sprintf("/notes/%d/pin", ids[0]), nil), http.StatusNotFound)
+
+	if got := noteIDs(c.listNotes("pinned=true")); len(got) != 2 || !slices.Contains(got, ids[1]) || !slices.Contains(got, ids[2]) {
+		t.Errorf("pinned=true: %v, want %d and %d", got, ids[1], ids[2])
+	}
+	if got := noteIDs(c.listNotes("pinned=false")); !slices.Equal(got, []int{ids[0]}) {
+		t.Errorf("pinned=false: %v, want [%d]", got, ids[0])
+	}
+	wantStatus(t, c.do("GET", "/notes?pinned=sometimes", nil), http.StatusBadRequest)
+}
+
+// TestPinUpToLimit fills the default allowance, then lifts the cap. It
+// runs the UPDATE's derived-table count against MySQL with the cap
+// exactly reached, where error 1093 would show up.
+func TestPinUpToLimit(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	limit := a.cfg.MaxPinnedNotes
+
+	var ids []int
+	for i := range limit + 2 {
+		ids = append(ids, c.createNote(map[string]string{"title": fmt.Sprint("note ", i)}).ID)
+	}
+	pin := func(id int) *http.Response {
+		return c.do("PATCH", fmt.Sprintf("/notes/%d/pin", id), nil)
+	}
+	for _, id := range ids[:limit] {
+		wantStatus(t, pin(id), http.StatusOK)
+	}
+	wantJSONError(t, pin(ids[limit]), http.StatusConflict)
+	if got := len(c.listNotes("pinned=true")); got != limit {
+		t.Fatalf("%d notes pinned, want %d", got, limit)
+	}
+
+	// 0 means no cap.
+	a.cfg.MaxPinnedNotes = 0
+	wantStatus(t, pin(ids[limit]), http.StatusOK)
+	wantStatus(t, pin(ids[limit+1]), http.StatusOK)
+	if got := len(c.listNotes("pinned=true")); got != limit+2 {
+		t.Fatalf("%d notes pinned with no cap, want %d", got, limit+2)
+	}
+}
+
+func TestPinnedOrdering(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	var ids []int
+	for i := range 4 {
+		ids = append(ids, c.createNote(map[string]string{"title": fmt.Sprint("note ", i)}).ID)
+	}
+	wantStatus(t, c.do("PATCH", fmt.Sprintf("/notes/%d/pin", ids[0]), nil), http.StatusOK)
+	wantStatus(t, c.do("PATCH", fmt.Sprintf("/notes/%d/pin", ids[2]), nil), http.StatusOK)
+
+	// Pins come first whatever their position; reordering moves them
+	// among themselves.
+	wantStatus(t, c.do("PUT", "/notes/reorder", map[string][]int{"ids": {ids[3], ids[1], ids[2], ids[0]}}), http.StatusNoContent)
+	if got, want := noteIDs(c.listNotes("")), []int{ids[2], ids[0], ids[3], ids[1]}; !slices.Equal(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+	wantStatus(t, c.do("PUT", "/notes/reorder", map[string][]int{"ids": {ids[0], ids[2]}}), http.StatusNoContent)
+	if got, want := noteIDs(c.listNotes("pinned=true")), []int{ids[0], ids[2]}; !slices.Equal(got, want) {
+		t.Fatalf("pinned order = %v, want %v", got, want)
+	}
+}
+
+func TestRestoreRespectsPinLimit(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	a.cfg.MaxPinnedNotes = 2
+
+	existing := c.createNote(map[string]string{"title": "mine"})
+	wantStatus(t, c.do("PATCH", fmt.Sprintf("/notes/%d/pin", existing.ID), nil), http.StatusOK)
+	archive := string(buildZip(t, map[string]string{
+		backupNotesFile: `[{"id":1,"title":"a","pinned":true},{"id":2,"title":"b","pinned":true}]`,
+	}))
+
+	// Merging would make three pins.
+	resp := c.do("POST", "/me/restore", archive, "Content-Type", "application/zip")
+	wantJSONError(t, resp, http.StatusConflict)
+	if n := countRows(t, "notes"); n != 1 {
+		t.Fatalf("%d notes after a refused restore, want 1", n)
+	}
+	// Replacing drops the existing pin first, so two fit.
+	wantStatus(t, c.do("POST", "/me/restore?mode=replace", archive, "Content-Type", "application/zip"), http.StatusOK)
+	if got := c.listNotes("pinned=true"); len(got) != 2 {
+		t.Fatalf("%d pinned notes after replace, want 2", len(got))
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// noteCreateLimiter throttles note creation per user (NOTE_CREATE_RATE per
+// minute), whichever endpoint creates the notes. Nil means unlimited.
+var noteCreateLimiter *RateLimiter
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is an in-memory token bucket per user: each user may burst
+// up to the per-minute limit, then gets tokens back at a steady rate.
+// Buckets that have refilled completely are dropped by a background sweep
+// until Stop is called, since a fresh bucket would behave the same.
+type RateLimiter struct {
+	mu      sync.Mutex
+	perSec  float64
+	burst   float64
+	buckets map[int]*bucket
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newRateLimiter allows perMinute events per user per minute and sweeps idle
+// buckets every interval.
+func newRateLimiter(perMinute int, interval time.Duration) *RateLimiter {
+	l := &RateLimiter{
+		perSec:  float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		buckets: make(map[int]*bucket),
+		stop:    make(chan struct{}),
+	}
+	go l.sweepLoop(interval)
+	return l
+}
+
+// Allow takes a token from userID's bucket. When it's empty, Allow returns
+// false and how long until the next token.
+func (l *RateLimiter) Allow(userID int, now time.Time) (bool, time.Duration) {
+	return l.AllowN(userID, 1, now)
+}
+
+// AllowN takes n tokens from userID's bucket, all or none. When there
+// aren't enough it returns false and how long until there will be; n above
+// the burst size can never be allowed.
+func (l *RateLimiter) AllowN(userID, n int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[userID]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[userID] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if need := float64(n); b.tokens < need {
+		wait := time.Duration((need - b.tokens) / l.perSec * float64(time.Second))
+		return false, wait
+	}
+	b.tokens -= float64(n)
+	return true, 0
+}
+
+// refill is b's token count at now, capped at the burst size.
+func (l *RateLimiter) refill(b *bucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.perSec)
+}
+
+// Stop ends the background sweep. It is safe to call more than once.
+func (l *RateLimiter) Stop() {
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
+func (l *RateLimiter) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			l.sweep(now)
+		}
+	}
+}
+
+func (l *RateLimiter) sweep(now time.Time) {
+	l.mu.Lock()
+	for userID, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, userID)
+		}
+	}
+	l.mu.Unlock()
+}
+
+// allowNoteCreate applies noteCreateLimiter to the caller creating n notes,
+// answering 429 with Retry-After when they're over the limit. Batches
+// larger than the limit itself are refused outright, with no Retry-After,
+// since waiting won't help.
+func allowNoteCreate(w http.ResponseWriter, userID, n int) bool {
+	if noteCreateLimiter == nil {
+		return true
+	}
+	if float64(n) > noteCreateLimiter.burst {
+		writeJSONError(w, http.StatusTooManyRequests, msgNoteBurstTooLarge, n, int(noteCreateLimiter.burst))
+		return false
+	}
+	ok, wait := noteCreateLimiter.AllowN(userID, n, time.Now())
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeJSONError(w, http.StatusTooManyRequests, msgTooManyNotes)
+	}
+	return ok
+}
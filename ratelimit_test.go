@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBucket(t *testing.T) {
+	l := newRateLimiter(60, time.Hour) // one token a second
+	defer l.Stop()
+	now := time.Now()
+
+	for i := 0; i < 60; i++ {
+		if ok, _ := l.Allow(1, now); !ok {
+			t.Fatalf("request %d refused within the burst", i+1)
+		}
+	}
+	ok, wait := l.Allow(1, now)
+	if ok || wait != time.Second {
+		t.Fatalf("empty bucket: ok %v, wait %v; want a refusal and 1s", ok, wait)
+	}
+	// Other users have their own buckets.
+	if ok, _ := l.Allow(2, now); !ok {
+		t.Fatal("user 2 refused because of user 1")
+	}
+
+	// Tokens come back at the steady rate.
+	if ok, _ := l.Allow(1, now.Add(500*time.Millisecond)); ok {
+		t.Fatal("allowed before a whole token refilled")
+	}
+	if ok, _ := l.Allow(1, now.Add(1500*time.Millisecond)); !ok {
+		t.Fatal("refused after a token refilled")
+	}
+	if ok, _ := l.Allow(1, now.Add(1500*time.Millisecond)); ok {
+		t.Fatal("allowed twice on one refilled token")
+	}
+}
+
+func TestRateLimiterAllowN(t *testing.T) {
+	l := newRateLimiter(10, time.Hour)
+	defer l.Stop()
+	now := time.Now()
+
+	if ok, _ := l.AllowN(1, 7, now); !ok {
+		t.Fatal("7 of 10 refused")
+	}
+	// Not enough for 5: none are taken.
+	ok, wait := l.AllowN(1, 5, now)
+	if ok || wait != 12*time.Second {
+		t.Fatalf("5 of the 3 left: ok %v, wait %v; want a refusal and 12s", ok, wait)
+	}
+	if ok, _ := l.AllowN(1, 3, now); !ok {
+		t.Fatal("a refused AllowN used up tokens")
+	}
+	if ok, _ := l.AllowN(2, 11, now); ok {
+		t.Fatal("more than the burst allowed")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l := newRateLimiter(60, time.Hour)
+	l.Stop()
+	l.Stop() // a second Stop is harmless
+	now := time.Now()
+	l.Allow(1, now)
+	l.AllowN(2, 30, now)
+
+	l.sweep(now.Add(2 * time.Second))
+	if _, ok := l.buckets[1]; ok {
+		t.Error("refilled bucket kept")
+	}
+	if _, ok := l.buckets[2]; !ok {
+		t.Error("bucket still refilling was dropped")
+	}
+}
+
+// useNoteCreateLimit limits note creation to perMinute for the test.
+func useNoteCreateLimit(t *testing.T, perMinute int) {
+	old := noteCreateLimiter
+	noteCreateLimiter = newRateLimiter(perMinute, time.Hour)
+	t.Cleanup(func() {
+		noteCreateLimiter.Stop()
+		noteCreateLimiter = old
+	})
+}
+
+func TestNoteCreateRateLimit(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	useNoteCreateLimit(t, 5)
+
+	note := c.createNote(map[string]string{"title": "one"})
+	// Every way of creating notes draws on the same allowance.
+	wantStatus(t, c.do("POST", fmt.Sprintf("/notes/%d/duplicate", note.ID), nil), http.StatusCreated)
+	wantStatus(t, c.do("POST", "/notes/import", `[{"title": "two"}]`), http.StatusCreated)
+	// A batch is charged per note, all or nothing: 3 won't fit in 2.
+	batch := func(n int) *http.Response {
+		notes := make([]map[string]string, n)
+		for i := range notes {
+			notes[i] = map[string]string{"title": "batch"}
+		}
+		return c.do("POST", "/notes/batch", map[string]interface{}{"notes": notes})
+	}
+	resp := batch(3)
+	wantJSONError(t, resp, http.StatusTooManyRequests)
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || s < 1 {
+		t.Errorf("Retry-After = %q", resp.Header.Get("Retry-After"))
+	}
+	wantStatus(t, batch(2), http.StatusCreated)
+
+	for _, req := range []struct{ path, body string }{
+		{"/notes", `{"title": "x"}`},
+		{fmt.Sprintf("/notes/%d/duplicate", note.ID), ""},
+		{"/notes/import", `[{"title": "x"}]`},
+		{"/notes/batch", `{"notes": [{"title": "x"}]}`},
+	} {
+		var body interface{}
+		if req.body != "" {
+			body = req.body
+		}
+		resp := c.do("POST", req.path, body)
+		wantJSONError(t, resp, http.StatusTooManyRequests)
+		if resp.Header.Get("Retry-After") == "" {
+			t.Errorf("POST %s: no Retry-After", req.path)
+		}
+	}
+
+	// More than the whole limit can never succeed, so there's no point
+	// saying when to retry.
+	resp = batch(6)
+	wantJSONError(t, resp, http.StatusTooManyRequests)
+	if resp.Header.Get("Retry-After") != "" {
+		t.Errorf("oversized batch: Retry-After %q", resp.Header.Get("Retry-After"))
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverMiddleware turns a panicking handler into a plain 500 instead of a
+// dropped connection. The panic value and stack go to the log under the
+// request ID; the client only sees a generic error. http.ErrAbortHandler
+// is re-raised, since net/http uses it to abort a response on purpose.
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			requestLog(r).Error("panic", "value", err, "stack", string(debug.Stack()))
+			// If the handler had already started its response this only
+			// adds a superfluous-WriteHeader log line; the client gets
+			// whatever was sent.
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
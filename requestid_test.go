@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidRE = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	h := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFromContext(r.Context())
+	}))
+	for _, tc := range []struct {
+		name, in string
+		keep     bool
+	}{
+		{"missing", "", false},
+		{"client supplied", "abc-123", true},
+		{"control characters", "abc\ninjected", false},
+		{"space", "a b", false},
+		{"too long", strings.Repeat("x", maxRequestIDLen+1), false},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tc.in != "" {
+			r.Header.Set("X-Request-ID", tc.in)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		got := w.Header().Get("X-Request-ID")
+		if got != seen {
+			t.Errorf("%s: header %q, context %q", tc.name, got, seen)
+		}
+		if tc.keep && got != tc.in {
+			t.Errorf("%s: id %q, want %q echoed", tc.name, got, tc.in)
+		}
+		if !tc.keep && !uuidRE.MatchString(got) {
+			t.Errorf("%s: id %q, want a fresh UUID", tc.name, got)
+		}
+	}
+}
+
+func TestNewRequestIDUnique(t *testing.T) {
+	if a, b := newRequestID(), newRequestID(); a == b {
+		t.Fatalf("two IDs are both %q", a)
+	}
+}
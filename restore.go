@@ -0,0 +1,481 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// maxRestoreBytes caps an uploaded backup archive, and how much of any one
+// JSON file in it is read.
+const maxRestoreBytes = 256 << 20
+
+// errTooManyPinned is restoreBackup's answer to an archive that would take
+// the account past cfg.MaxPinnedNotes.
+var errTooManyPinned = errors.New("too many pinned notes")
+
+// restoreNote is a note as it appears in a backup's notes.json. Fields the
+// server owns (user_id, version, the counts) are ignored.
+type restoreNote struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	ContentType string     `json:"content_type"`
+	Archived    bool       `json:"archived"`
+	Done        bool       `json:"done"`
+	Pinned      bool       `json:"pinned"`
+	Starred     bool       `json:"starred"`
+	Color       string     `json:"color"`
+	NotebookID  *int       `json:"notebook_id"`
+	DueAt       *time.Time `json:"due_at"`
+	Position    int        `json:"position"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// backupArchive is the parsed content of a backup zip. IDs in it are the
+// ones from the account it was made from; restoring assigns new ones.
+type backupArchive struct {
+	notes       []restoreNote
+	notebooks   []Notebook
+	attachments []backupAttachment
+	files       map[string]*zip.File
+}
+
+// restoreHandler loads a GET /me/backup archive into the caller's account.
+// With ?mode=merge (the default) the backup's notes are added alongside the
+// existing ones, and its notebooks are matched to existing notebooks by
+// name. With ?mode=replace the caller's notes, notebooks and attachments
+// are deleted first. Either way everything is written in one transaction,
+// so a failed restore leaves the account as it was. Revision history,
+// shares and collaborators aren't part of a backup and start out empty.
+func (a *app) restoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+
+	var replace bool
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", "merge":
+	case "replace":
+		replace = true
+	default:
+		http.Error(w, "mode must be merge or replace", http.StatusBadRequest)
+		return
+	}
+
+	// zip needs random access, so spool the upload to disk first.
+	tmp, err := os.CreateTemp("", "restore-*.zip")
+	if err != nil {
+		requestLog(r).Error("restore temp file", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, http.MaxBytesReader(w, r.Body, maxRestoreBytes))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, msgBodyTooLarge)
+			return
+		}
+		http.Error(w, "could not read body", http.StatusBadRequest)
+		return
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		http.Error(w, "body must be a zip archive made by GET /me/backup", http.StatusBadRequest)
+		return
+	}
+	arc, err := readBackup(zr)
+	if err != nil {
+		http.Error(w, "malformed backup: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var verr ValidationError
+	contentTypes := validateBackup(&verr, arc, a.cfg.MaxUploadBytes)
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return
+	}
+
+	// Files go in place before the rows that point at them, and are removed
+	// again if the transaction doesn't commit.
+	stored, err := a.storeBackupFiles(arc)
+	if err != nil {
+		requestLog(r).Error("restore files", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			a.removeAttachmentFiles(stored)
+		}
+	}()
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		requestLog(r).Error("restore begin", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer tx.Rollback()
+
+	var oldFiles []string
+	if replace {
+		oldFiles, err = clearAccountNotes(r.Context(), tx, userID)
+		if err != nil {
+			requestLog(r).Error("restore clear", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+	}
+	err = restoreBackup(r.Context(), tx, userID, arc, stored, contentTypes,
+		clientIP(r), truncateUTF8(r.UserAgent(), maxUserAgentLen), a.cfg.MaxPinnedNotes,
+	)
+	if errors.Is(err, errTooManyPinned) {
+		writeJSONError(w, http.StatusConflict, msgTooManyPins, a.cfg.MaxPinnedNotes)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("restore insert", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		requestLog(r).Error("restore commit", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	committed = true
+	a.removeAttachmentFiles(oldFiles)
+
+	mode := "merge"
+	if replace {
+		mode = "replace"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mode":        mode,
+		"notes":       len(arc.notes),
+		"notebooks":   len(arc.notebooks),
+		"attachments": len(arc.attachments),
+	})
+}
+
+// readBackup parses the archive's manifests and checks that they hang
+// together: notes.json is present, ids are unique, and every reference
+// (note to notebook, attachment to note, attachment to file) resolves.
+func readBackup(zr *zip.Reader) (*backupArchive, error) {
+	arc := &backupArchive{files: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		arc.files[f.Name] = f
+	}
+	if _, ok := arc.files[backupNotesFile]; !ok {
+		return nil, errors.New(backupNotesFile + " is missing")
+	}
+	if err := decodeZipJSON(arc.files, backupNotesFile, &arc.notes); err != nil {
+		return nil, err
+	}
+	if err := decodeZipJSON(arc.files, backupNotebooksFile, &arc.notebooks); err != nil {
+		return nil, err
+	}
+	if err := decodeZipJSON(arc.files, backupAttachmentsFile, &arc.attachments); err != nil {
+		return nil, err
+	}
+
+	notebooks := make(map[int]bool, len(arc.notebooks))
+	for _, nb := range arc.notebooks {
+		if notebooks[nb.ID] {
+			return nil, fmt.Errorf("%s: notebook id %d appears twice", backupNotebooksFile, nb.ID)
+		}
+		notebooks[nb.ID] = true
+	}
+	notes := make(map[int]bool, len(arc.notes))
+	for _, n := range arc.notes {
+		if notes[n.ID] {
+			return nil, fmt.Errorf("%s: note id %d appears twice", backupNotesFile, n.ID)
+		}
+		notes[n.ID] = true
+		if n.NotebookID != nil && !notebooks[*n.NotebookID] {
+			return nil, fmt.Errorf("%s: note %d refers to notebook %d, which isn't in %s", backupNotesFile, n.ID, *n.NotebookID, backupNotebooksFile)
+		}
+	}
+	for _, a := range arc.attachments {
+		if !notes[a.NoteID] {
+			return nil, fmt.Errorf("%s: attachment %d refers to note %d, which isn't in %s", backupAttachmentsFile, a.ID, a.NoteID, backupNotesFile)
+		}
+		if _, ok := arc.files[a.Path]; !ok {
+			return nil, fmt.Errorf("%s: attachment %d's file %q is missing", backupAttachmentsFile, a.ID, a.Path)
+		}
+	}
+	return arc, nil
+}
+
+// decodeZipJSON decodes the archive file name into dst, leaving dst alone
+// if there's no such file.
+func decodeZipJSON(files map[string]*zip.File, name string, dst interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(io.LimitReader(rc, maxRestoreBytes)).Decode(dst); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// validateBackup applies the same rules as the API's own create endpoints,
+// keying problems by file and index ("notes[3].title"). It returns the
+// sniffed content type of each attachment, in order. Attachments over
+// maxFileBytes are refused, as an upload would be.
+func validateBackup(verr *ValidationError, arc *backupArchive, maxFileBytes int64) []string {
+	for i, nb := range arc.notebooks {
+		prefix := "notebooks[" + strconv.Itoa(i) + "]"
+		if nb.Name == "" {
+			verr.Add(prefix+".name", "required")
+		} else if len(nb.Name) > maxNotebookNameLen {
+			verr.Add(prefix+".name", "too long")
+		}
+	}
+	for i := range arc.notes {
+		n := &arc.notes[i]
+		prefix := "notes[" + strconv.Itoa(i) + "]"
+		var noteErr ValidationError
+		n.Title = validateNote(&noteErr, n.Title, n.Content)
+		for field, msg := range noteErr.Fields {
+			verr.Add(prefix+"."+field, msg)
+		}
+		if n.ContentType == "" {
+			n.ContentType = defaultNoteContentType
+		}
+		if !noteContentTypes[n.ContentType] {
+			verr.Add(prefix+".content_type", "must be plain, markdown or checklist")
+		}
+		if n.Color == "" {
+			n.Color = defaultNoteColor
+		}
+		if !noteColors[n.Color] {
+			verr.Add(prefix+".color", "invalid")
+		}
+	}
+
+	contentTypes := make([]string, len(arc.attachments))
+	for i, a := range arc.attachments {
+		prefix := "attachments[" + strconv.Itoa(i) + "]"
+		f := arc.files[a.Path]
+		if f.UncompressedSize64 > uint64(maxFileBytes) {
+			verr.Add(prefix, "attachment too large")
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			verr.Add(prefix, "unreadable file")
+			continue
+		}
+		sniff := make([]byte, 512)
+		n, err := io.ReadFull(rc, sniff)
+		rc.Close()
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			verr.Add(prefix, "unreadable file")
+			continue
+		}
+		contentTypes[i] = http.DetectContentType(sniff[:n])
+		if !attachmentTypes[contentTypes[i]] {
+			verr.Add(prefix, "unsupported attachment type "+contentTypes[i])
+		}
+	}
+	return contentTypes
+}
+
+// storeBackupFiles copies each attachment's file into cfg.UploadDir under a
+// fresh stored name, returning the names in attachment order. On error
+// nothing is left behind.
+func (a *app) storeBackupFiles(arc *backupArchive) ([]string, error) {
+	stored := make([]string, 0, len(arc.attachments))
+	for _, att := range arc.attachments {
+		name, err := storeBackupFile(arc.files[att.Path], a.cfg.UploadDir, a.cfg.MaxUploadBytes)
+		if err != nil {
+			a.removeAttachmentFiles(stored)
+			return nil, fmt.Errorf("attachment %d: %w", att.ID, err)
+		}
+		stored = append(stored, name)
+	}
+	return stored, nil
+}
+
+// storeBackupFile copies f into dir, refusing it if it turns out to be
+// larger than maxBytes.
+func storeBackupFile(f *zip.File, dir string, maxBytes int64) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(b)
+	path := filepath.Join(dir, name)
+
+	src, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return "", err
+	}
+	// The header's size was checked, but it's the archive's claim; don't
+	// trust it to bound the copy.
+	n, err := io.Copy(out, io.LimitReader(src, maxBytes+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > maxBytes {
+		err = errors.New("attachment too large")
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return name, nil
+}
+
+// clearAccountNotes deletes userID's notes and notebooks inside tx, along
+// with everything hanging off the notes, and returns the stored names of
+// the attachment files to remove once tx commits.
+func clearAccountNotes(ctx context.Context, tx *sql.Tx, userID int) ([]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT a.stored_name FROM attachments a JOIN notes n ON n.id = a.note_id WHERE n.user_id = ?`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		files = append(files, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, q := range []string{
+		"DELETE FROM idempotency_keys WHERE user_id = ?",
+		"DELETE FROM notes WHERE user_id = ?",
+		"DELETE FROM notebooks WHERE user_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, q, userID); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// restoreBackup inserts the archive's notebooks, notes and attachment rows
+// for userID inside tx, mapping the backup's ids to the new ones. stored
+// and contentTypes line up with arc.attachments. The notes are recorded as
+// created from createdIP and createdUA, as any other new note would be.
+// Restored pins count toward maxPins along with any the account already
+// has; going past it fails with errTooManyPinned. 0 means no cap.
+func restoreBackup(ctx context.Context, tx *sql.Tx, userID int, arc *backupArchive, stored, contentTypes []string, createdIP, createdUA string, maxPins int) error {
+	if maxPins > 0 {
+		pins := 0
+		for _, n := range arc.notes {
+			if n.Pinned {
+				pins++
+			}
+		}
+		if pins > 0 {
+			var existing int
+			if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM notes WHERE user_id = ? AND pinned`, userID).Scan(&existing); err != nil {
+				return err
+			}
+			if existing+pins > maxPins {
+				return errTooManyPinned
+			}
+		}
+	}
+
+	notebookIDs := make(map[int]int, len(arc.notebooks))
+	for _, nb := range arc.notebooks {
+		// In merge mode a notebook of the same name is reused; after a
+		// replace there are none to find.
+		var id int
+		err := tx.QueryRowContext(ctx, `SELECT id FROM notebooks WHERE user_id = ? AND name = ? ORDER BY id LIMIT 1`, userID, nb.Name).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			id64, ierr := insertID(ctx, tx, `INSERT INTO notebooks (user_id, name) VALUES (?, ?)`, userID, nb.Name)
+			id, err = int(id64), ierr
+		}
+		if err != nil {
+			return fmt.Errorf("notebook %d: %w", nb.ID, err)
+		}
+		notebookIDs[nb.ID] = id
+	}
+
+	now := time.Now()
+	noteIDs := make(map[int]int, len(arc.notes))
+	for _, n := range arc.notes {
+		var notebookID, dueAt interface{}
+		if n.NotebookID != nil {
+			notebookID = notebookIDs[*n.NotebookID]
+		}
+		if n.DueAt != nil {
+			dueAt = *n.DueAt
+		}
+		createdAt, updatedAt := n.CreatedAt, n.UpdatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		if updatedAt.IsZero() {
+			updatedAt = createdAt
+		}
+		id64, err := insertID(ctx, tx,
+			`INSERT INTO notes (user_id, title, content, content_type, archived, done, pinned, starred, color, notebook_id, due_at, position, created_ip, created_user_agent, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, n.Title, n.Content, n.ContentType, n.Archived, n.Done, n.Pinned, n.Starred, n.Color, notebookID, dueAt, n.Position,
+			nullString(createdIP), nullString(createdUA), createdAt, updatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("note %d: %w", n.ID, err)
+		}
+		noteIDs[n.ID] = int(id64)
+	}
+
+	for i, a := range arc.attachments {
+		filename := truncateRunes(filepath.Base(a.Filename), maxFilenameLen)
+		size := int64(arc.files[a.Path].UncompressedSize64)
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO attachments (note_id, filename, stored_name, content_type, size) VALUES (?, ?, ?, ?, ?)`,
+			noteIDs[a.NoteID], filename, stored[i], contentTypes[i], size,
+		); err != nil {
+			return fmt.Errorf("attachment %d: %w", a.ID, err)
+		}
+	}
+	return nil
+}
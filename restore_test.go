@@ -0,0 +1,205 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// buildZip returns an archive holding files, name to content.
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(f, content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadBackup(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		err   string // "" means it parses
+	}{
+		{"minimal", map[string]string{backupNotesFile: `[{"id":1,"title":"a"}]`}, ""},
+		{"full", map[string]string{
+			backupNotesFile:       `[{"id":1,"title":"a","notebook_id":7}]`,
+			backupNotebooksFile:   `[{"id":7,"name":"work"}]`,
+			backupAttachmentsFile: `[{"id":3,"note_id":1,"path":"attachments/3/a.png"}]`,
+			"attachments/3/a.png": "png",
+		}, ""},
+		{"no notes", map[string]string{backupNotebooksFile: `[]`}, "notes.json is missing"},
+		{"bad json", map[string]string{backupNotesFile: `[{"id":1,`}, "notes.json:"},
+		{"duplicate note", map[string]string{backupNotesFile: `[{"id":1},{"id":1}]`}, "note id 1 appears twice"},
+		{"duplicate notebook", map[string]string{
+			backupNotesFile:     `[]`,
+			backupNotebooksFile: `[{"id":2,"name":"a"},{"id":2,"name":"b"}]`,
+		}, "notebook id 2 appears twice"},
+		{"unknown notebook", map[string]string{backupNotesFile: `[{"id":1,"notebook_id":9}]`}, "refers to notebook 9"},
+		{"unknown note", map[string]string{
+			backupNotesFile:       `[{"id":1}]`,
+			backupAttachmentsFile: `[{"id":3,"note_id":2,"path":"attachments/3/a.png"}]`,
+			"attachments/3/a.png": "png",
+		}, "refers to note 2"},
+		{"missing file", map[string]string{
+			backupNotesFile:       `[{"id":1}]`,
+			backupAttachmentsFile: `[{"id":3,"note_id":1,"path":"attachments/3/a.png"}]`,
+		}, `file "attachments/3/a.png" is missing`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := buildZip(t, tc.files)
+			zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = readBackup(zr)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("readBackup: %v", err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Fatalf("readBackup err = %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestRestoreRejectsCorruptArchive(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	valid := buildZip(t, map[string]string{backupNotesFile: `[{"id":1,"title":"a"}]`})
+	for name, body := range map[string]string{
+		"not a zip": "plain text, not an archive",
+		"truncated": string(valid[:len(valid)/2]),
+		"no notes":  string(buildZip(t, map[string]string{"readme.txt": "hi"})),
+		"bad json":  string(buildZip(t, map[string]string{backupNotesFile: "{"})),
+	} {
+		resp := c.do("POST", "/me/restore", body, "Content-Type", "application/zip")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, resp.StatusCode)
+		}
+		resp.Body.Close()
+	}
+	wantStatus(t, c.do("POST", "/me/restore?mode=overwrite", string(valid), "Content-Type", "application/zip"), http.StatusBadRequest)
+
+	// Well-formed but failing the note rules is a 422, field by field.
+	resp := c.do("POST", "/me/restore", string(buildZip(t, map[string]string{backupNotesFile: `[{"id":1,"title":"a"},{"id":2,"title":""}]`})), "Content-Type", "application/zip")
+	wantFieldErrors(t, resp, "notes[1].title")
+}
+
+func TestRestoreRoundTrip(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	first := c.createNote(map[string]string{"title": "first", "content": "body"})
+	c.createNote(map[string]string{"title": "second"})
+	wantStatus(t, c.upload(fmt.Sprintf("/notes/%d/attachments", first.ID), "chart.png", pngBytes), http.StatusCreated)
+
+	resp := c.do("GET", "/me/backup", nil)
+	wantStatus(t, resp, http.StatusOK)
+	archive := readBody(t, resp)
+
+	restore := func(mode string) {
+		t.Helper()
+		resp := c.do("POST", "/me/restore?mode="+mode, archive, "Content-Type", "application/zip")
+		wantStatus(t, resp, http.StatusOK)
+		var got map[string]interface{}
+		decodeBody(t, resp, &got)
+		if got["mode"] != mode || got["notes"] != 2.0 || got["attachments"] != 1.0 {
+			t.Fatalf("%s: response %v", mode, got)
+		}
+	}
+	titles := func() []string {
+		t.Helper()
+		var out []string
+		for _, n := range c.listNotes("") {
+			out = append(out, n.Title)
+		}
+		return out
+	}
+
+	// Merging adds the backup's notes alongside the originals.
+	restore("merge")
+	if got := titles(); len(got) != 4 {
+		t.Fatalf("after merge: %v, want each note twice", got)
+	}
+	if n := countRows(t, "attachments"); n != 2 {
+		t.Fatalf("after merge: %d attachments, want 2", n)
+	}
+
+	// Replacing leaves exactly what the backup held.
+	restore("replace")
+	got := titles()
+	if len(got) != 2 || !strings.Contains(strings.Join(got, ","), "first") || !strings.Contains(strings.Join(got, ","), "second") {
+		t.Fatalf("after replace: %v", got)
+	}
+	if n := countRows(t, "attachments"); n != 1 || uploadedFiles(t, a) != 1 {
+		t.Fatalf("after replace: %d attachment rows, %d files; want 1 of each", n, uploadedFiles(t, a))
+	}
+
+	// The restored note and its file come back intact.
+	var restored Note
+	for _, n := range c.listNotes("") {
+		if n.Title == "first" {
+			restored = n
+		}
+	}
+	if restored.Content != "body" || restored.ID == first.ID {
+		t.Fatalf("restored note = %+v", restored)
+	}
+	resp = c.do("GET", fmt.Sprintf("/notes/%d/attachments", restored.ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	var atts []Attachment
+	decodeBody(t, resp, &atts)
+	if len(atts) != 1 || atts[0].Filename != "chart.png" || atts[0].Size != int64(len(pngBytes)) {
+		t.Fatalf("restored attachments = %+v", atts)
+	}
+}
+
+// TestRestoreLongFilename restores an attachment named past the column in
+// multi-byte characters; like an upload, it's cut to maxFilenameLen
+// characters, whole.
+func TestRestoreLongFilename(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	name := strings.Repeat("写真", 200) + ".png" // 404 characters, 1204 bytes
+	archive := string(buildZip(t, map[string]string{
+		backupNotesFile:           `[{"id":1,"title":"with files"}]`,
+		backupAttachmentsFile:     fmt.Sprintf(`[{"id":1,"note_id":1,"filename":%q,"path":"attachments/1/photo.png"}]`, name),
+		"attachments/1/photo.png": string(pngBytes),
+	}))
+	wantStatus(t, c.do("POST", "/me/restore", archive, "Content-Type", "application/zip"), http.StatusOK)
+
+	notes := c.listNotes("")
+	if len(notes) != 1 {
+		t.Fatalf("%d notes restored, want 1", len(notes))
+	}
+	resp := c.do("GET", fmt.Sprintf("/notes/%d/attachments", notes[0].ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	var atts []Attachment
+	decodeBody(t, resp, &atts)
+	if len(atts) != 1 {
+		t.Fatalf("restored attachments = %+v", atts)
+	}
+	got := atts[0].Filename
+	if n := utf8.RuneCountInString(got); n != maxFilenameLen || !utf8.ValidString(got) || !strings.HasPrefix(name, got) {
+		t.Fatalf("filename %q: %d characters, want the first %d", got, n, maxFilenameLen)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRevisions is how many past versions are kept per note.
+const maxRevisions = 20
+
+type Revision struct {
+	ID       int       `json:"id"`
+	NoteID   int       `json:"note_id"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+// MarshalJSON emits EditedAt in UTC, like Note.
+func (rv Revision) MarshalJSON() ([]byte, error) {
+	type plain Revision
+	p := plain(rv)
+	p.EditedAt = p.EditedAt.UTC()
+	return json.Marshal(p)
+}
+
+// recordRevision copies the note's current title and content into
+// note_revisions, stamped with when that version was written, and prunes
+// all but the newest maxRevisions. It returns sql.ErrNoRows if userID
+// doesn't own the note.
+func recordRevision(ctx context.Context, tx *sql.Tx, userID, noteID int) error {
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO note_revisions (note_id, title, content, edited_at)
+		SELECT id, title, content, updated_at FROM notes WHERE id = ? AND user_id = ?`,
+		noteID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return sql.ErrNoRows
+	}
+
+	var oldestKept int
+	err = tx.QueryRowContext(ctx,
+		`SELECT id FROM note_revisions WHERE note_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?`,
+		noteID, maxRevisions-1,
+	).Scan(&oldestKept)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM note_revisions WHERE note_id = ? AND id < ?`, noteID, oldestKept)
+	return err
+}
+
+func listRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	noteID, ok := ownedNoteParam(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT id, note_id, title, content, edited_at FROM note_revisions WHERE note_id = ? ORDER BY id DESC`,
+		noteID,
+	)
+	if err != nil {
+		requestLog(r).Error("listRevisions query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		var rev Revision
+		var content sql.NullString
+		if err := rows.Scan(&rev.ID, &rev.NoteID, &rev.Title, &content, &rev.EditedAt); err != nil {
+			requestLog(r).Error("listRevisions scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		rev.Content = content.String
+		revisions = append(revisions, rev)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// restoreRevisionHandler rolls a note back to an earlier revision. The
+// version being replaced is itself recorded, so a restore can be undone.
+func restoreRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+	noteID, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+	revID, err := strconv.Atoi(r.PathValue("rev"))
+	if err != nil || revID <= 0 {
+		writeJSONError(w, http.StatusBadRequest, msgInvalidID)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		requestLog(r).Error("restoreRevision begin", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer tx.Rollback()
+
+	var title string
+	var content sql.NullString
+	err = tx.QueryRowContext(r.Context(),
+		`SELECT rv.title, rv.content FROM note_revisions rv JOIN notes n ON n.id = rv.note_id
+		WHERE rv.id = ? AND rv.note_id = ? AND n.user_id = ?`,
+		revID, noteID, userID,
+	).Scan(&title, &content)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgRevisionNotFound)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("restoreRevision query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	if err := recordRevision(r.Context(), tx, userID, noteID); err != nil {
+		requestLog(r).Error("restoreRevision record", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(),
+		`UPDATE notes SET title = ?, content = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP(6) WHERE id = ? AND user_id = ?`,
+		title, content, noteID, userID,
+	); err != nil {
+		requestLog(r).Error("restoreRevision update", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	note, err := scanNote(tx.StmtContext(r.Context(), stmts.get).QueryRowContext(r.Context(), noteID, userID))
+	if err != nil {
+		requestLog(r).Error("restoreRevision fetch", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		requestLog(r).Error("restoreRevision commit", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	notifyNote("note.updated", note)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
+
+// RevisionDiff is the response of revisionDiffHandler. From and To echo the
+// compared versions: a revision id, or "current" for the note as it is now.
+type RevisionDiff struct {
+	From    string     `json:"from"`
+	To      string     `json:"to"`
+	Added   int        `json:"added"`
+	Removed int        `json:"removed"`
+	Lines   []DiffLine `json:"lines"`
+}
+
+// revisionDiffHandler diffs the content of two versions of a note. from is
+// required; to defaults to "current".
+func revisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+	noteID, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	if to == "" {
+		to = "current"
+	}
+	if from == "" {
+		http.Error(w, "from is required", http.StatusBadRequest)
+		return
+	}
+	for _, ref := range []string{from, to} {
+		if ref == "current" {
+			continue
+		}
+		if id, err := strconv.Atoi(ref); err != nil || id <= 0 {
+			writeJSONError(w, http.StatusBadRequest, msgInvalidID)
+			return
+		}
+	}
+
+	note, err := fetchNote(r.Context(), userID, noteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("revisionDiff fetch note", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	// content resolves a version reference; revisions must belong to this
+	// note, which fetchNote has already tied to the user.
+	content := func(ref string) (string, error) {
+		if ref == "current" {
+			return note.Content, nil
+		}
+		revID, _ := strconv.Atoi(ref)
+		var c sql.NullString
+		err := db.QueryRowContext(r.Context(),
+			`SELECT content FROM note_revisions WHERE id = ? AND note_id = ?`,
+			revID, noteID,
+		).Scan(&c)
+		return c.String, err
+	}
+	a, err := content(from)
+	var b string
+	if err == nil {
+		b, err = content(to)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgRevisionNotFound)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("revisionDiff query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	diff := RevisionDiff{From: from, To: to, Lines: diffLines(a, b)}
+	for _, line := range diff.Lines {
+		switch line.Op {
+		case "added":
+			diff.Added++
+		case "removed":
+			diff.Removed++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// listRevisions is GET /notes/{id}/revisions, newest first.
+func listRevisions(t *testing.T, c *testClient, noteID int) []Revision {
+	t.Helper()
+	resp := c.do("GET", fmt.Sprintf("/notes/%d/revisions", noteID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	var revs []Revision
+	decodeBody(t, resp, &revs)
+	return revs
+}
+
+func TestRevisions(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "v1", "content": "one"})
+	path := fmt.Sprintf("/notes/%d", note.ID)
+	wantStatus(t, c.do("PUT", path, map[string]string{"title": "v2", "content": "two"}), http.StatusOK)
+	wantStatus(t, c.do("PUT", path, map[string]string{"title": "v3", "content": "three"}), http.StatusOK)
+
+	// Each edit keeps the version it replaced.
+	revs := listRevisions(t, c, note.ID)
+	if len(revs) != 2 || revs[0].Title != "v2" || revs[1].Title != "v1" || revs[1].Content != "one" {
+		t.Fatalf("revisions = %+v", revs)
+	}
+
+	resp := c.do("POST", fmt.Sprintf("%s/revisions/%d/restore", path, revs[1].ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	var restored Note
+	decodeBody(t, resp, &restored)
+	if restored.Title != "v1" || restored.Content != "one" || restored.Version != 4 {
+		t.Fatalf("restored note = %+v", restored)
+	}
+	// The restore is itself undoable.
+	if revs = listRevisions(t, c, note.ID); len(revs) != 3 || revs[0].Title != "v3" {
+		t.Fatalf("revisions after restore = %+v", revs)
+	}
+
+	bob := c.newClient()
+	bob.login("bob")
+	wantStatus(t, bob.do("GET", path+"/revisions", nil), http.StatusNotFound)
+	wantStatus(t, bob.do("POST", fmt.Sprintf("%s/revisions/%d/restore", path, revs[0].ID), nil), http.StatusNotFound)
+	wantStatus(t, c.do("POST", path+"/revisions/999999/restore", nil), http.StatusNotFound)
+}
+
+func TestRevisionsPruned(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "v0"})
+	for i := 1; i <= maxRevisions+5; i++ {
+		wantStatus(t, c.do("PUT", fmt.Sprintf("/notes/%d", note.ID), map[string]string{"title": fmt.Sprintf("v%d", i)}), http.StatusOK)
+	}
+	revs := listRevisions(t, c, note.ID)
+	if len(revs) != maxRevisions {
+		t.Fatalf("%d revisions kept, want %d", len(revs), maxRevisions)
+	}
+	if want := fmt.Sprintf("v%d", maxRevisions+4); revs[0].Title != want {
+		t.Fatalf("newest revision %q, want %q", revs[0].Title, want)
+	}
+}
+
+func TestRevisionDiff(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "list", "content": "milk\neggs"})
+	path := fmt.Sprintf("/notes/%d", note.ID)
+	wantStatus(t, c.do("PUT", path, map[string]string{"title": "list", "content": "milk\nbread\neggs"}), http.StatusOK)
+	wantStatus(t, c.do("PUT", path, map[string]string{"title": "list", "content": "milk\nbread"}), http.StatusOK)
+	revs := listRevisions(t, c, note.ID) // [bread added, original]
+	added, original := revs[0].ID, revs[1].ID
+
+	diff := func(query string) RevisionDiff {
+		t.Helper()
+		resp := c.do("GET", path+"/revisions/diff?"+query, nil)
+		wantStatus(t, resp, http.StatusOK)
+		var d RevisionDiff
+		decodeBody(t, resp, &d)
+		return d
+	}
+
+	d := diff(fmt.Sprintf("from=%d&to=%d", original, added))
+	if d.Added != 1 || d.Removed != 0 || !slices.Equal(d.Lines, []DiffLine{{"equal", "milk"}, {"added", "bread"}, {"equal", "eggs"}}) {
+		t.Fatalf("added line: %+v", d)
+	}
+	// to defaults to the current content.
+	d = diff(fmt.Sprintf("from=%d", added))
+	if d.To != "current" || d.Added != 0 || d.Removed != 1 || d.Lines[2] != (DiffLine{"removed", "eggs"}) {
+		t.Fatalf("removed line: %+v", d)
+	}
+	d = diff("from=current&to=current")
+	if d.Added != 0 || d.Removed != 0 || len(d.Lines) != 2 {
+		t.Fatalf("unchanged: %+v", d)
+	}
+
+	// A revision of another note, or another user's note, is not found.
+	other := c.createNote(map[string]string{"title": "other"})
+	wantStatus(t, c.do("PUT", fmt.Sprintf("/notes/%d", other.ID), map[string]string{"title": "other 2"}), http.StatusOK)
+	otherRev := listRevisions(t, c, other.ID)[0].ID
+	wantJSONError(t, c.do("GET", fmt.Sprintf("%s/revisions/diff?from=%d", path, otherRev), nil), http.StatusNotFound)
+	bob := c.newClient()
+	bob.login("bob")
+	wantJSONError(t, bob.do("GET", fmt.Sprintf("%s/revisions/diff?from=%d", path, original), nil), http.StatusNotFound)
+}
+
+func TestRevisionDiffValidation(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	for _, query := range []string{"", "to=current", "from=abc", "from=0", "from=current&to=-1"} {
+		wantStatus(t, c.do("GET", "/notes/1/revisions/diff?"+query, nil), http.StatusBadRequest)
+	}
+	wantStatus(t, c.do("POST", "/notes/1/revisions/diff?from=current", nil), http.StatusMethodNotAllowed)
+}
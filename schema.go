@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// schema lists the CREATE TABLE statements in dependency order. Each one is
+// idempotent, so initSchema is safe to run on every start. They're written
+// for MySQL; sqlDialect.ddl adapts them for other databases.
+var schema = []struct {
+	table string
+	ddl   string
+}{
+	{"users", `
+		CREATE TABLE IF NOT EXISTS users (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			username VARCHAR(255) NOT NULL UNIQUE,
+			password VARCHAR(255) NOT NULL,
+			is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+			last_login_at DATETIME(6) NULL
+		)
+	`},
+	{"login_attempts", `
+		CREATE TABLE IF NOT EXISTS login_attempts (
+			username VARCHAR(255) PRIMARY KEY,
+			failures INT NOT NULL,
+			locked_until DATETIME(6) NULL,
+			updated_at DATETIME(6) NOT NULL
+		)
+	`},
+	{"notebooks", `
+		CREATE TABLE IF NOT EXISTS notebooks (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`},
+	{"templates", `
+		CREATE TABLE IF NOT EXISTS templates (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			title TEXT NOT NULL,
+			content TEXT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`},
+	{"api_keys", `
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			key_hash CHAR(64) NOT NULL UNIQUE,
+			prefix VARCHAR(16) NOT NULL,
+			created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`},
+	{"webhooks", `
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			url VARCHAR(2048) NOT NULL,
+			secret CHAR(64) NOT NULL,
+			created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`},
+	{"webhook_deliveries", `
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			webhook_id INT NOT NULL,
+			event VARCHAR(32) NOT NULL,
+			success BOOLEAN NOT NULL,
+			status_code INT NULL,
+			error VARCHAR(255) NULL,
+			attempts INT NOT NULL,
+			created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+			FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+		)
+	`},
+	{"notes", `
+		CREATE TABLE IF NOT EXISTS notes (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			title TEXT NOT NULL,
+			content TEXT,
+			content_type VARCHAR(16) NOT NULL DEFAULT 'plain',
+			archived BOOLEAN NOT NULL DEFAULT FALSE,
+			done BOOLEAN NOT NULL DEFAULT FALSE,
+			pinned BOOLEAN NOT NULL DEFAULT FALSE,
+			starred BOOLEAN NOT NULL DEFAULT FALSE,
+			color VARCHAR(16) NOT NULL DEFAULT 'gray',
+			notebook_id INT NULL,
+			due_at DATETIME NULL,
+			position INT NOT NULL DEFAULT 0,
+			version INT NOT NULL DEFAULT 1,
+			view_count INT NOT NULL DEFAULT 0,
+			created_ip VARCHAR(45) NULL,
+			created_user_agent VARCHAR(255) NULL,
+			created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+			updated_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (notebook_id) REFERENCES notebooks(id) ON DELETE SET NULL
+		)
+	`},
+	{"idempotency_keys", `
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			user_id INT NOT NULL,
+			idem_key VARCHAR(255) NOT NULL,
+			note_id INT NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, idem_key),
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE
+		)
+	`},
+	{"shares", `
+		CREATE TABLE IF NOT EXISTS shares (
+			slug VARCHAR(64) PRIMARY KEY,
+			note_id INT NOT NULL UNIQUE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE
+		)
+	`},
+	{"attachments", `
+		CREATE TABLE IF NOT EXISTS attachments (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			note_id INT NOT NULL,
+			filename VARCHAR(255) NOT NULL,
+			stored_name VARCHAR(64) NOT NULL,
+			content_type VARCHAR(100) NOT NULL,
+			size BIGINT NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE
+		)
+	`},
+	{"note_revisions", `
+		CREATE TABLE IF NOT EXISTS note_revisions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			note_id INT NOT NULL,
+			title TEXT NOT NULL,
+			content TEXT,
+			edited_at DATETIME(6) NOT NULL,
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE
+		)
+	`},
+	{"note_shares", `
+		CREATE TABLE IF NOT EXISTS note_shares (
+			note_id INT NOT NULL,
+			shared_with_user_id INT NOT NULL,
+			permission VARCHAR(16) NOT NULL DEFAULT 'view',
+			created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+			PRIMARY KEY (note_id, shared_with_user_id),
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+			FOREIGN KEY (shared_with_user_id) REFERENCES users(id)
+		)
+	`},
+}
+
+// migrations bring tables created by older versions up to date. Each must be
+// safe to rerun.
+var migrations = []string{
+	`ALTER TABLE notes ADD COLUMN IF NOT EXISTS created_ip VARCHAR(45) NULL`,
+	`ALTER TABLE notes ADD COLUMN IF NOT EXISTS created_user_agent VARCHAR(255) NULL`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE notes ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+	`ALTER TABLE notes ADD COLUMN IF NOT EXISTS content_type VARCHAR(16) NOT NULL DEFAULT 'plain'`,
+	`ALTER TABLE notes ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE notes ADD COLUMN IF NOT EXISTS view_count INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE notes ADD COLUMN IF NOT EXISTS starred BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS last_login_at DATETIME(6) NULL`,
+}
+
+// noteTables are dropped and recreated when initSchema is asked to reset,
+// for development databases that want a fresh notes schema. Tables
+// referencing notes come first so their foreign keys don't block the drop.
+var noteTables = []string{"idempotency_keys", "shares", "attachments", "note_revisions", "note_shares", "notes"}
+
+// initSchema creates anything missing. With reset, the notes tables and
+// all their data are dropped first.
+func initSchema(reset bool) error {
+	if reset {
+		slog.Warn("DB_RESET is set, dropping all notes and their attachments, shares, collaborators and revisions")
+		for _, table := range noteTables {
+			if _, err := db.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+				slog.Error("drop table", "table", table, "err", err)
+			}
+		}
+	}
+	for _, s := range schema {
+		if _, err := db.Exec(sqlDialect.ddl(s.ddl)); err != nil {
+			return fmt.Errorf("create %s table: %w", s.table, err)
+		}
+	}
+	for _, m := range migrations {
+		if _, err := db.Exec(sqlDialect.ddl(m)); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestDBResetOffByDefault(t *testing.T) {
+	t.Setenv("DB_RESET", "")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DBReset {
+		t.Fatal("DBReset is on without DB_RESET")
+	}
+	t.Setenv("DB_RESET", "true")
+	if cfg, err = LoadConfig(); err != nil || !cfg.DBReset {
+		t.Fatalf("DB_RESET=true: DBReset %v, err %v", cfg.DBReset, err)
+	}
+}
+
+func TestInitSchemaReset(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	c.createNote(map[string]string{"title": "keep me"})
+
+	countNotes := func() int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM notes`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if err := initSchema(false); err != nil {
+		t.Fatal(err)
+	}
+	if n := countNotes(); n != 1 {
+		t.Fatalf("after a plain start: %d notes, want 1", n)
+	}
+
+	if err := initSchema(true); err != nil {
+		t.Fatal(err)
+	}
+	if n := countNotes(); n != 0 {
+		t.Fatalf("after a reset: %d notes, want 0", n)
+	}
+	// Only the notes tables are reset; accounts survive.
+	var users int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 {
+		t.Fatalf("after a reset: %d users, want 1", users)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxSearchLen caps the search term.
+	maxSearchLen = 255
+
+	// snippetRadius is how many characters of context a snippet keeps on
+	// each side of the match.
+	snippetRadius = 40
+
+	// titleWeight and contentWeight are what a match in each field is worth
+	// before the position bonus. The gap is wide enough that any title
+	// match outranks any content-only match.
+	titleWeight   = 3.0
+	contentWeight = 1.0
+)
+
+// searchFields maps ?fields= to the condition it searches with.
+var searchFields = map[string]string{
+	"all":     "(LOWER(title) LIKE ? OR LOWER(content) LIKE ?)",
+	"title":   "LOWER(title) LIKE ?",
+	"content": "LOWER(content) LIKE ?",
+}
+
+// SearchResult is a matching note plus a highlighted excerpt and its
+// relevance. The note's fields are emitted unchanged, with snippet and score
+// added alongside them.
+type SearchResult struct {
+	Note
+	// Snippet is HTML: escaped text around the first match, with the match
+	// wrapped in <mark>.
+	Snippet string
+	// Score is the note's relevance to the query; see relevance.
+	Score float64
+}
+
+func (sr SearchResult) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(sr.Note)
+	if err != nil {
+		return nil, err
+	}
+	snippet, err := json.Marshal(sr.Snippet)
+	if err != nil {
+		return nil, err
+	}
+	// Splice snippet and score into the note's object rather than
+	// re-declaring its fields, so the two can't drift apart.
+	b = append(b[:len(b)-1], `,"snippet":`...)
+	b = append(b, snippet...)
+	b = append(b, `,"score":`...)
+	b = strconv.AppendFloat(b, math.Round(sr.Score*1000)/1000, 'f', -1, 64)
+	return append(b, '}'), nil
+}
+
+// searchNotesHandler finds the user's notes whose title or content contains
+// ?q=, case-insensitively, most relevant first. ?fields=title or
+// ?fields=content narrows the search to that one; the default, all, searches
+// both. Archived notes are left out unless ?archived=true asks for them
+// instead, as with the notes list.
+func searchNotesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(q) > maxSearchLen {
+		http.Error(w, "q is too long", http.StatusBadRequest)
+		return
+	}
+
+	fields := r.URL.Query().Get("fields")
+	if fields == "" {
+		fields = "all"
+	}
+	cond, ok := searchFields[fields]
+	if !ok {
+		http.Error(w, "fields must be all, title or content", http.StatusBadRequest)
+		return
+	}
+
+	archived := false
+	if v := r.URL.Query().Get("archived"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid archived filter", http.StatusBadRequest)
+			return
+		}
+		archived = b
+	}
+
+	pattern := containsPattern(q)
+	args := []interface{}{userID, archived, pattern}
+	if fields == "all" {
+		args = append(args, pattern)
+	}
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT `+noteColumns+` FROM notes
+		WHERE user_id = ? AND archived = ? AND `+cond+`
+		ORDER BY position, id DESC`,
+		args...,
+	)
+	if err != nil {
+		requestLog(r).Error("searchNotes query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			requestLog(r).Error("searchNotes scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		var snippet string
+		switch fields {
+		case "title":
+			snippet, _ = highlight(n.Title, q)
+		case "content":
+			snippet, _ = highlight(n.Content, q)
+		default:
+			var ok bool
+			if snippet, ok = highlight(n.Content, q); !ok {
+				snippet, _ = highlight(n.Title, q)
+			}
+		}
+		results = append(results, SearchResult{Note: n, Snippet: snippet, Score: relevance(n, q, fields)})
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(r).Error("searchNotes rows", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	// Rows arrive in position order, which breaks ties between equal scores.
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// relevance scores how well n matches term within the searched fields. Each
+// field that contains term adds its weight plus a bonus of up to 1 that
+// shrinks the further in the first occurrence is, so earlier matches rank
+// higher.
+func relevance(n Note, term, fields string) float64 {
+	needle := []rune(term)
+	field := func(text string, weight float64) float64 {
+		at := indexFold([]rune(text), needle)
+		if at < 0 {
+			return 0
+		}
+		return weight + 1/float64(1+at)
+	}
+	var score float64
+	if fields != "content" {
+		score += field(n.Title, titleWeight)
+	}
+	if fields != "title" {
+		score += field(n.Content, contentWeight)
+	}
+	return score
+}
+
+// likeEscaper escapes LIKE wildcards so the search term matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern is a LIKE pattern matching lowercased text that contains
+// term.
+func containsPattern(term string) string {
+	return "%" + likeEscaper.Replace(strings.ToLower(term)) + "%"
+}
+
+// highlight returns text around the first case-insensitive occurrence of
+// term, HTML-escaped, with the occurrence wrapped in <mark> and "…" marking
+// where the text was cut. Without a match it returns the escaped start of
+// text and false.
+func highlight(text, term string) (string, bool) {
+	runes := []rune(text)
+	needle := []rune(term)
+	at := indexFold(runes, needle)
+	if at < 0 {
+		if len(runes) > 2*snippetRadius {
+			return html.EscapeString(string(runes[:2*snippetRadius])) + "…", false
+		}
+		return html.EscapeString(text), false
+	}
+
+	start := max(at-snippetRadius, 0)
+	end := min(at+len(needle)+snippetRadius, len(runes))
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	b.WriteString(html.EscapeString(string(runes[start:at])))
+	b.WriteString("<mark>")
+	b.WriteString(html.EscapeString(string(runes[at : at+len(needle)])))
+	b.WriteString("</mark>")
+	b.WriteString(html.EscapeString(string(runes[at+len(needle) : end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// indexFold is the rune index of the first case-insensitive occurrence of
+// needle in s, or -1.
+func indexFold(s, needle []rune) int {
+	if len(needle) == 0 {
+		return -1
+	}
+outer:
+	for i := 0; i+len(needle) <= len(s); i++ {
+		for j, c := range needle {
+			if unicode.ToLower(s[i+j]) != unicode.ToLower(c) {
+				continue outer
+			}
+		}
+		return i
+	}
+	return -1
+}
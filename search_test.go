@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	for _, tc := range []struct {
+		name, text, term, want string
+		ok                     bool
+	}{
+		{"whole text", "buy milk today", "milk", "buy <mark>milk</mark> today", true},
+		{"keeps the text's case", "Buy MILK", "milk", "Buy <mark>MILK</mark>", true},
+		{"escapes around the match", `<b>"x"</b> & milk <i>`, "milk", `&lt;b&gt;&#34;x&#34;&lt;/b&gt; &amp; <mark>milk</mark> &lt;i&gt;`, true},
+		{"escapes the match", "a <tag> b", "<tag>", "a <mark>&lt;tag&gt;</mark> b", true},
+		{"window", long + "milk" + long, "milk",
+			"…" + strings.Repeat("a", snippetRadius) + "<mark>milk</mark>" + strings.Repeat("a", snippetRadius) + "…", true},
+		{"multibyte window", strings.Repeat("é", 50) + "x", "x", "…" + strings.Repeat("é", snippetRadius) + "<mark>x</mark>", true},
+		{"no match", "short & sweet", "milk", "short &amp; sweet", false},
+		{"no match, long", long, "milk", strings.Repeat("a", 2*snippetRadius) + "…", false},
+	} {
+		got, ok := highlight(tc.text, tc.term)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%s: highlight = %q, %v; want %q, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestIndexFold(t *testing.T) {
+	for _, tc := range []struct {
+		s, needle string
+		want      int
+	}{
+		{"Hello", "hello", 0},
+		{"say HELLO", "Hello", 4},
+		{"ÄPFEL und äpfel", "äpfel", 0},
+		{"日本語", "語", 2},
+		{"abc", "abcd", -1},
+		{"abc", "", -1},
+	} {
+		if got := indexFold([]rune(tc.s), []rune(tc.needle)); got != tc.want {
+			t.Errorf("indexFold(%q, %q) = %d, want %d", tc.s, tc.needle, got, tc.want)
+		}
+	}
+}
+
+func TestSearchResultJSON(t *testing.T) {
+	b, err := json.Marshal(SearchResult{Note: Note{ID: 4, Title: "milk"}, Snippet: "<mark>milk</mark>", Score: 1.23456})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	if got["id"] != 4.0 || got["title"] != "milk" || got["snippet"] != "<mark>milk</mark>" || got["score"] != 1.235 {
+		t.Fatalf("result = %s", b)
+	}
+}
+
+func TestRelevance(t *testing.T) {
+	title := Note{Title: "Milk run", Content: "nothing here"}
+	content := Note{Title: "errands", Content: "milk"}
+	late := Note{Title: "the shopping list for milk", Content: "nothing here"}
+	both := Note{Title: "milk", Content: "milk"}
+
+	for _, tc := range []struct {
+		name          string
+		higher, lower Note
+	}{
+		{"title beats content", title, content},
+		{"a late title match still beats content", late, content},
+		{"earlier beats later", title, late},
+		{"both fields beat one", both, title},
+	} {
+		if hi, lo := relevance(tc.higher, "MILK", "all"), relevance(tc.lower, "MILK", "all"); hi <= lo {
+			t.Errorf("%s: %v <= %v", tc.name, hi, lo)
+		}
+	}
+
+	if got := relevance(title, "milk", "all"); got != titleWeight+1 {
+		t.Errorf("match at 0 in the title = %v, want %v", got, titleWeight+1)
+	}
+	if got := relevance(Note{Title: "x"}, "milk", "all"); got != 0 {
+		t.Errorf("no match = %v, want 0", got)
+	}
+	// Only the searched fields count.
+	if got := relevance(both, "milk", "content"); got != contentWeight+1 {
+		t.Errorf("content only = %v, want %v", got, contentWeight+1)
+	}
+	if got := relevance(both, "milk", "title"); got != titleWeight+1 {
+		t.Errorf("title only = %v, want %v", got, titleWeight+1)
+	}
+}
+
+// search runs GET /notes/search?query and returns the results.
+func search(t *testing.T, c *testClient, query string) []SearchResult {
+	t.Helper()
+	resp := c.do("GET", "/notes/search?"+query, nil)
+	wantStatus(t, resp, http.StatusOK)
+	var results []struct {
+		Note
+		Snippet string  `json:"snippet"`
+		Score   float64 `json:"score"`
+	}
+	decodeBody(t, resp, &results)
+	out := make([]SearchResult, len(results))
+	for i, r := range results {
+		out[i] = SearchResult{r.Note, r.Snippet, r.Score}
+	}
+	return out
+}
+
+func TestSearchNotes(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	active := c.createNote(map[string]string{"title": "shopping", "content": "buy <b>milk</b>"})
+	old := c.createNote(map[string]string{"title": "old list", "content": "milk, eggs"})
+	wantStatus(t, c.do("PATCH", fmt.Sprintf("/notes/%d/archive", old.ID), nil), http.StatusOK)
+	other := c.newClient()
+	other.login("bob")
+	other.createNote(map[string]string{"title": "bob's milk"})
+
+	results := search(t, c, "q=MILK")
+	if len(results) != 1 || results[0].ID != active.ID {
+		t.Fatalf("results = %+v, want just the active note", results)
+	}
+	if results[0].Content != "buy <b>milk</b>" || results[0].Snippet != "buy &lt;b&gt;<mark>milk</mark>&lt;/b&gt;" {
+		t.Errorf("result = %+v", results[0])
+	}
+
+	results = search(t, c, "q=milk&archived=true")
+	if len(results) != 1 || results[0].ID != old.ID {
+		t.Fatalf("archived results = %+v, want just the archived note", results)
+	}
+
+	for _, q := range []string{"", "q=", "q=milk&archived=maybe", "q=" + strings.Repeat("m", maxSearchLen+1)} {
+		wantStatus(t, c.do("GET", "/notes/search?"+q, nil), http.StatusBadRequest)
+	}
+}
+
+func TestSearchFields(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	titled := c.createNote(map[string]string{"title": "Garden plan", "content": "tomatoes"})
+	body := c.createNote(map[string]string{"title": "weekend", "content": "water the garden"})
+
+	for query, want := range map[string][]int{
+		"q=garden":                 {titled.ID, body.ID},
+		"q=garden&fields=all":      {titled.ID, body.ID},
+		"q=garden&fields=title":    {titled.ID},
+		"q=garden&fields=content":  {body.ID},
+		"q=tomatoes&fields=title":  nil,
+		"q=weekend&fields=content": nil,
+	} {
+		var got []int
+		for _, r := range search(t, c, query) {
+			got = append(got, r.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: ids %v, want %v", query, got, want)
+		}
+	}
+
+	// The snippet comes from the field that was searched.
+	if r := search(t, c, "q=garden&fields=title"); len(r) != 1 || r[0].Snippet != "<mark>Garden</mark> plan" {
+		t.Errorf("title-only result = %+v", r)
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	// Created content-first, so position order alone would list it first.
+	body := c.createNote(map[string]string{"title": "errands", "content": "pick up the bike"})
+	late := c.createNote(map[string]string{"title": "fix the bike", "content": "chain"})
+	early := c.createNote(map[string]string{"title": "Bike repairs", "content": "tyres"})
+
+	results := search(t, c, "q=bike")
+	if got := noteIDs(resultNotes(results)); !slices.Equal(got, []int{early.ID, late.ID, body.ID}) {
+		t.Fatalf("order = %v, want %v", got, []int{early.ID, late.ID, body.ID})
+	}
+	if !(results[0].Score > results[1].Score && results[1].Score > results[2].Score) {
+		t.Errorf("scores not descending: %v, %v, %v", results[0].Score, results[1].Score, results[2].Score)
+	}
+}
+
+// resultNotes strips the search extras from results.
+func resultNotes(results []SearchResult) []Note {
+	notes := make([]Note, len(results))
+	for i, r := range results {
+		notes[i] = r.Note
+	}
+	return notes
+}
+
+func TestSearchFieldsValidated(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	for _, v := range []string{"body", "Title", "title,content"} {
+		resp := c.do("GET", "/notes/search?q=x&fields="+v, nil)
+		wantStatus(t, resp, http.StatusBadRequest)
+		if body := readBody(t, resp); !strings.Contains(body, "fields must be all, title or content") {
+			t.Errorf("fields=%s: body %q", v, body)
+		}
+	}
+}
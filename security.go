@@ -0,0 +1,22 @@
+package main
+
+import "net/http"
+
+// contentSecurityPolicy is sent with every response (CONTENT_SECURITY_POLICY
+// overrides it). The default fits the bundled frontend, whose script is
+// inline; an SPA served from elsewhere will want its own.
+var contentSecurityPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'"
+
+// securityHeadersMiddleware sets browser hardening headers on all responses.
+// Handlers may still replace them, e.g. with a stricter policy.
+func securityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		if contentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", contentSecurityPolicy)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	old := contentSecurityPolicy
+	t.Cleanup(func() { contentSecurityPolicy = old })
+
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	// Errors and unauthenticated responses get them too.
+	for _, path := range []string{"/openapi.json", "/notes", "/no-such-page"} {
+		resp := c.do("GET", path, nil)
+		resp.Body.Close()
+		for name, want := range map[string]string{
+			"X-Content-Type-Options":  "nosniff",
+			"X-Frame-Options":         "DENY",
+			"Content-Security-Policy": contentSecurityPolicy,
+		} {
+			if got := resp.Header.Get(name); got != want {
+				t.Errorf("GET %s: %s = %q, want %q", path, name, got, want)
+			}
+		}
+	}
+
+	// An empty policy turns the header off; the others stay.
+	contentSecurityPolicy = ""
+	w := httptest.NewRecorder()
+	securityHeadersMiddleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if _, ok := w.Header()["Content-Security-Policy"]; ok {
+		t.Error("Content-Security-Policy sent with an empty policy")
+	}
+	if w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Error("X-Frame-Options missing")
+	}
+}
+
+func TestContentSecurityPolicyConfig(t *testing.T) {
+	t.Setenv("CONTENT_SECURITY_POLICY", "") // restored after the test
+	os.Unsetenv("CONTENT_SECURITY_POLICY")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ContentSecurityPolicy != contentSecurityPolicy {
+		t.Errorf("default policy = %q, want %q", cfg.ContentSecurityPolicy, contentSecurityPolicy)
+	}
+	for _, v := range []string{"default-src https://app.example.com", ""} {
+		t.Setenv("CONTENT_SECURITY_POLICY", v)
+		if cfg, err = LoadConfig(); err != nil || cfg.ContentSecurityPolicy != v {
+			t.Errorf("CONTENT_SECURITY_POLICY=%q: got %q, err %v", v, cfg.ContentSecurityPolicy, err)
+		}
+	}
+}
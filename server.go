@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// httpTimeouts bounds how long a client can hold a connection at each stage
+// of a request. Without them a slow or malicious client (slowloris) can
+// keep connections open indefinitely by trickling bytes. A zero value
+// disables that timeout, as in net/http.
+type httpTimeouts struct {
+	// ReadHeader caps receiving the request line and headers. It's the
+	// main slowloris defence and can be short, since no legitimate client
+	// needs long to send headers. (HTTP_READ_HEADER_TIMEOUT)
+	ReadHeader time.Duration
+	// Read caps receiving the whole request, body included. It has to
+	// cover the largest attachment upload over the slowest link you want
+	// to support, so lowering it trades slow uploaders for protection
+	// against slow bodies. (HTTP_READ_TIMEOUT)
+	Read time.Duration
+	// Write caps producing and sending the response, measured from the end
+	// of the request headers. Too short and large responses are cut off
+	// mid-body; exports extend it as they make progress.
+	// (HTTP_WRITE_TIMEOUT)
+	Write time.Duration
+	// Idle caps how long a keep-alive connection waits for its next
+	// request. Longer saves reconnects for busy clients at the cost of
+	// holding idle sockets open. (HTTP_IDLE_TIMEOUT)
+	Idle time.Duration
+}
+
+// serverTimeouts are the timeouts applied by newServer.
+var serverTimeouts = httpTimeouts{
+	ReadHeader: 10 * time.Second,
+	Read:       30 * time.Second,
+	Write:      60 * time.Second,
+	Idle:       120 * time.Second,
+}
+
+// newServer builds the HTTP server with serverTimeouts applied.
+func newServer(addr string, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: serverTimeouts.ReadHeader,
+		ReadTimeout:       serverTimeouts.Read,
+		WriteTimeout:      serverTimeouts.Write,
+		IdleTimeout:       serverTimeouts.Idle,
+	}
+}
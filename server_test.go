@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewServerTimeouts(t *testing.T) {
+	old := serverTimeouts
+	t.Cleanup(func() { serverTimeouts = old })
+
+	srv := newServer(":8080", http.NotFoundHandler())
+	if srv.ReadHeaderTimeout == 0 || srv.ReadTimeout == 0 || srv.WriteTimeout == 0 || srv.IdleTimeout == 0 {
+		t.Fatalf("default server leaves a timeout off: %+v", serverTimeouts)
+	}
+
+	t.Setenv("HTTP_READ_HEADER_TIMEOUT", "2s")
+	t.Setenv("HTTP_READ_TIMEOUT", "3s")
+	t.Setenv("HTTP_WRITE_TIMEOUT", "0")
+	t.Setenv("HTTP_IDLE_TIMEOUT", "5m")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTimeouts = cfg.Timeouts
+	srv = newServer(cfg.Addr, http.NotFoundHandler())
+	if srv.ReadHeaderTimeout != 2*time.Second || srv.ReadTimeout != 3*time.Second || srv.WriteTimeout != 0 || srv.IdleTimeout != 5*time.Minute {
+		t.Fatalf("server timeouts = %v %v %v %v", srv.ReadHeaderTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+
+	t.Setenv("HTTP_READ_TIMEOUT", "soon")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("HTTP_READ_TIMEOUT=soon was accepted")
+	}
+	t.Setenv("HTTP_READ_TIMEOUT", "-1s")
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("a negative timeout was accepted")
+	}
+}
+
+// TestReadHeaderTimeout checks a client trickling its headers gets cut off.
+func TestReadHeaderTimeout(t *testing.T) {
+	old := serverTimeouts
+	t.Cleanup(func() { serverTimeouts = old })
+	serverTimeouts = httpTimeouts{ReadHeader: 100 * time.Millisecond}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(ln.Addr().String(), http.NotFoundHandler())
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	io.Copy(io.Discard, conn)
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("connection held for %v with headers unfinished", d)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errTooManySessions is returned by Create in reject mode when the user
+// already has as many sessions as allowed.
+var errTooManySessions = errors.New("too many active sessions")
+
+type session struct {
+	userID    int
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// SessionStore maps session tokens to users in memory. Sessions don't
+// survive a restart. Expired entries are rejected by Get and removed by a
+// background sweep until Stop is called.
+//
+// With maxPerUser set, a user at the cap who logs in again either loses
+// their oldest session or, with rejectOverCap, is refused.
+type SessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]session
+
+	maxPerUser    int
+	rejectOverCap bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newSessionStore returns a store that sweeps expired sessions every
+// interval and allows maxPerUser live sessions per user (0 for no cap).
+func newSessionStore(interval time.Duration, maxPerUser int, rejectOverCap bool) *SessionStore {
+	s := &SessionStore{
+		sessions:      make(map[string]session),
+		maxPerUser:    maxPerUser,
+		rejectOverCap: rejectOverCap,
+		stop:          make(chan struct{}),
+	}
+	go s.sweepLoop(interval)
+	return s
+}
+
+// Create starts a session for userID lasting ttl and returns its token.
+// At the per-user cap it evicts the user's oldest sessions to make room,
+// or returns errTooManySessions in reject mode.
+func (s *SessionStore) Create(userID int, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxPerUser > 0 {
+		if err := s.makeRoom(userID, now); err != nil {
+			return "", err
+		}
+	}
+	s.sessions[token] = session{userID: userID, createdAt: now, expiresAt: now.Add(ttl)}
+	return token, nil
+}
+
+// makeRoom brings userID below maxPerUser live sessions. Expired sessions
+// don't count and are dropped on the way. Callers hold s.mu.
+func (s *SessionStore) makeRoom(userID int, now time.Time) error {
+	var live []string
+	for token, sess := range s.sessions {
+		if sess.userID != userID {
+			continue
+		}
+		if !now.Before(sess.expiresAt) {
+			delete(s.sessions, token)
+			continue
+		}
+		live = append(live, token)
+	}
+	if len(live) < s.maxPerUser {
+		return nil
+	}
+	if s.rejectOverCap {
+		return errTooManySessions
+	}
+	sort.Slice(live, func(i, j int) bool {
+		return s.sessions[live[i]].createdAt.Before(s.sessions[live[j]].createdAt)
+	})
+	for _, token := range live[:len(live)-s.maxPerUser+1] {
+		delete(s.sessions, token)
+	}
+	return nil
+}
+
+// Get returns the user a live session belongs to.
+func (s *SessionStore) Get(token string) (int, bool) {
+	s.mu.RLock()
+	sess, ok := s.sessions[token]
+	s.mu.RUnlock()
+	if !ok || !time.Now().Before(sess.expiresAt) {
+		return 0, false
+	}
+	return sess.userID, true
+}
+
+// Delete ends a session. Unknown tokens are ignored.
+func (s *SessionStore) Delete(token string) {
+	s.mu.Lock()
+	delete(s.sessions, token)
+	s.mu.Unlock()
+}
+
+// DeleteUser ends every session belonging to userID.
+func (s *SessionStore) DeleteUser(userID int) {
+	s.mu.Lock()
+	for token, sess := range s.sessions {
+		if sess.userID == userID {
+			delete(s.sessions, token)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// Stop ends the background sweep. It is safe to call more than once.
+func (s *SessionStore) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *SessionStore) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.sweep(now)
+		}
+	}
+}
+
+func (s *SessionStore) sweep(now time.Time) {
+	s.mu.Lock()
+	for token, sess := range s.sessions {
+		if !now.Before(sess.expiresAt) {
+			delete(s.sessions, token)
+		}
+	}
+	s.mu.Unlock()
+}
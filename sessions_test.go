@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionStoreExpiry(t *testing.T) {
+	s := newSessionStore(time.Hour, 0, false)
+	defer s.Stop()
+
+	live, err := s.Create(1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, err := s.Create(2, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := s.Get(live); !ok || id != 1 {
+		t.Fatalf("Get(live) = %d, %v", id, ok)
+	}
+	// Expired sessions are refused even before a sweep removes them.
+	if _, ok := s.Get(dead); ok {
+		t.Fatal("expired session still valid")
+	}
+
+	s.sweep(time.Now())
+	s.mu.RLock()
+	_, stillThere := s.sessions[dead]
+	n := len(s.sessions)
+	s.mu.RUnlock()
+	if stillThere || n != 1 {
+		t.Fatalf("after sweep: %d sessions, expired one kept: %v", n, stillThere)
+	}
+
+	s.Delete(live)
+	if _, ok := s.Get(live); ok {
+		t.Fatal("deleted session still valid")
+	}
+	s.Stop() // a second Stop is harmless
+}
+
+func TestSessionStoreSweepLoop(t *testing.T) {
+	s := newSessionStore(10*time.Millisecond, 0, false)
+	defer s.Stop()
+	if _, err := s.Create(1, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.RLock()
+		n := len(s.sessions)
+		s.mu.RUnlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background sweep never removed the expired session")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestSessionStoreConcurrent is mostly for go test -race.
+func TestSessionStoreConcurrent(t *testing.T) {
+	s := newSessionStore(time.Millisecond, 0, false)
+	defer s.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				token, err := s.Create(i, time.Duration(j%3)*time.Millisecond)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				s.Get(token)
+				if j%2 == 0 {
+					s.Delete(token)
+				}
+				if j%50 == 0 {
+					s.DeleteUser(i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSessionStoreEvictsOldest(t *testing.T) {
+	s := newSessionStore(time.Hour, 2, false)
+	defer s.Stop()
+
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		token, err := s.Create(1, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+		time.Sleep(time.Millisecond) // distinct createdAt
+	}
+	other, err := s.Create(2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := s.Get(tokens[0]); ok {
+		t.Fatal("oldest session survived a login over the cap")
+	}
+	for _, token := range append(tokens[1:], other) {
+		if _, ok := s.Get(token); !ok {
+			t.Fatal("a newer session, or another user's, was evicted")
+		}
+	}
+}
+
+func TestSessionStoreRejectOverCap(t *testing.T) {
+	s := newSessionStore(time.Hour, 2, true)
+	defer s.Stop()
+
+	first, _ := s.Create(1, time.Hour)
+	if _, err := s.Create(1, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// The expired session doesn't count, so this one fits.
+	second, err := s.Create(1, time.Hour)
+	if err != nil {
+		t.Fatalf("Create with one live session: %v", err)
+	}
+	if _, err := s.Create(1, time.Hour); !errors.Is(err, errTooManySessions) {
+		t.Fatalf("Create at the cap: err = %v, want errTooManySessions", err)
+	}
+	for _, token := range []string{first, second} {
+		if _, ok := s.Get(token); !ok {
+			t.Fatal("reject mode ended an existing session")
+		}
+	}
+	if _, err := s.Create(2, time.Hour); err != nil {
+		t.Fatalf("another user at no sessions: %v", err)
+	}
+
+	s.Delete(first)
+	if _, err := s.Create(1, time.Hour); err != nil {
+		t.Fatalf("Create after logging out elsewhere: %v", err)
+	}
+}
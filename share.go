@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// SharedNote is the read-only view of a note served to anonymous visitors.
+type SharedNote struct {
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	ContentType string    `json:"content_type"`
+	Color       string    `json:"color"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// MarshalJSON emits UpdatedAt in UTC, like Note.
+func (s SharedNote) MarshalJSON() ([]byte, error) {
+	type plain SharedNote
+	p := plain(s)
+	p.UpdatedAt = p.UpdatedAt.UTC()
+	return json.Marshal(p)
+}
+
+// newShareSlug returns an unguessable URL-safe token.
+func newShareSlug() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// noteShareHandler serves POST (create or return the existing link) and
+// DELETE (revoke) on /notes/{id}/share.
+func noteShareHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		if _, err := fetchNote(r.Context(), userID, id); errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, msgNoteNotFoundOrForbidden)
+			return
+		} else if err != nil {
+			requestLog(r).Error("shareNote fetch", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+
+		status := http.StatusOK
+		var slug string
+		err := db.QueryRowContext(r.Context(), `SELECT slug FROM shares WHERE note_id = ?`, id).Scan(&slug)
+		if errors.Is(err, sql.ErrNoRows) {
+			slug, err = newShareSlug()
+			if err == nil {
+				_, err = db.ExecContext(r.Context(), `INSERT INTO shares (slug, note_id) VALUES (?, ?)`, slug, id)
+			}
+			status = http.StatusCreated
+			w.Header().Set("Location", "/shared/"+slug)
+		}
+		if err != nil {
+			requestLog(r).Error("shareNote", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"slug": slug,
+			"url":  basePath + "/shared/" + slug,
+		})
+
+	case http.MethodDelete:
+		res, err := db.ExecContext(r.Context(),
+			`DELETE FROM shares WHERE note_id = (SELECT id FROM notes WHERE id = ? AND user_id = ?)`,
+			id, userID,
+		)
+		if err != nil {
+			requestLog(r).Error("unshareNote delete", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		aff, _ := res.RowsAffected()
+		if aff == 0 {
+			writeJSONError(w, http.StatusNotFound, msgShareNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// sharedNoteHandler serves GET /shared/{slug} without authentication. Each
+// fetch adds one to the note's view_count, which only the owner sees.
+func sharedNoteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	slug := r.PathValue("slug")
+
+	var noteID int
+	var n SharedNote
+	err := db.QueryRowContext(r.Context(),
+		`SELECT n.id, n.title, n.content, n.content_type, n.color, n.updated_at FROM shares s JOIN notes n ON n.id = s.note_id WHERE s.slug = ?`,
+		slug,
+	).Scan(&noteID, &n.Title, &n.Content, &n.ContentType, &n.Color, &n.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgNotFound)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("sharedNote query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	// Incremented in place so concurrent views all count. It leaves version
+	// and updated_at alone, as a view isn't an edit. A failure only costs a
+	// view, so the visitor still gets the note.
+	if _, err := db.ExecContext(r.Context(), `UPDATE notes SET view_count = view_count + 1 WHERE id = ?`, noteID); err != nil {
+		requestLog(r).Error("sharedNote count view", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n)
+}
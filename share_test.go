@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// shareNote makes a public link for the note and returns its slug.
+func shareNote(t *testing.T, c *testClient, noteID int) string {
+	t.Helper()
+	resp := c.do("POST", fmt.Sprintf("/notes/%d/share", noteID), nil)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		t.Fatalf("share note %d: %d %s", noteID, resp.StatusCode, readBody(t, resp))
+	}
+	var share struct{ Slug string }
+	decodeBody(t, resp, &share)
+	return share.Slug
+}
+
+func TestShareNote(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "recipe", "content": "flour"})
+	sharePath := fmt.Sprintf("/notes/%d/share", note.ID)
+
+	resp := c.do("POST", sharePath, nil)
+	wantStatus(t, resp, http.StatusCreated)
+	var share struct{ Slug, URL string }
+	decodeBody(t, resp, &share)
+	if share.Slug == "" || share.URL != "/shared/"+share.Slug || resp.Header.Get("Location") != share.URL {
+		t.Fatalf("share = %+v, Location %q", share, resp.Header.Get("Location"))
+	}
+	// Sharing again hands back the same link.
+	if again := shareNote(t, c, note.ID); again != share.Slug {
+		t.Fatalf("second share slug %q, want %q", again, share.Slug)
+	}
+
+	// Anyone with the link can read it, without logging in.
+	anon := c.newClient()
+	resp = anon.do("GET", share.URL, nil)
+	wantStatus(t, resp, http.StatusOK)
+	var shared SharedNote
+	decodeBody(t, resp, &shared)
+	if shared.Title != "recipe" || shared.Content != "flour" {
+		t.Fatalf("shared note = %+v", shared)
+	}
+	wantStatus(t, anon.do("PUT", share.URL, map[string]string{"title": "x"}), http.StatusMethodNotAllowed)
+	wantStatus(t, anon.do("GET", "/shared/nope", nil), http.StatusNotFound)
+
+	// Only the owner can share or unshare.
+	bob := c.newClient()
+	bob.login("bob")
+	wantStatus(t, bob.do("POST", sharePath, nil), http.StatusNotFound)
+	wantStatus(t, bob.do("DELETE", sharePath, nil), http.StatusNotFound)
+
+	wantStatus(t, c.do("DELETE", sharePath, nil), http.StatusNoContent)
+	wantStatus(t, anon.do("GET", share.URL, nil), http.StatusNotFound)
+	wantStatus(t, c.do("DELETE", sharePath, nil), http.StatusNotFound)
+}
+
+func TestSharedViewCount(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	note := c.createNote(map[string]string{"title": "recipe"})
+	slug := shareNote(t, c, note.ID)
+	notePath := fmt.Sprintf("/notes/%d", note.ID)
+
+	get := func() Note {
+		t.Helper()
+		resp := c.do("GET", notePath, nil)
+		wantStatus(t, resp, http.StatusOK)
+		var n Note
+		decodeBody(t, resp, &n)
+		return n
+	}
+	before := get()
+	if before.ViewCount != 0 {
+		t.Fatalf("view_count = %d before any views", before.ViewCount)
+	}
+
+	anon := c.newClient()
+	for range 3 {
+		resp := anon.do("GET", "/shared/"+slug, nil)
+		wantStatus(t, resp, http.StatusOK)
+		if body := readBody(t, resp); strings.Contains(body, "view_count") {
+			t.Fatalf("shared view exposes the count: %s", body)
+		}
+	}
+	// One per fetch; the owner's own reads don't count, and a view isn't
+	// an edit.
+	n := get()
+	if n.ViewCount != 3 {
+		t.Fatalf("view_count = %d after 3 shared fetches, want 3", n.ViewCount)
+	}
+	if n.Version != before.Version || !n.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("views changed version %d→%d or updated_at", before.Version, n.Version)
+	}
+
+	// Misses and refused methods count nothing.
+	wantStatus(t, anon.do("GET", "/shared/nope", nil), http.StatusNotFound)
+	wantStatus(t, anon.do("POST", "/shared/"+slug, nil), http.StatusMethodNotAllowed)
+	if n := get(); n.ViewCount != 3 {
+		t.Fatalf("view_count = %d, want still 3", n.ViewCount)
+	}
+
+	// Concurrent views are all counted.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(c.srv.URL + "/shared/" + slug)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if n := get(); n.ViewCount != 13 {
+		t.Fatalf("view_count = %d after 10 concurrent views, want 13", n.ViewCount)
+	}
+}
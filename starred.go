@@ -0,0 +1,47 @@
+package main
+
+import "net/http"
+
+// starredNotesHandler lists the user's unarchived starred notes, newest
+// first. Starring is a bookmark and has nothing to do with pinning: it
+// doesn't move a note in GET /notes, and the cap on pinned notes doesn't
+// apply. Notes are starred and unstarred with PATCH /notes/{id}/star.
+func starredNotesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT `+noteColumns+` FROM notes
+		WHERE user_id = ? AND archived = FALSE AND starred = TRUE
+		ORDER BY id DESC`,
+		userID,
+	)
+	if err != nil {
+		requestLog(r).Error("starredNotes query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	notes := []Note{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			requestLog(r).Error("starredNotes scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(r).Error("starredNotes rows", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encodeJSON(w, r, notes)
+}
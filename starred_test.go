@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestStarredNotes(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	var ids []int
+	for i := range 4 {
+		ids = append(ids, c.createNote(map[string]string{"title": fmt.Sprint("note ", i)}).ID)
+	}
+	star := func(c *testClient, id int) *http.Response {
+		return c.do("PATCH", fmt.Sprintf("/notes/%d/star", id), nil)
+	}
+	starred := func() []int {
+		t.Helper()
+		resp := c.do("GET", "/notes/starred", nil)
+		wantStatus(t, resp, http.StatusOK)
+		var notes []Note
+		decodeBody(t, resp, &notes)
+		return noteIDs(notes)
+	}
+	if got := starred(); len(got) != 0 {
+		t.Fatalf("starred before any stars = %v", got)
+	}
+
+	resp := star(c, ids[0])
+	wantStatus(t, resp, http.StatusOK)
+	var n Note
+	decodeBody(t, resp, &n)
+	if !n.Starred || n.Pinned {
+		t.Fatalf("after star: starred %v, pinned %v", n.Starred, n.Pinned)
+	}
+	wantStatus(t, star(c, ids[2]), http.StatusOK)
+	wantStatus(t, star(c, ids[3]), http.StatusOK)
+	if got, want := starred(), []int{ids[3], ids[2], ids[0]}; !slices.Equal(got, want) {
+		t.Fatalf("starred = %v, want %v newest first", got, want)
+	}
+
+	// Starring a note doesn't move it in the main list.
+	if got, want := noteIDs(c.listNotes("")), []int{ids[3], ids[2], ids[1], ids[0]}; !slices.Equal(got, want) {
+		t.Fatalf("list order = %v, want %v", got, want)
+	}
+
+	// Toggling again unstars; archived notes drop out of the collection.
+	wantStatus(t, star(c, ids[3]), http.StatusOK)
+	wantStatus(t, c.do("PATCH", fmt.Sprintf("/notes/%d/archive", ids[2]), nil), http.StatusOK)
+	if got, want := starred(), []int{ids[0]}; !slices.Equal(got, want) {
+		t.Fatalf("starred = %v, want %v", got, want)
+	}
+
+	// Starring ignores the pin cap.
+	a.cfg.MaxPinnedNotes = 1
+	wantStatus(t, c.do("PATCH", fmt.Sprintf("/notes/%d/pin", ids[0]), nil), http.StatusOK)
+	wantStatus(t, star(c, ids[1]), http.StatusOK)
+
+	bob := c.newClient()
+	bob.login("bob")
+	wantStatus(t, star(bob, ids[0]), http.StatusNotFound)
+	resp = bob.do("GET", "/notes/starred", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); body != "[]\n" {
+		t.Errorf("bob's starred = %q", body)
+	}
+	wantStatus(t, c.do("POST", "/notes/starred", nil), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// cacheStatic marks successful responses from next as cacheable for maxAge;
+// 0 sends no Cache-Control. Errors such as 404 aren't cached, as the header
+// is set only once next has picked its status.
+func cacheStatic(next http.Handler, maxAge time.Duration) http.Handler {
+	if maxAge <= 0 {
+		return next
+	}
+	value := "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&cacheHeaderWriter{ResponseWriter: w, value: value}, r)
+	})
+}
+
+// cacheHeaderWriter adds Cache-Control to 2xx and 304 responses.
+type cacheHeaderWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (w *cacheHeaderWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if (status >= 200 && status < 300) || status == http.StatusNotModified {
+			w.Header().Set("Cache-Control", w.value)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheHeaderWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheHeaderWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// faviconHandler serves cfg.FaviconPath, or 204 when none is configured so
+// browsers stop asking without filling the logs with 404s.
+func (a *app) faviconHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+	if a.cfg.FaviconPath == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.ServeFile(w, r, a.cfg.FaviconPath)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStaticCaching(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	// The max age is read when the routes are built.
+	a.cfg.StaticMaxAge = 10 * time.Minute
+	c := newTestClient(t, a.routes())
+
+	resp := c.do("GET", "/static/style.css", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if cc := resp.Header.Get("Cache-Control"); cc != "public, max-age=600" {
+		t.Errorf("asset Cache-Control = %q", cc)
+	}
+	// A miss isn't worth remembering.
+	resp = c.do("GET", "/static/missing.css", nil)
+	wantStatus(t, resp, http.StatusNotFound)
+	if cc := resp.Header.Get("Cache-Control"); cc != "" {
+		t.Errorf("404 Cache-Control = %q, want none", cc)
+	}
+	// The rendered page is revalidated every time.
+	resp = c.do("GET", "/", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("index Cache-Control = %q, want no-cache", cc)
+	}
+}
+
+func TestStaticCachingOff(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	a.cfg.StaticMaxAge = 0
+	c := newTestClient(t, a.routes())
+	resp := c.do("GET", "/static/style.css", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if cc := resp.Header.Get("Cache-Control"); cc != "" {
+		t.Errorf("Cache-Control = %q with STATIC_MAX_AGE=0", cc)
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	wantStatus(t, c.do("GET", "/favicon.ico", nil), http.StatusNoContent)
+	wantStatus(t, c.do("POST", "/favicon.ico", nil), http.StatusMethodNotAllowed)
+
+	icon := filepath.Join(t.TempDir(), "favicon.ico")
+	if err := os.WriteFile(icon, []byte("\x00\x00\x01\x00icon"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a.cfg.FaviconPath = icon
+	resp := c.do("GET", "/favicon.ico", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); body != "\x00\x00\x01\x00icon" {
+		t.Errorf("body = %q", body)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "public, max-age=3600" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+}
+
+// TestStaticSettingsPerApp checks the settings come from each app's own
+// Config, so two apps in one process don't see each other's.
+func TestStaticSettingsPerApp(t *testing.T) {
+	short, _, _ := newMemApp(t)
+	short.cfg.StaticMaxAge = time.Minute
+	long, _, _ := newMemApp(t)
+	long.cfg.StaticMaxAge = time.Hour
+	icon := filepath.Join(t.TempDir(), "favicon.ico")
+	if err := os.WriteFile(icon, []byte("icon"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	long.cfg.FaviconPath = icon
+
+	shortClient, longClient := newTestClient(t, short.routes()), newTestClient(t, long.routes())
+	for _, tc := range []struct {
+		c           *testClient
+		favicon     int
+		cacheHeader string
+	}{
+		{shortClient, http.StatusNoContent, "public, max-age=60"},
+		{longClient, http.StatusOK, "public, max-age=3600"},
+	} {
+		resp := tc.c.do("GET", "/static/style.css", nil)
+		wantStatus(t, resp, http.StatusOK)
+		if cc := resp.Header.Get("Cache-Control"); cc != tc.cacheHeader {
+			t.Errorf("Cache-Control = %q, want %q", cc, tc.cacheHeader)
+		}
+		wantStatus(t, tc.c.do("GET", "/favicon.ico", nil), tc.favicon)
+	}
+}
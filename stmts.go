@@ -0,0 +1,48 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+)
+
+// noteStmts holds the hot-path note queries, prepared once at startup so the
+// server doesn't re-parse the same SQL on every request.
+type noteStmts struct {
+	get    *sql.Stmt
+	insert *sql.Stmt
+	update *sql.Stmt
+	delete *sql.Stmt
+}
+
+var stmts noteStmts
+
+func prepareNoteStmts() error {
+	queries := []struct {
+		dst   **sql.Stmt
+		query string
+	}{
+		{&stmts.get, `SELECT ` + noteColumns + ` FROM notes WHERE id = ? AND user_id = ?`},
+		{&stmts.insert, `INSERT INTO notes (user_id, title, content, content_type, color, notebook_id, due_at, created_ip, created_user_agent) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)` + sqlDialect.returning()},
+		{&stmts.update, `UPDATE notes SET title = ?, content = ?, content_type = COALESCE(NULLIF(?, ''), content_type), color = COALESCE(NULLIF(?, ''), color), notebook_id = CASE WHEN ? THEN ? ELSE notebook_id END, due_at = CASE WHEN ? THEN ? ELSE due_at END, version = version + 1, updated_at = CURRENT_TIMESTAMP(6) WHERE id = ? AND user_id = ? AND (NOT ? OR version = ?)`},
+		{&stmts.delete, `DELETE FROM notes WHERE id = ? AND user_id = ?`},
+	}
+	for _, q := range queries {
+		stmt, err := db.Prepare(q.query)
+		if err != nil {
+			return err
+		}
+		*q.dst = stmt
+	}
+	return nil
+}
+
+func (s *noteStmts) Close() {
+	for _, stmt := range []*sql.Stmt{s.get, s.insert, s.update, s.delete} {
+		if stmt == nil {
+			continue
+		}
+		if err := stmt.Close(); err != nil {
+			slog.Warn("close statement", "err", err)
+		}
+	}
+}
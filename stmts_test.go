@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// seedNote creates a user with one note straight through the stores.
+func seedNote(tb testing.TB, a *app) (userID int, note Note) {
+	tb.Helper()
+	u, err := a.users.Create(tb.Context(), "seed", "hash")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	note, err = a.notes.Create(tb.Context(), u.ID, NoteInput{Title: "seed", Content: "content", ContentType: defaultNoteContentType, Color: defaultNoteColor})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return u.ID, note
+}
+
+func TestPreparedGet(t *testing.T) {
+	a := newDBApp(t)
+	userID, note := seedNote(t, a)
+
+	got, err := fetchNote(t.Context(), userID, note.ID)
+	if err != nil || got.ID != note.ID || got.Title != "seed" {
+		t.Fatalf("fetchNote = %+v, %v", got, err)
+	}
+	// The statement is still bound to the owner.
+	if _, err := fetchNote(t.Context(), userID+1, note.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("someone else's fetch: err = %v, want ErrNoRows", err)
+	}
+}
+
+// BenchmarkNoteGet compares the prepared single-note lookup with running
+// the same SQL ad hoc, which is what every request used to do.
+func BenchmarkNoteGet(b *testing.B) {
+	a := newDBApp(b)
+	userID, note := seedNote(b, a)
+	query := `SELECT ` + noteColumns + ` FROM notes WHERE id = ? AND user_id = ?`
+
+	b.Run("prepared", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := scanNote(stmts.get.QueryRowContext(b.Context(), note.ID, userID)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ad-hoc", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := scanNote(db.QueryRowContext(b.Context(), query, note.ID, userID)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// errNotFound is returned by stores when a row doesn't exist or isn't
+	// owned by the requesting user; handlers treat both the same.
+	errNotFound = errors.New("not found")
+
+	errUsernameTaken = errors.New("username already taken")
+
+	// errVersionConflict means the note changed since the client read it.
+	errVersionConflict = errors.New("note was modified")
+)
+
+// NoteFilter selects which of a user's notes List returns.
+type NoteFilter struct {
+	Archived   bool
+	Done       sql.NullBool // unfiltered when not Valid
+	Pinned     sql.NullBool // unfiltered when not Valid
+	NotebookID sql.NullInt64
+	// Query keeps notes whose title or content contains it, ignoring
+	// case. Empty matches everything.
+	Query string
+	// CreatedAfter and CreatedBefore bound created_at, the first
+	// inclusively and the second exclusively, so back-to-back windows
+	// don't overlap.
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+
+	// IncludeShared adds notes other users shared with this one, marked
+	// ReadOnly.
+	IncludeShared bool
+
+	// After, when set, starts the list just past that note in list order,
+	// for cursor pagination. Limit caps how many are returned; 0 means all.
+	After *NoteCursor
+	Limit int
+}
+
+// NoteCursor is a position in the notes list, which is ordered pinned
+// notes first, then by position, then newest id first.
+type NoteCursor struct {
+	Pinned   bool
+	Position int
+	ID       int
+}
+
+// NoteInput is a validated body for NoteStore.Create.
+type NoteInput struct {
+	Title       string
+	Content     string
+	ContentType string
+	Color       string
+	NotebookID  sql.NullInt64
+	DueAt       sql.NullTime
+
+	// IdempotencyKey, when set, is recorded in the same transaction as the
+	// note so a retry can replay it.
+	IdempotencyKey string
+
+	// CreatedIP and CreatedUserAgent are kept for auditing and never
+	// returned with the note. Either may be empty.
+	CreatedIP        string
+	CreatedUserAgent string
+}
+
+// NoteUpdate is a validated body for NoteStore.Update. An empty ContentType
+// or Color and unset Set* flags keep the note's current values.
+type NoteUpdate struct {
+	Title       string
+	Content     string
+	ContentType string
+	Color       string
+	SetNotebook bool
+	NotebookID  sql.NullInt64
+	SetDue      bool
+	DueAt       sql.NullTime
+
+	// Version, when set, must match the note's current version or Update
+	// fails with errVersionConflict.
+	Version sql.NullInt64
+}
+
+// NoteBatchUpdate is a validated body for NoteStore.UpdateMany. Unset
+// fields are left alone.
+type NoteBatchUpdate struct {
+	SetNotebook bool
+	NotebookID  sql.NullInt64 // NULL removes the notes from their notebook
+	Archived    sql.NullBool
+}
+
+// NoteStore persists notes. Every method is scoped to userID.
+type NoteStore interface {
+	List(ctx context.Context, userID int, f NoteFilter) ([]Note, error)
+	// Count is how many notes List would return without After and Limit.
+	Count(ctx context.Context, userID int, f NoteFilter) (int, error)
+	Get(ctx context.Context, userID, id int) (Note, error)
+	// FindDuplicate returns the user's oldest note with exactly this title
+	// and content, or errNotFound.
+	FindDuplicate(ctx context.Context, userID int, title, content string) (Note, error)
+	Create(ctx context.Context, userID int, in NoteInput) (Note, error)
+	// CreateBatch creates all of ins, in order, or none of them.
+	CreateBatch(ctx context.Context, userID int, ins []NoteInput) ([]Note, error)
+	// Update returns errVersionConflict if in.Version is stale.
+	Update(ctx context.Context, userID, id int, in NoteUpdate) (Note, error)
+	Delete(ctx context.Context, userID, id int) error
+	// UpdateMany applies in to whichever of ids the user owns, in one
+	// transaction, and returns those notes as updated. Other ids are
+	// skipped.
+	UpdateMany(ctx context.Context, userID int, ids []int, in NoteBatchUpdate) ([]Note, error)
+	// Reorder gives the notes ids positions 1..len(ids) in that order. It
+	// returns errNotFound, changing nothing, if any id isn't the user's.
+	Reorder(ctx context.Context, userID int, ids []int) error
+}
+
+// UserStore persists accounts. Usernames are expected to be normalized by
+// the caller.
+type UserStore interface {
+	Create(ctx context.Context, username, passwordHash string) (User, error)
+	Get(ctx context.Context, id int) (User, error)
+	GetByUsername(ctx context.Context, username string) (User, error)
+	// RecordLogin stamps the user's last_login_at with the current time.
+	RecordLogin(ctx context.Context, id int) error
+	// Delete removes the user and everything they own.
+	Delete(ctx context.Context, id int) error
+}
+
+// app holds the dependencies of the handlers that have moved off the global
+// db onto the store interfaces, and the configuration handlers read their
+// settings from.
+type app struct {
+	cfg   Config
+	notes NoteStore
+	users UserStore
+	// dummyHash is compared against when a login names an unknown user. It
+	// is made at cfg.BcryptCost so both paths take the same time.
+	dummyHash []byte
+}
+
+// newApp builds the app for cfg over the given stores.
+func newApp(cfg Config, notes NoteStore, users UserStore) *app {
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("not a real password"), cfg.BcryptCost)
+	return &app{cfg: cfg, notes: notes, users: users, dummyHash: dummyHash}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newMemApp is an app over in-memory stores, for handler tests that don't
+// touch the database.
+func newMemApp(t *testing.T) (*app, *memNoteStore, *memUserStore) {
+	t.Helper()
+	setupServerGlobals(t)
+	notes, users := newMemNoteStore(), newMemUserStore()
+	return newApp(testConfig(t), notes, users), notes, users
+}
+
+// memNoteStore is an in-memory NoteStore for handler tests that don't need
+// the database. It follows sqlNoteStore's ordering and ownership rules but
+// knows nothing of shares, revisions or idempotency keys.
+type memNoteStore struct {
+	mu     sync.Mutex
+	notes  map[int]Note
+	nextID int
+}
+
+func newMemNoteStore() *memNoteStore {
+	return &memNoteStore{notes: make(map[int]Note)}
+}
+
+// sorted is the user's notes matching f in list order: pinned first, then
+// by position, then newest first.
+func (s *memNoteStore) sorted(userID int, f NoteFilter) []Note {
+	var out []Note
+	for _, n := range s.notes {
+		if n.UserID != userID || n.Archived != f.Archived {
+			continue
+		}
+		if f.Done.Valid && n.Done != f.Done.Bool {
+			continue
+		}
+		if f.Pinned.Valid && n.Pinned != f.Pinned.Bool {
+			continue
+		}
+		if f.NotebookID.Valid && (n.NotebookID == nil || int64(*n.NotebookID) != f.NotebookID.Int64) {
+			continue
+		}
+		if q := strings.ToLower(f.Query); q != "" &&
+			!strings.Contains(strings.ToLower(n.Title), q) && !strings.Contains(strings.ToLower(n.Content), q) {
+			continue
+		}
+		if f.CreatedAfter.Valid && n.CreatedAt.Before(f.CreatedAfter.Time) {
+			continue
+		}
+		if f.CreatedBefore.Valid && !n.CreatedAt.Before(f.CreatedBefore.Time) {
+			continue
+		}
+		out = append(out, n)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return noteBefore(out[i].Pinned, out[i].Position, out[i].ID, out[j].Pinned, out[j].Position, out[j].ID)
+	})
+	return out
+}
+
+// noteBefore is the list order on (pinned, position, id).
+func noteBefore(pinnedA bool, posA, idA int, pinnedB bool, posB, idB int) bool {
+	if pinnedA != pinnedB {
+		return pinnedA
+	}
+	if posA != posB {
+		return posA < posB
+	}
+	return idA > idB
+}
+
+func (s *memNoteStore) List(ctx context.Context, userID int, f NoteFilter) ([]Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notes := []Note{}
+	for _, n := range s.sorted(userID, f) {
+		if f.After != nil && !noteBefore(f.After.Pinned, f.After.Position, f.After.ID, n.Pinned, n.Position, n.ID) {
+			continue
+		}
+		notes = append(notes, n)
+		if f.Limit > 0 && len(notes) == f.Limit {
+			break
+		}
+	}
+	return notes, nil
+}
+
+func (s *memNoteStore) Count(ctx context.Context, userID int, f NoteFilter) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sorted(userID, f)), nil
+}
+
+func (s *memNoteStore) Get(ctx context.Context, userID, id int) (Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[id]
+	if !ok || n.UserID != userID {
+		return Note{}, errNotFound
+	}
+	return n, nil
+}
+
+func (s *memNoteStore) FindDuplicate(ctx context.Context, userID int, title, content string) (Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := Note{}
+	for _, n := range s.notes {
+		if n.UserID == userID && n.Title == title && n.Content == content && (found.ID == 0 || n.ID < found.ID) {
+			found = n
+		}
+	}
+	if found.ID == 0 {
+		return Note{}, errNotFound
+	}
+	return found, nil
+}
+
+func (s *memNoteStore) Create(ctx context.Context, userID int, in NoteInput) (Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(userID, in), nil
+}
+
+func (s *memNoteStore) CreateBatch(ctx context.Context, userID int, ins []NoteInput) ([]Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notes := make([]Note, 0, len(ins))
+	for _, in := range ins {
+		notes = append(notes, s.insert(userID, in))
+	}
+	return notes, nil
+}
+
+// insert stores a new note; callers hold s.mu.
+func (s *memNoteStore) insert(userID int, in NoteInput) Note {
+	s.nextID++
+	now := time.Now()
+	n := Note{
+		ID:          s.nextID,
+		UserID:      userID,
+		Title:       in.Title,
+		Content:     in.Content,
+		ContentType: in.ContentType,
+		Color:       in.Color,
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if in.NotebookID.Valid {
+		id := int(in.NotebookID.Int64)
+		n.NotebookID = &id
+	}
+	if in.DueAt.Valid {
+		due := in.DueAt.Time
+		n.DueAt = &due
+	}
+	s.notes[n.ID] = n
+	return n
+}
+
+func (s *memNoteStore) Update(ctx context.Context, userID, id int, in NoteUpdate) (Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[id]
+	if !ok || n.UserID != userID {
+		return Note{}, errNotFound
+	}
+	if in.Version.Valid && int64(n.Version) != in.Version.Int64 {
+		return Note{}, errVersionConflict
+	}
+	n.Title, n.Content = in.Title, in.Content
+	if in.ContentType != "" {
+		n.ContentType = in.ContentType
+	}
+	if in.Color != "" {
+		n.Color = in.Color
+	}
+	if in.SetNotebook {
+		n.NotebookID = nil
+		if in.NotebookID.Valid {
+			nb := int(in.NotebookID.Int64)
+			n.NotebookID = &nb
+		}
+	}
+	if in.SetDue {
+		n.DueAt = nil
+		if in.DueAt.Valid {
+			due := in.DueAt.Time
+			n.DueAt = &due
+		}
+	}
+	n.Version++
+	n.UpdatedAt = time.Now()
+	s.notes[id] = n
+	return n, nil
+}
+
+func (s *memNoteStore) Delete(ctx context.Context, userID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[id]
+	if !ok || n.UserID != userID {
+		return errNotFound
+	}
+	delete(s.notes, id)
+	return nil
+}
+
+func (s *memNoteStore) UpdateMany(ctx context.Context, userID int, ids []int, in NoteBatchUpdate) ([]Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notes := []Note{}
+	sorted := append([]int(nil), ids...)
+	sort.Ints(sorted)
+	for _, id := range sorted {
+		n, ok := s.notes[id]
+		if !ok || n.UserID != userID {
+			continue
+		}
+		if in.SetNotebook {
+			n.NotebookID = nil
+			if in.NotebookID.Valid {
+				nb := int(in.NotebookID.Int64)
+				n.NotebookID = &nb
+			}
+		}
+		if in.Archived.Valid {
+			n.Archived = in.Archived.Bool
+		}
+		n.Version++
+		n.UpdatedAt = time.Now()
+		s.notes[id] = n
+		notes = append(notes, n)
+	}
+	return notes, nil
+}
+
+func (s *memNoteStore) Reorder(ctx context.Context, userID int, ids []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if n, ok := s.notes[id]; !ok || n.UserID != userID {
+			return errNotFound
+		}
+	}
+	for i, id := range ids {
+		n := s.notes[id]
+		n.Position = i + 1
+		s.notes[id] = n
+	}
+	return nil
+}
+
+// memUserStore is an in-memory UserStore. Like sqlUserStore it makes the
+// first account, or adminUsername's, the admin.
+type memUserStore struct {
+	mu            sync.Mutex
+	users         map[int]User
+	logins        map[int]time.Time
+	nextID        int
+	adminUsername string
+}
+
+func newMemUserStore() *memUserStore {
+	return &memUserStore{users: make(map[int]User), logins: make(map[int]time.Time)}
+}
+
+func (s *memUserStore) Create(ctx context.Context, username, passwordHash string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if strings.EqualFold(u.Username, username) {
+			return User{}, errUsernameTaken
+		}
+	}
+	s.nextID++
+	u := User{
+		ID:       s.nextID,
+		Username: username,
+		Password: passwordHash,
+		IsAdmin:  username == s.adminUsername || (s.adminUsername == "" && len(s.users) == 0),
+	}
+	s.users[u.ID] = u
+	return u, nil
+}
+
+func (s *memUserStore) Get(ctx context.Context, id int) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, errNotFound
+	}
+	return u, nil
+}
+
+func (s *memUserStore) GetByUsername(ctx context.Context, username string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if strings.EqualFold(u.Username, username) {
+			return u, nil
+		}
+	}
+	return User{}, errNotFound
+}
+
+func (s *memUserStore) RecordLogin(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logins[id] = time.Now()
+	return nil
+}
+
+func (s *memUserStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, id)
+	return nil
+}
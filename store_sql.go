@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sqlNoteStore is the NoteStore backed by the notes table and the prepared
+// statements in stmts.
+type sqlNoteStore struct {
+	db    *sql.DB
+	stmts *noteStmts
+}
+
+// List builds its WHERE clause from whichever filters are set. Only fixed
+// SQL fragments are joined; every filter value is a bound parameter.
+func (s *sqlNoteStore) List(ctx context.Context, userID int, f NoteFilter) ([]Note, error) {
+	where, args := noteFilterWhere(userID, f)
+	if f.After != nil {
+		where += " AND (pinned < ? OR (pinned = ? AND (position > ? OR (position = ? AND id < ?))))"
+		args = append(args, f.After.Pinned, f.After.Pinned, f.After.Position, f.After.Position, f.After.ID)
+	}
+	query := `SELECT ` + noteColumns + ` FROM notes WHERE ` + where + ` ORDER BY pinned DESC, position, id DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ` + strconv.Itoa(f.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Start non-nil so an empty list encodes as [] rather than null.
+	notes := []Note{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		n.ReadOnly = n.UserID != userID
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+func (s *sqlNoteStore) Count(ctx context.Context, userID int, f NoteFilter) (int, error) {
+	where, args := noteFilterWhere(userID, f)
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notes WHERE `+where, args...).Scan(&n)
+	return n, err
+}
+
+// noteFilterWhere builds the WHERE clause for f's filters, ignoring After
+// and Limit.
+func noteFilterWhere(userID int, f NoteFilter) (string, []interface{}) {
+	where := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	if f.IncludeShared {
+		where[0] = "(user_id = ? OR id IN (SELECT note_id FROM note_shares WHERE shared_with_user_id = ?))"
+		args = append(args, userID)
+	}
+	where = append(where, "archived = ?")
+	args = append(args, f.Archived)
+	if f.Done.Valid {
+		where = append(where, "done = ?")
+		args = append(args, f.Done.Bool)
+	}
+	if f.Pinned.Valid {
+		where = append(where, "pinned = ?")
+		args = append(args, f.Pinned.Bool)
+	}
+	if f.NotebookID.Valid {
+		where = append(where, "notebook_id = ?")
+		args = append(args, f.NotebookID.Int64)
+	}
+	if f.Query != "" {
+		pattern := containsPattern(f.Query)
+		where = append(where, "(LOWER(title) LIKE ? OR LOWER(content) LIKE ?)")
+		args = append(args, pattern, pattern)
+	}
+	if f.CreatedAfter.Valid {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.CreatedAfter.Time)
+	}
+	if f.CreatedBefore.Valid {
+		where = append(where, "created_at < ?")
+		args = append(args, f.CreatedBefore.Time)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+func (s *sqlNoteStore) Get(ctx context.Context, userID, id int) (Note, error) {
+	n, err := scanNote(s.stmts.get.QueryRowContext(ctx, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Note{}, errNotFound
+	}
+	return n, err
+}
+
+// FindDuplicate lets the database narrow the search by title but compares
+// in Go, since MySQL's default collations would also match notes differing
+// only in case or trailing spaces.
+func (s *sqlNoteStore) FindDuplicate(ctx context.Context, userID int, title, content string) (Note, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+noteColumns+` FROM notes WHERE user_id = ? AND title = ? ORDER BY id`, userID, title)
+	if err != nil {
+		return Note{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return Note{}, err
+		}
+		if n.Title == title && n.Content == content {
+			return n, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Note{}, err
+	}
+	return Note{}, errNotFound
+}
+
+// Create inserts the note and its idempotency key together; any error rolls
+// both back.
+func (s *sqlNoteStore) Create(ctx context.Context, userID int, in NoteInput) (Note, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Note{}, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	note, err := s.insert(ctx, tx, userID, in)
+	if err != nil {
+		return Note{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Note{}, fmt.Errorf("commit: %w", err)
+	}
+	return note, nil
+}
+
+// CreateBatch inserts all the notes or, on any error, none of them.
+func (s *sqlNoteStore) CreateBatch(ctx context.Context, userID int, ins []NoteInput) ([]Note, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	notes := make([]Note, 0, len(ins))
+	for i, in := range ins {
+		note, err := s.insert(ctx, tx, userID, in)
+		if err != nil {
+			return nil, fmt.Errorf("note %d: %w", i, err)
+		}
+		notes = append(notes, note)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return notes, nil
+}
+
+// insert writes one note, and its idempotency key if any, inside tx and
+// reads it back.
+func (s *sqlNoteStore) insert(ctx context.Context, tx *sql.Tx, userID int, in NoteInput) (Note, error) {
+	id64, err := stmtInsertID(ctx, tx.StmtContext(ctx, s.stmts.insert), userID, in.Title, in.Content, in.ContentType, in.Color, in.NotebookID, in.DueAt,
+		nullString(in.CreatedIP), nullString(in.CreatedUserAgent))
+	if err != nil {
+		return Note{}, fmt.Errorf("insert: %w", err)
+	}
+
+	if in.IdempotencyKey != "" {
+		if err := saveIdempotencyKey(ctx, tx, userID, in.IdempotencyKey, int(id64)); err != nil {
+			return Note{}, fmt.Errorf("idempotency save: %w", err)
+		}
+	}
+
+	// Read the row back for its database-assigned timestamps.
+	note, err := scanNote(tx.StmtContext(ctx, s.stmts.get).QueryRowContext(ctx, id64, userID))
+	if err != nil {
+		return Note{}, fmt.Errorf("fetch: %w", err)
+	}
+	return note, nil
+}
+
+// Update snapshots the current version as a revision and applies the edit
+// atomically.
+func (s *sqlNoteStore) Update(ctx context.Context, userID, id int, in NoteUpdate) (Note, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Note{}, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := recordRevision(ctx, tx, userID, id); errors.Is(err, sql.ErrNoRows) {
+		return Note{}, errNotFound
+	} else if err != nil {
+		return Note{}, fmt.Errorf("revision: %w", err)
+	}
+	res, err := tx.StmtContext(ctx, s.stmts.update).ExecContext(ctx, in.Title, in.Content, in.ContentType, in.Color, in.SetNotebook, in.NotebookID, in.SetDue, in.DueAt,
+		id, userID, in.Version.Valid, in.Version.Int64)
+	if err != nil {
+		return Note{}, fmt.Errorf("update: %w", err)
+	}
+	// The note exists (recordRevision found it) and a successful update
+	// always bumps the version, so no affected row means a stale version.
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return Note{}, errVersionConflict
+	}
+	if err := tx.Commit(); err != nil {
+		return Note{}, fmt.Errorf("commit: %w", err)
+	}
+	return s.Get(ctx, userID, id)
+}
+
+func (s *sqlNoteStore) Delete(ctx context.Context, userID, id int) error {
+	res, err := s.stmts.delete.ExecContext(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (s *sqlNoteStore) Reorder(ctx context.Context, userID int, ids []int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	var owned int
+	err = tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notes WHERE user_id = ? AND id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`,
+		args...,
+	).Scan(&owned)
+	if err != nil {
+		return fmt.Errorf("ownership check: %w", err)
+	}
+	if owned != len(ids) {
+		return errNotFound
+	}
+
+	// updated_at is assigned first so it still sees the old position, and
+	// only moves for notes that actually moved, which keeps list ETags
+	// honest without touching the rest.
+	stmt, err := tx.PrepareContext(ctx, `UPDATE notes SET updated_at = CASE WHEN position <> ? THEN CURRENT_TIMESTAMP(6) ELSE updated_at END, position = ? WHERE id = ? AND user_id = ?`)
+	if err != nil {
+		return fmt.Errorf("prepare: %w", err)
+	}
+	defer stmt.Close()
+	for i, id := range ids {
+		if _, err := stmt.ExecContext(ctx, i+1, i+1, id, userID); err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlNoteStore) UpdateMany(ctx context.Context, userID int, ids []int, in NoteBatchUpdate) ([]Note, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	set := []string{"version = version + 1", "updated_at = CURRENT_TIMESTAMP(6)"}
+	var args []interface{}
+	if in.SetNotebook {
+		set = append(set, "notebook_id = ?")
+		args = append(args, in.NotebookID)
+	}
+	if in.Archived.Valid {
+		set = append(set, "archived = ?")
+		args = append(args, in.Archived.Bool)
+	}
+	where := `user_id = ? AND id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)`
+	whereArgs := []interface{}{userID}
+	for _, id := range ids {
+		whereArgs = append(whereArgs, id)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE notes SET `+strings.Join(set, ", ")+` WHERE `+where, append(args, whereArgs...)...); err != nil {
+		return nil, fmt.Errorf("update: %w", err)
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT `+noteColumns+` FROM notes WHERE `+where+` ORDER BY id`, whereArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	notes := []Note{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("fetch: %w", err)
+		}
+		notes = append(notes, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return notes, nil
+}
+
+// nullString stores an empty string as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// sqlUserStore is the UserStore backed by the users table.
+type sqlUserStore struct {
+	db *sql.DB
+	// adminUsername names the account that gets admin rights
+	// (ADMIN_USERNAME). When empty, the first account registered becomes
+	// the admin.
+	adminUsername string
+}
+
+func (s *sqlUserStore) Create(ctx context.Context, username, passwordHash string) (User, error) {
+	// Rows created before usernames were normalized may still be mixed-case.
+	var taken int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE LOWER(username) = ?", username).Scan(&taken)
+	if err != nil {
+		return User{}, fmt.Errorf("lookup: %w", err)
+	}
+	if taken > 0 {
+		return User{}, errUsernameTaken
+	}
+	// The configured admin, or failing that the very first account, runs
+	// the instance.
+	isAdmin := username == s.adminUsername
+
+	id64, err := insertID(ctx, s.db, "INSERT INTO users (username, password, is_admin) VALUES (?, ?, ?)", username, passwordHash, isAdmin)
+	if isDuplicateKey(err) {
+		// A concurrent registration won the unique index.
+		return User{}, errUsernameTaken
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("insert: %w", err)
+	}
+	if s.adminUsername == "" {
+		// Promote after the insert, in one statement, so two registrations
+		// racing on an empty table can't both count zero users. The
+		// derived table keeps MySQL from refusing to read the table it's
+		// updating; its LIMIT stops the optimizer merging it back in.
+		res, err := s.db.ExecContext(ctx, `UPDATE users SET is_admin = TRUE WHERE id = ?
+			AND NOT EXISTS (SELECT 1 FROM (SELECT id FROM users WHERE is_admin OR id < ? LIMIT 1) AS earlier)`, id64, id64)
+		if err != nil {
+			return User{}, fmt.Errorf("promote: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return User{}, fmt.Errorf("promote: %w", err)
+		}
+		isAdmin = n == 1
+	}
+	return User{ID: int(id64), Username: username, Password: passwordHash, IsAdmin: isAdmin}, nil
+}
+
+func (s *sqlUserStore) Get(ctx context.Context, id int) (User, error) {
+	return s.getUser(ctx, "SELECT id, username, password, is_admin FROM users WHERE id = ?", id)
+}
+
+func (s *sqlUserStore) GetByUsername(ctx context.Context, username string) (User, error) {
+	return s.getUser(ctx, "SELECT id, username, password, is_admin FROM users WHERE LOWER(username) = ?", username)
+}
+
+func (s *sqlUserStore) RecordLogin(ctx context.Context, id int) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET last_login_at = CURRENT_TIMESTAMP(6) WHERE id = ?", id)
+	return err
+}
+
+func (s *sqlUserStore) getUser(ctx context.Context, query string, arg interface{}) (User, error) {
+	var u User
+	err := s.db.QueryRowContext(ctx, query, arg).Scan(&u.ID, &u.Username, &u.Password, &u.IsAdmin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, errNotFound
+	}
+	return u, err
+}
+
+// Delete removes the user and everything they own in one transaction. Note
+// side tables (shares, attachments, revisions) cascade from notes, and
+// webhook deliveries from webhooks; stored attachment files are the
+// caller's to clean up.
+func (s *sqlUserStore) Delete(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		"DELETE FROM idempotency_keys WHERE user_id = ?",
+		"DELETE FROM note_shares WHERE shared_with_user_id = ?",
+		"DELETE FROM notes WHERE user_id = ?",
+		"DELETE FROM notebooks WHERE user_id = ?",
+		"DELETE FROM templates WHERE user_id = ?",
+		"DELETE FROM api_keys WHERE user_id = ?",
+		"DELETE FROM webhooks WHERE user_id = ?",
+		"DELETE FROM users WHERE id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, q, id); err != nil {
+			return fmt.Errorf("delete: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countRows is SELECT COUNT(*) FROM table, failing the test on error.
+func countRows(t *testing.T, table string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSQLNoteStoreRollback(t *testing.T) {
+	a := newDBApp(t)
+	u, err := a.users.Create(t.Context(), "alice", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := NoteInput{Title: "t", ContentType: defaultNoteContentType, Color: defaultNoteColor}
+
+	// The note is written before its idempotency key; a key the column
+	// can't hold must take the note down with it.
+	bad := in
+	bad.IdempotencyKey = strings.Repeat("k", 300)
+	if _, err := a.notes.Create(t.Context(), u.ID, bad); err == nil {
+		t.Fatal("Create with an oversized key succeeded")
+	}
+	if n := countRows(t, "notes"); n != 0 {
+		t.Fatalf("%d notes left after a failed create", n)
+	}
+
+	// One bad note in a batch leaves none of them.
+	missing := in
+	missing.NotebookID = sql.NullInt64{Int64: 999999, Valid: true}
+	if _, err := a.notes.CreateBatch(t.Context(), u.ID, []NoteInput{in, in, missing}); err == nil {
+		t.Fatal("CreateBatch with a missing notebook succeeded")
+	}
+	if n := countRows(t, "notes"); n != 0 {
+		t.Fatalf("%d notes left after a failed batch", n)
+	}
+
+	// A stale update drops the revision it had already recorded.
+	note, err := a.notes.Create(t.Context(), u.ID, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.notes.Update(t.Context(), u.ID, note.ID, NoteUpdate{Title: "new", Version: sql.NullInt64{Int64: 7, Valid: true}})
+	if !errors.Is(err, errVersionConflict) {
+		t.Fatalf("stale update: err = %v, want errVersionConflict", err)
+	}
+	if n := countRows(t, "note_revisions"); n != 0 {
+		t.Fatalf("%d revisions left after a failed update", n)
+	}
+	if got, _ := a.notes.Get(t.Context(), u.ID, note.ID); got.Title != "t" || got.Version != 1 {
+		t.Fatalf("note after failed update = %+v", got)
+	}
+}
+
+func TestQueriesHonourContext(t *testing.T) {
+	a := newDBApp(t)
+	u, err := a.users.Create(t.Context(), "alice", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := a.notes.List(ctx, u.ID, NoteFilter{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("List with a cancelled context: %v, want context.Canceled", err)
+	}
+	if _, err := a.notes.Create(ctx, u.ID, NoteInput{Title: "x", ContentType: defaultNoteContentType, Color: defaultNoteColor}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Create with a cancelled context: %v, want context.Canceled", err)
+	}
+	if _, err := a.users.Get(ctx, u.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get user with a cancelled context: %v, want context.Canceled", err)
+	}
+	if n := countRows(t, "notes"); n != 0 {
+		t.Fatalf("%d notes created under a cancelled context", n)
+	}
+
+	// A query already running is abandoned when its context ends.
+	ctx, cancel = context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = db.ExecContext(ctx, `SELECT SLEEP(5)`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow query: %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("slow query ran %v past its deadline", d)
+	}
+}
+
+// TestClientDisconnectCancels checks handlers pass the request's context
+// down, by calling one with a context that has already ended.
+func TestClientDisconnectCancels(t *testing.T) {
+	a := newDBApp(t)
+	u, err := a.users.Create(t.Context(), "alice", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(t.Context(), userIDKey, u.ID))
+	cancel()
+	r := httptest.NewRequest("GET", "/notes/export", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	exportNotesHandler(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want the query to fail", w.Code)
+	}
+}
+
+func TestNoteFilterWhere(t *testing.T) {
+	after := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name  string
+		f     NoteFilter
+		where string
+		args  []interface{}
+	}{
+		{"default", NoteFilter{}, "user_id = ? AND archived = ?", []interface{}{1, false}},
+		{"done and notebook", NoteFilter{Archived: true, Done: sql.NullBool{Bool: false, Valid: true}, NotebookID: sql.NullInt64{Int64: 4, Valid: true}},
+			"user_id = ? AND archived = ? AND done = ? AND notebook_id = ?", []interface{}{1, true, false, int64(4)}},
+		{"pinned", NoteFilter{Pinned: sql.NullBool{Bool: true, Valid: true}},
+			"user_id = ? AND archived = ? AND pinned = ?", []interface{}{1, false, true}},
+		{"search and date", NoteFilter{Query: "Milk", CreatedAfter: sql.NullTime{Time: after, Valid: true}},
+			"user_id = ? AND archived = ? AND (LOWER(title) LIKE ? OR LOWER(content) LIKE ?) AND created_at >= ?",
+			[]interface{}{1, false, "%milk%", "%milk%", after}},
+		{"shared", NoteFilter{IncludeShared: true},
+			"(user_id = ? OR id IN (SELECT note_id FROM note_shares WHERE shared_with_user_id = ?)) AND archived = ?", []interface{}{1, 1, false}},
+	} {
+		where, args := noteFilterWhere(1, tc.f)
+		if where != tc.where || fmt.Sprint(args) != fmt.Sprint(tc.args) {
+			t.Errorf("%s:\n got %q %v\nwant %q %v", tc.name, where, args, tc.where, tc.args)
+		}
+	}
+
+	// User input only ever travels as an argument, with LIKE wildcards
+	// escaped.
+	const hostile = `x' OR '1'='1 %_\`
+	where, args := noteFilterWhere(1, NoteFilter{Query: hostile})
+	if strings.Contains(where, "'") || strings.Contains(where, "%") {
+		t.Errorf("query text reached the SQL: %q", where)
+	}
+	if want := `%x' or '1'='1 \%\_\\%`; args[2] != want {
+		t.Errorf("pattern = %q, want %q", args[2], want)
+	}
+}
+
+func TestNoteFilterCombinations(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	create := func(title string, done, archived bool) int {
+		n := c.createNote(map[string]string{"title": title})
+		if done {
+			wantStatus(t, c.do("PATCH", fmt.Sprintf("/notes/%d/done", n.ID), nil), http.StatusOK)
+		}
+		if archived {
+			wantStatus(t, c.do("PATCH", fmt.Sprintf("/notes/%d/archive", n.ID), nil), http.StatusOK)
+		}
+		return n.ID
+	}
+	openWork := create("work: report", false, false)
+	doneWork := create("work: slides", true, false)
+	home := create("home: paint", false, false)
+	oldWork := create("work: 2019 plan", true, true)
+
+	for query, want := range map[string][]int{
+		"":                               {home, doneWork, openWork},
+		"q=work":                         {doneWork, openWork},
+		"q=work&done=false":              {openWork},
+		"q=work&done=true":               {doneWork},
+		"q=work&done=true&archived=true": {oldWork},
+		"q=home&done=true":               {},
+		"q=%25":                          {},
+		"q=' OR '1'='1":                  {},
+	} {
+		if got := noteIDs(c.listNotes(strings.ReplaceAll(query, " ", "%20"))); !slices.Equal(got, want) {
+			t.Errorf("?%s = %v, want %v", query, got, want)
+		}
+	}
+}
+
+// TestSQLFindDuplicate checks matches are exact even where the column's
+// collation would call two titles equal.
+func TestSQLFindDuplicate(t *testing.T) {
+	a := newDBApp(t)
+	u, err := a.users.Create(t.Context(), "alice", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := func(title, content string) Note {
+		t.Helper()
+		n, err := a.notes.Create(t.Context(), u.ID, NoteInput{Title: title, Content: content, ContentType: defaultNoteContentType, Color: defaultNoteColor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	create("Plan", "a")
+	create("plan ", "a")
+	want := create("plan", "a")
+	create("plan", "a") // a later copy; the oldest wins
+
+	got, err := a.notes.FindDuplicate(t.Context(), u.ID, "plan", "a")
+	if err != nil || got.ID != want.ID {
+		t.Fatalf("FindDuplicate = note %d, %v; want %d", got.ID, err, want.ID)
+	}
+	for _, tc := range [][2]string{{"plan", "A"}, {"PLAN", "a"}, {"plan", ""}} {
+		if _, err := a.notes.FindDuplicate(t.Context(), u.ID, tc[0], tc[1]); !errors.Is(err, errNotFound) {
+			t.Errorf("FindDuplicate(%q, %q) err = %v, want errNotFound", tc[0], tc[1], err)
+		}
+	}
+	if _, err := a.notes.FindDuplicate(t.Context(), u.ID+1, "plan", "a"); !errors.Is(err, errNotFound) {
+		t.Errorf("another user's lookup err = %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Template is a reusable starting point for notes a user writes often
+// (meeting notes, a daily standup).
+type Template struct {
+	ID      int    `json:"id"`
+	UserID  int    `json:"user_id"`
+	Name    string `json:"name"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+const maxTemplateNameLen = 255
+
+// templateBody reads and validates a template from the request. Title and
+// content follow the same rules as a note's, since notes are made from them.
+func templateBody(w http.ResponseWriter, r *http.Request) (Template, bool) {
+	var body struct {
+		Name    string `json:"name"`
+		Title   string `json:"title"`
+		Content string `json:"content"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return Template{}, false
+	}
+	var verr ValidationError
+	t := Template{
+		Name:    strings.TrimSpace(body.Name),
+		Title:   validateNote(&verr, body.Title, body.Content),
+		Content: body.Content,
+	}
+	if t.Name == "" {
+		verr.Add("name", "required")
+	} else if len(t.Name) > maxTemplateNameLen {
+		verr.Add("name", "too long")
+	}
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return Template{}, false
+	}
+	return t, true
+}
+
+// ownedTemplate loads template {id}, writing the 404 or 500 itself when it
+// can't.
+func ownedTemplate(w http.ResponseWriter, r *http.Request) (Template, bool) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return Template{}, false
+	}
+	t := Template{ID: id, UserID: userID}
+	err := db.QueryRowContext(r.Context(),
+		`SELECT name, title, content FROM templates WHERE id = ? AND user_id = ?`, id, userID,
+	).Scan(&t.Name, &t.Title, &t.Content)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgTemplateNotFound)
+		return Template{}, false
+	}
+	if err != nil {
+		requestLog(r).Error("template query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return Template{}, false
+	}
+	return t, true
+}
+
+func templatesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listTemplatesHandler(w, r)
+	case http.MethodPost:
+		createTemplateHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func templateItemHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if t, ok := ownedTemplate(w, r); ok {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(t)
+		}
+	case http.MethodPut:
+		updateTemplateHandler(w, r)
+	case http.MethodDelete:
+		deleteTemplateHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func listTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT id, user_id, name, title, content FROM templates WHERE user_id = ? ORDER BY name, id`, userID,
+	)
+	if err != nil {
+		requestLog(r).Error("listTemplates query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	templates := []Template{}
+	for rows.Next() {
+		var t Template
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Title, &t.Content); err != nil {
+			requestLog(r).Error("listTemplates scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		templates = append(templates, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+func createTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	t, ok := templateBody(w, r)
+	if !ok {
+		return
+	}
+	t.UserID = userID
+
+	id64, err := insertID(r.Context(), db,
+		`INSERT INTO templates (user_id, name, title, content) VALUES (?, ?, ?, ?)`,
+		userID, t.Name, t.Title, t.Content,
+	)
+	if err != nil {
+		requestLog(r).Error("createTemplate insert", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	t.ID = int(id64)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/templates/"+strconv.Itoa(t.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+func updateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	existing, ok := ownedTemplate(w, r)
+	if !ok {
+		return
+	}
+	t, ok := templateBody(w, r)
+	if !ok {
+		return
+	}
+	t.ID, t.UserID = existing.ID, existing.UserID
+
+	if _, err := db.ExecContext(r.Context(),
+		`UPDATE templates SET name = ?, title = ?, content = ? WHERE id = ? AND user_id = ?`,
+		t.Name, t.Title, t.Content, t.ID, t.UserID,
+	); err != nil {
+		requestLog(r).Error("updateTemplate update", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+func deleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), `DELETE FROM templates WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		requestLog(r).Error("deleteTemplate delete", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		writeJSONError(w, http.StatusNotFound, msgTemplateNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// noteFromTemplateHandler creates a note pre-filled with the template's
+// title and content. Later edits to the template don't touch the note.
+func (a *app) noteFromTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	t, ok := ownedTemplate(w, r)
+	if !ok {
+		return
+	}
+	if !allowNoteCreate(w, t.UserID, 1) {
+		return
+	}
+
+	note, err := a.notes.Create(r.Context(), t.UserID, NoteInput{
+		Title:       t.Title,
+		Content:     t.Content,
+		ContentType: defaultNoteContentType,
+		Color:       defaultNoteColor,
+
+		CreatedIP:        clientIP(r),
+		CreatedUserAgent: truncateUTF8(r.UserAgent(), maxUserAgentLen),
+	})
+	if err != nil {
+		requestLog(r).Error("noteFromTemplate", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	notifyNote("note.created", note)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/notes/"+strconv.Itoa(note.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(note)
+}
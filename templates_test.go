@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+
+	wantFieldErrors(t, c.do("POST", "/templates", map[string]string{"title": ""}), "name", "title")
+
+	resp := c.do("POST", "/templates", map[string]string{"name": "standup", "title": "Standup", "content": "- yesterday\n- today"})
+	wantStatus(t, resp, http.StatusCreated)
+	var tmpl Template
+	decodeBody(t, resp, &tmpl)
+	path := fmt.Sprintf("/templates/%d", tmpl.ID)
+	if resp.Header.Get("Location") != path || tmpl.Name != "standup" {
+		t.Fatalf("created %+v at %q", tmpl, resp.Header.Get("Location"))
+	}
+
+	resp = c.do("PUT", path, map[string]string{"name": "daily standup", "title": "Standup", "content": "- blockers"})
+	wantStatus(t, resp, http.StatusOK)
+	resp = c.do("GET", path, nil)
+	wantStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &tmpl)
+	if tmpl.Name != "daily standup" || tmpl.Content != "- blockers" {
+		t.Fatalf("updated template = %+v", tmpl)
+	}
+
+	resp = c.do("GET", "/templates", nil)
+	wantStatus(t, resp, http.StatusOK)
+	var list []Template
+	decodeBody(t, resp, &list)
+	if len(list) != 1 || list[0].ID != tmpl.ID {
+		t.Fatalf("templates = %+v", list)
+	}
+
+	// A note made from it is a copy; editing the template later doesn't
+	// touch the note.
+	resp = c.do("POST", path+"/notes", nil)
+	wantStatus(t, resp, http.StatusCreated)
+	var note Note
+	decodeBody(t, resp, &note)
+	if note.Title != "Standup" || note.Content != "- blockers" || resp.Header.Get("Location") != fmt.Sprintf("/notes/%d", note.ID) {
+		t.Fatalf("note from template = %+v", note)
+	}
+	wantStatus(t, c.do("PUT", path, map[string]string{"name": "x", "title": "Changed"}), http.StatusOK)
+	resp = c.do("GET", fmt.Sprintf("/notes/%d", note.ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &note)
+	if note.Title != "Standup" {
+		t.Errorf("note title became %q", note.Title)
+	}
+
+	// Other users can't see, use, change or delete it.
+	other := c.newClient()
+	other.login("bob")
+	for _, req := range []struct{ method, path string }{
+		{"GET", path}, {"PUT", path}, {"DELETE", path}, {"POST", path + "/notes"},
+	} {
+		wantJSONError(t, other.do(req.method, req.path, map[string]string{"name": "mine", "title": "mine"}), http.StatusNotFound)
+	}
+	resp = other.do("GET", "/templates", nil)
+	decodeBody(t, resp, &list)
+	if len(list) != 0 {
+		t.Errorf("bob sees %+v", list)
+	}
+
+	wantStatus(t, c.do("DELETE", path, nil), http.StatusNoContent)
+	wantStatus(t, c.do("GET", path, nil), http.StatusNotFound)
+	wantStatus(t, c.do("POST", path+"/notes", nil), http.StatusNotFound)
+}
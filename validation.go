@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ValidationError collects per-field problems with a request body so they
+// can all be reported at once. The zero value is ready to use.
+type ValidationError struct {
+	Fields map[string]string `json:"errors"`
+}
+
+// Add records msg for field. Only the first problem per field is kept.
+func (v *ValidationError) Add(field, msg string) {
+	if v.Fields == nil {
+		v.Fields = make(map[string]string)
+	}
+	if _, ok := v.Fields[field]; !ok {
+		v.Fields[field] = msg
+	}
+}
+
+// HasErrors reports whether any field failed.
+func (v *ValidationError) HasErrors() bool {
+	return len(v.Fields) > 0
+}
+
+func (v *ValidationError) Error() string {
+	fields := make([]string, 0, len(v.Fields))
+	for f, msg := range v.Fields {
+		fields = append(fields, f+": "+msg)
+	}
+	sort.Strings(fields)
+	return "validation failed: " + strings.Join(fields, ", ")
+}
+
+// writeValidationError responds 422 with {"errors": {"field": "message"}}.
+func writeValidationError(w http.ResponseWriter, v *ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidationError(t *testing.T) {
+	var v ValidationError
+	if v.HasErrors() {
+		t.Fatal("zero value has errors")
+	}
+	v.Add("title", "required")
+	v.Add("title", "too long")
+	v.Add("password", "too short")
+	if v.Fields["title"] != "required" {
+		t.Errorf("title = %q, want the first problem kept", v.Fields["title"])
+	}
+	if got, want := v.Error(), "validation failed: password: too short, title: required"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestFieldErrorsReportedTogether(t *testing.T) {
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+
+	resp := c.do("POST", "/register", map[string]string{"username": "", "password": "short"})
+	wantFieldErrors(t, resp, "username", "password")
+
+	c.login("alice")
+	resp = c.do("POST", "/notes", map[string]string{
+		"title":   "",
+		"content": strings.Repeat("x", maxNoteContentLen+1),
+		"color":   "plaid",
+	})
+	wantFieldErrors(t, resp, "title", "content", "color")
+
+	n := c.createNote(map[string]string{"title": "ok"})
+	resp = c.do("PUT", fmt.Sprintf("/notes/%d", n.ID), map[string]string{"title": "", "content_type": "html"})
+	wantFieldErrors(t, resp, "title", "content_type")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// getVersion fetches /version without logging in.
+func getVersion(t *testing.T) map[string]string {
+	t.Helper()
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	resp := c.do("GET", "/version", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+	var got map[string]string
+	decodeBody(t, resp, &got)
+	return got
+}
+
+func TestVersionDefaults(t *testing.T) {
+	got := getVersion(t)
+	// go test links without -X, so these are the defaults.
+	if len(got) != 3 || got["version"] != "dev" || got["commit"] != "dev" || got["built_at"] != "dev" {
+		t.Fatalf("/version = %v, want dev throughout", got)
+	}
+}
+
+func TestVersionInjected(t *testing.T) {
+	oldVersion, oldCommit, oldBuilt := version, commit, builtAt
+	t.Cleanup(func() { version, commit, builtAt = oldVersion, oldCommit, oldBuilt })
+	// What -ldflags "-X main.version=... -X main.commit=... -X main.builtAt=..." sets.
+	version, commit, builtAt = "v1.4.0", "abc1234", "2026-10-16T10:00:00Z"
+
+	got := getVersion(t)
+	if got["version"] != "v1.4.0" || got["commit"] != "abc1234" || got["built_at"] != "2026-10-16T10:00:00Z" {
+		t.Fatalf("/version = %v", got)
+	}
+
+	a, _, _ := newMemApp(t)
+	c := newTestClient(t, a.routes())
+	resp := c.do("HEAD", "/version", nil)
+	wantStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); body != "" {
+		t.Errorf("HEAD body = %q", body)
+	}
+	wantStatus(t, c.do("POST", "/version", nil), http.StatusMethodNotAllowed)
+}
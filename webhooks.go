@@ -0,0 +1,623 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// webhooks delivers note events to the URLs users register under
+// /webhooks. Nil means events are dropped.
+var webhooks *WebhookDispatcher
+
+const (
+	maxWebhooksPerUser = 10
+	maxWebhookURLLen   = 2048
+
+	// webhookMaxAttempts is how many times a delivery is tried before it's
+	// recorded as failed. Attempts are spaced 1s, 2s, 4s... apart.
+	webhookMaxAttempts = 3
+	// webhookDeliveriesKept is how many delivery records are kept per
+	// webhook; older ones are pruned as new ones are written.
+	webhookDeliveriesKept = 100
+
+	webhookWorkers   = 4
+	webhookQueueSize = 1000
+)
+
+// Webhook is a URL that receives a signed POST for every note event of its
+// owner. The secret signs the payloads and is returned once, on creation.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+// MarshalJSON emits CreatedAt in UTC, like Note.
+func (h Webhook) MarshalJSON() ([]byte, error) {
+	type plain Webhook
+	p := plain(h)
+	p.CreatedAt = p.CreatedAt.UTC()
+	return json.Marshal(p)
+}
+
+// WebhookDelivery records the outcome of sending one event to a webhook.
+// StatusCode is the last response's, nil when no response came back.
+type WebhookDelivery struct {
+	ID         int       `json:"id"`
+	Event      string    `json:"event"`
+	Success    bool      `json:"success"`
+	StatusCode *int      `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+	Attempts   int       `json:"attempts"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// MarshalJSON emits CreatedAt in UTC, like Note.
+func (d WebhookDelivery) MarshalJSON() ([]byte, error) {
+	type plain WebhookDelivery
+	p := plain(d)
+	p.CreatedAt = p.CreatedAt.UTC()
+	return json.Marshal(p)
+}
+
+// webhookEvent is the JSON body POSTed to a webhook. Note is the note as
+// GET /notes/{id} returns it, or just its id for note.deleted.
+type webhookEvent struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Note       any       `json:"note"`
+}
+
+// signWebhook is the X-Webhook-Signature value for body: "sha256=" and the
+// hex HMAC-SHA256 of the raw body under the webhook's secret. Receivers
+// should recompute it and compare in constant time.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyNote queues event ("note.created" or "note.updated") for the
+// note's owner.
+func notifyNote(event string, note Note) {
+	if webhooks == nil {
+		return
+	}
+	webhooks.Enqueue(note.UserID, webhookEvent{Event: event, OccurredAt: time.Now().UTC(), Note: note})
+}
+
+// notifyNoteDeleted queues note.deleted for userID's note id.
+func notifyNoteDeleted(userID, id int) {
+	if webhooks == nil {
+		return
+	}
+	webhooks.Enqueue(userID, webhookEvent{Event: "note.deleted", OccurredAt: time.Now().UTC(), Note: map[string]int{"id": id}})
+}
+
+type webhookJob struct {
+	userID int
+	event  webhookEvent
+}
+
+// WebhookDispatcher sends events from a bounded queue on a few background
+// workers, so a slow or dead receiver never holds up the request that
+// caused the event. When the queue is full, new events are dropped and
+// logged rather than blocking. Events still queued at Stop are lost.
+type WebhookDispatcher struct {
+	db      *sql.DB
+	client  *http.Client
+	timeout time.Duration
+	jobs    chan webhookJob
+
+	// ctx is cancelled by Stop, abandoning in-flight deliveries and
+	// retry waits.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// newWebhookDispatcher gives each attempt timeout to complete. Unless
+// allowPrivate is set, receivers on loopback, private and link-local
+// addresses are refused, so users can't aim the server at the network it
+// runs in.
+func newWebhookDispatcher(db *sql.DB, timeout time.Duration, allowPrivate bool) *WebhookDispatcher {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = refusePrivateAddr
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &WebhookDispatcher{
+		db: db,
+		client: &http.Client{
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			// A redirect counts as the receiver's answer, not a new
+			// address to deliver to.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		timeout: timeout,
+		jobs:    make(chan webhookJob, webhookQueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	for i := 0; i < webhookWorkers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// errPrivateWebhookAddr is the delivery error for a receiver on an address
+// the server won't connect to.
+var errPrivateWebhookAddr = errors.New("refusing to deliver to a private address")
+
+// refusePrivateAddr is a net.Dialer Control that runs after DNS
+// resolution, so a public name pointing at a private address is caught
+// too.
+func refusePrivateAddr(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return errPrivateWebhookAddr
+	}
+	return nil
+}
+
+// Enqueue queues event for userID's webhooks without waiting.
+func (d *WebhookDispatcher) Enqueue(userID int, event webhookEvent) {
+	if d.ctx.Err() != nil {
+		return
+	}
+	select {
+	case d.jobs <- webhookJob{userID: userID, event: event}:
+	default:
+		slog.Warn("webhook queue full, dropping event", "user_id", userID, "event", event.Event)
+	}
+}
+
+// Stop ends the workers, abandoning deliveries in progress, and waits for
+// them to exit. It is safe to call more than once.
+func (d *WebhookDispatcher) Stop() {
+	d.stopOnce.Do(d.cancel)
+	d.wg.Wait()
+}
+
+func (d *WebhookDispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case job := <-d.jobs:
+			if err := d.dispatch(job); err != nil && d.ctx.Err() == nil {
+				slog.Error("webhook dispatch", "err", err, "user_id", job.userID, "event", job.event.Event)
+			}
+		}
+	}
+}
+
+// dispatch sends one event to each of the user's webhooks in turn and
+// records how each delivery went.
+func (d *WebhookDispatcher) dispatch(job webhookJob) error {
+	body, err := json.Marshal(job.event)
+	if err != nil {
+		return err
+	}
+
+	rows, err := d.db.QueryContext(d.ctx, `SELECT id, url, secret FROM webhooks WHERE user_id = ? ORDER BY id`, job.userID)
+	if err != nil {
+		return err
+	}
+	var hooks []Webhook
+	for rows.Next() {
+		var h Webhook
+		if err := rows.Scan(&h.ID, &h.URL, &h.Secret); err != nil {
+			rows.Close()
+			return err
+		}
+		hooks = append(hooks, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, h := range hooks {
+		status, attempts, derr := d.deliver(h, job.event.Event, body)
+		if d.ctx.Err() != nil {
+			return nil
+		}
+		if err := d.record(h.ID, job.event.Event, status, attempts, derr); err != nil {
+			slog.Warn("webhook record delivery", "err", err, "webhook_id", h.ID)
+		}
+	}
+	return nil
+}
+
+// deliver POSTs body to h, retrying network errors other than a refused
+// private address, 429s and 5xx answers up to webhookMaxAttempts times. It
+// returns the last status code (0 if there was no response), how many
+// attempts were made, and nil on a 2xx.
+func (d *WebhookDispatcher) deliver(h Webhook, event string, body []byte) (int, int, error) {
+	var status int
+	var err error
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-d.ctx.Done():
+				return status, attempt - 1, d.ctx.Err()
+			case <-time.After(time.Second << (attempt - 2)):
+			}
+		}
+		status, err = d.post(h, event, body)
+		if err == nil {
+			return status, attempt, nil
+		}
+		if errors.Is(err, errPrivateWebhookAddr) ||
+			(status != 0 && status != http.StatusTooManyRequests && status < 500) {
+			return status, attempt, err
+		}
+	}
+	return status, webhookMaxAttempts, err
+}
+
+// post makes one delivery attempt.
+func (d *WebhookDispatcher) post(h Webhook, event string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, d.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo-api-webhooks")
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Signature", signWebhook(h.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// Drain a little so the connection can be reused; receivers have no
+	// reason to send much back.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.New("receiver answered " + resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// record stores a delivery's outcome and prunes the webhook's history to
+// webhookDeliveriesKept entries. A webhook deleted meanwhile makes the
+// insert fail its foreign key, which the caller only logs.
+func (d *WebhookDispatcher) record(webhookID int, event string, status, attempts int, derr error) error {
+	var code sql.NullInt64
+	if status != 0 {
+		code = sql.NullInt64{Int64: int64(status), Valid: true}
+	}
+	var msg sql.NullString
+	if derr != nil {
+		msg = nullString(truncateUTF8(derr.Error(), 255))
+	}
+	ctx := context.Background()
+	if _, err := d.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, event, success, status_code, error, attempts) VALUES (?, ?, ?, ?, ?, ?)`,
+		webhookID, event, derr == nil, code, msg, attempts,
+	); err != nil {
+		return err
+	}
+	// As in pinNoteHandler, MySQL needs the derived table to read the
+	// table it's deleting from, and the derived table's LIMIT keeps the
+	// optimizer from merging it away. With fewer rows than are kept the
+	// subquery is NULL and nothing is deleted.
+	_, err := d.db.ExecContext(ctx,
+		`DELETE FROM webhook_deliveries WHERE webhook_id = ? AND id < (
+			SELECT id FROM (SELECT id FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT 1 OFFSET `+strconv.Itoa(webhookDeliveriesKept-1)+`) k
+		)`,
+		webhookID, webhookID,
+	)
+	return err
+}
+
+// validateWebhookURL checks a webhook body's url, recording problems in v,
+// and returns it trimmed.
+func validateWebhookURL(v *ValidationError, raw string) string {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		v.Add("url", "required")
+		return s
+	}
+	if len(s) > maxWebhookURLLen {
+		v.Add("url", "too long")
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.Add("url", "must be an absolute http or https URL")
+	}
+	return s
+}
+
+func webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listWebhooksHandler(w, r)
+	case http.MethodPost:
+		createWebhookHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func webhookItemHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getWebhookHandler(w, r)
+	case http.MethodPut:
+		updateWebhookHandler(w, r)
+	case http.MethodDelete:
+		deleteWebhookHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	rows, err := db.QueryContext(r.Context(), `SELECT id, url, created_at FROM webhooks WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		requestLog(r).Error("listWebhooks query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		var h Webhook
+		if err := rows.Scan(&h.ID, &h.URL, &h.CreatedAt); err != nil {
+			requestLog(r).Error("listWebhooks scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		hooks = append(hooks, h)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// createWebhookHandler registers {"url": ...} and generates its secret,
+// which is only ever returned here.
+func createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+
+	var body struct {
+		URL string `json:"url"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	var verr ValidationError
+	h := Webhook{URL: validateWebhookURL(&verr, body.URL), CreatedAt: time.Now()}
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return
+	}
+
+	var count int
+	if err := db.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM webhooks WHERE user_id = ?`, userID).Scan(&count); err != nil {
+		requestLog(r).Error("createWebhook count", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	if count >= maxWebhooksPerUser {
+		writeJSONError(w, http.StatusConflict, msgTooManyWebhooks, maxWebhooksPerUser)
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		requestLog(r).Error("createWebhook generate", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	h.Secret = hex.EncodeToString(b)
+
+	id64, err := insertID(r.Context(), db,
+		`INSERT INTO webhooks (user_id, url, secret) VALUES (?, ?, ?)`,
+		userID, h.URL, h.Secret,
+	)
+	if err != nil {
+		requestLog(r).Error("createWebhook insert", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	h.ID = int(id64)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/webhooks/"+strconv.Itoa(h.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h)
+}
+
+// fetchWebhook loads userID's webhook id, without its secret. It returns
+// sql.ErrNoRows when there's no such webhook.
+func fetchWebhook(r *http.Request, userID, id int) (Webhook, error) {
+	var h Webhook
+	err := db.QueryRowContext(r.Context(),
+		`SELECT id, url, created_at FROM webhooks WHERE id = ? AND user_id = ?`, id, userID,
+	).Scan(&h.ID, &h.URL, &h.CreatedAt)
+	return h, err
+}
+
+func getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	h, err := fetchWebhook(r, userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgWebhookNotFound)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("getWebhook", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h)
+}
+
+// updateWebhookHandler changes a webhook's url; the secret stays the same.
+func updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		URL string `json:"url"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	var verr ValidationError
+	u := validateWebhookURL(&verr, body.URL)
+	if verr.HasErrors() {
+		writeValidationError(w, &verr)
+		return
+	}
+
+	if _, err := db.ExecContext(r.Context(), `UPDATE webhooks SET url = ? WHERE id = ? AND user_id = ?`, u, id, userID); err != nil {
+		requestLog(r).Error("updateWebhook update", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	// Read back rather than trusting RowsAffected, which MySQL reports as
+	// 0 when the url didn't change.
+	h, err := fetchWebhook(r, userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgWebhookNotFound)
+		return
+	}
+	if err != nil {
+		requestLog(r).Error("updateWebhook fetch", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h)
+}
+
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), `DELETE FROM webhooks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		requestLog(r).Error("deleteWebhook delete", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	aff, _ := res.RowsAffected()
+	if aff == 0 {
+		writeJSONError(w, http.StatusNotFound, msgWebhookNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webhookDeliveriesHandler lists a webhook's recent deliveries, newest
+// first.
+func webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID := r.Context().Value(userIDKey).(int)
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := fetchWebhook(r, userID, id); errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, msgWebhookNotFound)
+		return
+	} else if err != nil {
+		requestLog(r).Error("webhookDeliveries fetch", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT id, event, success, status_code, error, attempts, created_at FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC`,
+		id,
+	)
+	if err != nil {
+		requestLog(r).Error("webhookDeliveries query", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, msgInternal)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var code sql.NullInt64
+		var msg sql.NullString
+		if err := rows.Scan(&d.ID, &d.Event, &d.Success, &code, &msg, &d.Attempts, &d.CreatedAt); err != nil {
+			requestLog(r).Error("webhookDeliveries scan", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, msgInternal)
+			return
+		}
+		if code.Valid {
+			c := int(code.Int64)
+			d.StatusCode = &c
+		}
+		d.Error = msg.String
+		deliveries = append(deliveries, d)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
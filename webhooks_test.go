@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"note.created"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if got, want := signWebhook("s3cret", body), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("signWebhook = %q, want %q", got, want)
+	}
+	// RFC 4231 test case 2.
+	if got := signWebhook("Jefe", []byte("what do ya want for nothing?")); got != "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Fatalf("signWebhook = %q", got)
+	}
+	if signWebhook("other", body) == signWebhook("s3cret", body) {
+		t.Fatal("signature doesn't depend on the secret")
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"https://example.com/hook":    true,
+		" http://example.com:8080/x ": true,
+		"":                            false,
+		"ftp://example.com/":          false,
+		"/relative":                   false,
+		"https://":                    false,
+		"https://example.com/" + strings.Repeat("a", maxWebhookURLLen): false,
+	} {
+		var v ValidationError
+		validateWebhookURL(&v, raw)
+		if v.HasErrors() == ok {
+			t.Errorf("validateWebhookURL(%.40q): errors %v", raw, v.Fields)
+		}
+	}
+}
+
+// newTestDispatcher is a dispatcher allowed to reach test servers on
+// loopback, stopped when the test ends.
+func newTestDispatcher(t *testing.T, timeout time.Duration) *WebhookDispatcher {
+	t.Helper()
+	d := newWebhookDispatcher(db, timeout, true)
+	t.Cleanup(d.Stop)
+	return d
+}
+
+func TestWebhookDeliverRetries(t *testing.T) {
+	// The first call fails with 503; later ones answer status.
+	var calls, status atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(srv.Close)
+	d := newTestDispatcher(t, time.Second)
+	h := Webhook{URL: srv.URL, Secret: "s"}
+
+	// A 5xx is retried; the next answer counts.
+	status.Store(http.StatusNoContent)
+	code, attempts, err := d.deliver(h, "note.created", []byte("{}"))
+	if err != nil || code != http.StatusNoContent || attempts != 2 {
+		t.Fatalf("deliver = %d, %d, %v; want 204 on attempt 2", code, attempts, err)
+	}
+
+	// Other 4xx answers are final.
+	calls.Store(1)
+	status.Store(http.StatusGone)
+	code, attempts, err = d.deliver(h, "note.created", []byte("{}"))
+	if err == nil || code != http.StatusGone || attempts != 1 {
+		t.Fatalf("deliver = %d, %d, %v; want 410 after one attempt", code, attempts, err)
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(func() { close(release); srv.Close() })
+	d := newTestDispatcher(t, 50*time.Millisecond)
+
+	start := time.Now()
+	code, err := d.post(Webhook{URL: srv.URL}, "note.created", []byte("{}"))
+	if err == nil || code != 0 {
+		t.Fatalf("post to a stuck receiver = %d, %v", code, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("post took %v despite the 50ms timeout", d)
+	}
+}
+
+func TestWebhookRefusesPrivateAddr(t *testing.T) {
+	var called atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called.Store(true) }))
+	t.Cleanup(srv.Close)
+	d := newWebhookDispatcher(db, time.Second, false)
+	t.Cleanup(d.Stop)
+
+	_, attempts, err := d.deliver(Webhook{URL: srv.URL}, "note.created", []byte("{}"))
+	if !errors.Is(err, errPrivateWebhookAddr) || attempts != 1 {
+		t.Fatalf("deliver to loopback = %d attempts, %v; want one refused attempt", attempts, err)
+	}
+	if called.Load() {
+		t.Fatal("the loopback receiver was reached")
+	}
+}
+
+func TestWebhookEnqueueNeverBlocks(t *testing.T) {
+	// No workers drain this queue, so it fills up.
+	d := &WebhookDispatcher{jobs: make(chan webhookJob, 2)}
+	d.ctx, d.cancel = t.Context(), func() {}
+	done := make(chan struct{})
+	go func() {
+		for range 5 {
+			d.Enqueue(1, webhookEvent{Event: "note.created"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Enqueue blocked on a full queue")
+	}
+	if len(d.jobs) != 2 {
+		t.Fatalf("%d jobs queued, want the queue's 2", len(d.jobs))
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	a := newDBApp(t)
+	c := newTestClient(t, a.routes())
+	c.login("alice")
+	webhooks = newTestDispatcher(t, 5*time.Second)
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan received, 4)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header, body}
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+
+	resp := c.do("POST", "/webhooks", map[string]string{"url": srv.URL + "/hook"})
+	wantStatus(t, resp, http.StatusCreated)
+	var hook Webhook
+	decodeBody(t, resp, &hook)
+	if len(hook.Secret) != 64 {
+		t.Fatalf("secret = %q", hook.Secret)
+	}
+
+	// The receiver hangs until released; the request that caused the
+	// event mustn't wait for it.
+	start := time.Now()
+	note := c.createNote(map[string]string{"title": "hooked"})
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("create took %v with a stuck receiver", d)
+	}
+
+	var r received
+	select {
+	case r = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+	if r.header.Get("X-Webhook-Event") != "note.created" || r.header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", r.header)
+	}
+	if sig := r.header.Get("X-Webhook-Signature"); sig != signWebhook(hook.Secret, r.body) {
+		t.Errorf("signature %q doesn't match the body under the secret", sig)
+	}
+	var event struct {
+		Event string `json:"event"`
+		Note  Note   `json:"note"`
+	}
+	if err := json.Unmarshal(r.body, &event); err != nil || event.Event != "note.created" || event.Note.ID != note.ID {
+		t.Fatalf("payload %s: %v", r.body, err)
+	}
+	close(release)
+
+	// The outcome is recorded.
+	path := fmt.Sprintf("/webhooks/%d/deliveries", hook.ID)
+	var deliveries []WebhookDelivery
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp := c.do("GET", path, nil)
+		wantStatus(t, resp, http.StatusOK)
+		decodeBody(t, resp, &deliveries)
+		if len(deliveries) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(deliveries) != 1 || !deliveries[0].Success || deliveries[0].Event != "note.created" ||
+		deliveries[0].StatusCode == nil || *deliveries[0].StatusCode != http.StatusOK || deliveries[0].Attempts != 1 {
+		t.Fatalf("deliveries = %+v", deliveries)
+	}
+	// The secret isn't shown again.
+	resp = c.do("GET", fmt.Sprintf("/webhooks/%d", hook.ID), nil)
+	wantStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); strings.Contains(body, hook.Secret) || strings.Contains(body, "secret") {
+		t.Errorf("GET /webhooks/%d leaks the secret: %s", hook.ID, body)
+	}
+}